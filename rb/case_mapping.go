@@ -0,0 +1,399 @@
+package rb
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+type CaseOption int
+
+const (
+	CaseAscii CaseOption = iota + 1
+	CaseTurkic
+	CaseLithuanian
+	CaseFold
+)
+
+const (
+	caseUpper = iota
+	caseLower
+	caseCapitalize
+	caseSwap
+)
+
+type caseMapping struct {
+	ascii, turkic, lithuanian, fold bool
+}
+
+// newCaseMapping checks options the way Ruby does: :ascii and :fold stand
+// alone, :turkic and :lithuanian may be combined.
+func newCaseMapping(options []CaseOption, mode int) caseMapping {
+	var m caseMapping
+	if len(options) > 2 {
+		panic("too many options")
+	}
+	for i, option := range options {
+		switch option {
+		case CaseTurkic, CaseLithuanian:
+			if i == 1 && options[0] != CaseTurkic+CaseLithuanian-option {
+				panic("invalid second option")
+			}
+			m.turkic = m.turkic || option == CaseTurkic
+			m.lithuanian = m.lithuanian || option == CaseLithuanian
+			continue
+		case CaseAscii:
+			m.ascii = true
+		case CaseFold:
+			if mode != caseLower {
+				panic("option :fold only allowed for downcasing")
+			}
+			m.fold = true
+		default:
+			panic("invalid option")
+		}
+		if len(options) > 1 {
+			panic("too many options")
+		}
+	}
+	return m
+}
+
+func isCased(r rune) bool {
+	return unicode.IsUpper(r) || unicode.IsLower(r) || unicode.IsTitle(r) ||
+		unicode.In(r, unicode.Other_Lowercase, unicode.Other_Uppercase)
+}
+
+func isCaseIgnorable(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Lm, unicode.Sk) ||
+		strings.ContainsRune("'.:\u00B7\u0387\u055F\u05F4\u2018\u2019\u2024\u2027\uFE13\uFE52\uFE55\uFF07\uFF0E\uFF1A", r)
+}
+
+// isFinalSigma reports whether the sigma at runes[i] ends a word: a cased
+// letter comes before it and none after it, skipping case-ignorable ones.
+func isFinalSigma(runes []rune, i int) bool {
+	j := i - 1
+	for j >= 0 && isCaseIgnorable(runes[j]) {
+		j--
+	}
+	if j < 0 || !isCased(runes[j]) {
+		return false
+	}
+	for j = i + 1; j < len(runes) && isCaseIgnorable(runes[j]); j++ {
+	}
+	return j == len(runes) || !isCased(runes[j])
+}
+
+// isMoreAbove reports whether a mark of class 230 follows runes[i] before any
+// other character of class 0 or 230.
+func isMoreAbove(runes []rune, i int) bool {
+	for _, r := range runes[i+1:] {
+		switch combiningClass(r) {
+		case 230:
+			return true
+		case 0:
+			return false
+		}
+	}
+	return false
+}
+
+func isAfterSoftDotted(runes []rune, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if unicode.Is(unicode.Soft_Dotted, runes[j]) {
+			return true
+		}
+		if class := combiningClass(runes[j]); class == 0 || class == 230 {
+			return false
+		}
+	}
+	return false
+}
+
+func (m caseMapping) lower(runes []rune, i int) string {
+	r := runes[i]
+	if m.turkic {
+		switch {
+		case r == 'İ':
+			return "i"
+		case r == 'I' && i+1 < len(runes) && runes[i+1] == '\u0307':
+			return "i"
+		case r == 'I':
+			return "ı"
+		case r == '\u0307' && i > 0 && runes[i-1] == 'I':
+			return ""
+		}
+	}
+	if m.fold {
+		if s, ok := caseFolding[r]; ok {
+			return s
+		}
+		if unicode.Is(unicode.Cherokee, r) {
+			// Cherokee folds to its older uppercase letters
+			return string(unicode.ToUpper(r))
+		}
+		return string(unicode.ToLower(r))
+	}
+	if m.lithuanian {
+		switch r {
+		case 'I', 'J', 'Į':
+			if isMoreAbove(runes, i) {
+				return string(unicode.ToLower(r)) + "\u0307"
+			}
+		case 'Ì':
+			return "i\u0307\u0300"
+		case 'Í':
+			return "i\u0307\u0301"
+		case 'Ĩ':
+			return "i\u0307\u0303"
+		}
+	}
+	if r == 'Σ' && isFinalSigma(runes, i) {
+		return "ς"
+	}
+	if s, ok := specialCasing[r]; ok {
+		return s.lower
+	}
+	return string(unicode.ToLower(r))
+}
+
+func (m caseMapping) upper(runes []rune, i int, title bool) string {
+	r := runes[i]
+	if m.turkic && r == 'i' {
+		return "İ"
+	}
+	if m.lithuanian && r == '\u0307' && isAfterSoftDotted(runes, i) {
+		return ""
+	}
+	if s, ok := specialCasing[r]; ok {
+		if title {
+			return s.title
+		}
+		return s.upper
+	}
+	if title {
+		return string(unicode.ToTitle(r))
+	}
+	return string(unicode.ToUpper(r))
+}
+
+func (m caseMapping) apply(mode int, runes []rune, i int) string {
+	r := runes[i]
+	if m.ascii {
+		switch {
+		case r >= 'a' && r <= 'z' && (mode == caseUpper || mode == caseSwap || mode == caseCapitalize && i == 0):
+			return string(r - 'a' + 'A')
+		case r >= 'A' && r <= 'Z' && (mode == caseLower || mode == caseSwap || mode == caseCapitalize && i > 0):
+			return string(r - 'A' + 'a')
+		}
+		return string(r)
+	}
+	switch mode {
+	case caseUpper:
+		return m.upper(runes, i, false)
+	case caseLower:
+		return m.lower(runes, i)
+	case caseCapitalize:
+		if i == 0 {
+			return m.upper(runes, i, true)
+		}
+		return m.lower(runes, i)
+	}
+	if unicode.IsUpper(r) || unicode.IsTitle(r) {
+		return m.lower(runes, i)
+	}
+	if unicode.IsLower(r) {
+		return m.upper(runes, i, false)
+	}
+	return string(r)
+}
+
+// mapCase maps every character of str in its own encoding. A mapping that
+// the encoding cannot represent leaves the character as it was.
+func (str String) mapCase(mode int, options []CaseOption) String {
+	m := newCaseMapping(options, mode)
+	enc := str.Encoding()
+	if enc == EncodingASCII8Bit || enc == EncodingUSASCII {
+		m = caseMapping{ascii: true}
+	}
+
+	var chars []string
+	var runes []rune
+	var valid []bool
+	str.eachChar(func(s string, r rune, state int) {
+		chars = append(chars, s)
+		runes = append(runes, r)
+		valid = append(valid, state == charValid)
+	})
+
+	var buf, char bytes.Buffer
+	for i := range runes {
+		if !valid[i] {
+			buf.WriteString(chars[i])
+			continue
+		}
+		mapped := m.apply(mode, runes, i)
+		if enc == EncodingUTF8 {
+			buf.WriteString(mapped)
+			continue
+		}
+		char.Reset()
+		encoded := true
+		for _, r := range mapped {
+			if encoded = enc.encode(&char, r); !encoded {
+				break
+			}
+		}
+		if encoded {
+			buf.Write(char.Bytes())
+		} else {
+			buf.WriteString(chars[i])
+		}
+	}
+	return str.withValue(buf.String())
+}
+
+// specialCasing holds the unconditional multi-character mappings of
+// SpecialCasing.txt as lower, title and upper case.
+var specialCasing = map[rune]struct{ lower, title, upper string }{
+	0x00DF: {"\u00DF", "Ss", "SS"},
+	0x0130: {"i\u0307", "\u0130", "\u0130"},
+	0x0149: {"\u0149", "\u02BCN", "\u02BCN"},
+	0x01F0: {"\u01F0", "J\u030C", "J\u030C"},
+	0x0390: {"\u0390", "\u0399\u0308\u0301", "\u0399\u0308\u0301"},
+	0x03B0: {"\u03B0", "\u03A5\u0308\u0301", "\u03A5\u0308\u0301"},
+	0x0587: {"\u0587", "\u0535\u0582", "\u0535\u0552"},
+	0x1E96: {"\u1E96", "H\u0331", "H\u0331"},
+	0x1E97: {"\u1E97", "T\u0308", "T\u0308"},
+	0x1E98: {"\u1E98", "W\u030A", "W\u030A"},
+	0x1E99: {"\u1E99", "Y\u030A", "Y\u030A"},
+	0x1E9A: {"\u1E9A", "A\u02BE", "A\u02BE"},
+	0x1F50: {"\u1F50", "\u03A5\u0313", "\u03A5\u0313"},
+	0x1F52: {"\u1F52", "\u03A5\u0313\u0300", "\u03A5\u0313\u0300"},
+	0x1F54: {"\u1F54", "\u03A5\u0313\u0301", "\u03A5\u0313\u0301"},
+	0x1F56: {"\u1F56", "\u03A5\u0313\u0342", "\u03A5\u0313\u0342"},
+	0x1F80: {"\u1F80", "\u1F88", "\u1F08\u0399"},
+	0x1F81: {"\u1F81", "\u1F89", "\u1F09\u0399"},
+	0x1F82: {"\u1F82", "\u1F8A", "\u1F0A\u0399"},
+	0x1F83: {"\u1F83", "\u1F8B", "\u1F0B\u0399"},
+	0x1F84: {"\u1F84", "\u1F8C", "\u1F0C\u0399"},
+	0x1F85: {"\u1F85", "\u1F8D", "\u1F0D\u0399"},
+	0x1F86: {"\u1F86", "\u1F8E", "\u1F0E\u0399"},
+	0x1F87: {"\u1F87", "\u1F8F", "\u1F0F\u0399"},
+	0x1F88: {"\u1F80", "\u1F88", "\u1F08\u0399"},
+	0x1F89: {"\u1F81", "\u1F89", "\u1F09\u0399"},
+	0x1F8A: {"\u1F82", "\u1F8A", "\u1F0A\u0399"},
+	0x1F8B: {"\u1F83", "\u1F8B", "\u1F0B\u0399"},
+	0x1F8C: {"\u1F84", "\u1F8C", "\u1F0C\u0399"},
+	0x1F8D: {"\u1F85", "\u1F8D", "\u1F0D\u0399"},
+	0x1F8E: {"\u1F86", "\u1F8E", "\u1F0E\u0399"},
+	0x1F8F: {"\u1F87", "\u1F8F", "\u1F0F\u0399"},
+	0x1F90: {"\u1F90", "\u1F98", "\u1F28\u0399"},
+	0x1F91: {"\u1F91", "\u1F99", "\u1F29\u0399"},
+	0x1F92: {"\u1F92", "\u1F9A", "\u1F2A\u0399"},
+	0x1F93: {"\u1F93", "\u1F9B", "\u1F2B\u0399"},
+	0x1F94: {"\u1F94", "\u1F9C", "\u1F2C\u0399"},
+	0x1F95: {"\u1F95", "\u1F9D", "\u1F2D\u0399"},
+	0x1F96: {"\u1F96", "\u1F9E", "\u1F2E\u0399"},
+	0x1F97: {"\u1F97", "\u1F9F", "\u1F2F\u0399"},
+	0x1F98: {"\u1F90", "\u1F98", "\u1F28\u0399"},
+	0x1F99: {"\u1F91", "\u1F99", "\u1F29\u0399"},
+	0x1F9A: {"\u1F92", "\u1F9A", "\u1F2A\u0399"},
+	0x1F9B: {"\u1F93", "\u1F9B", "\u1F2B\u0399"},
+	0x1F9C: {"\u1F94", "\u1F9C", "\u1F2C\u0399"},
+	0x1F9D: {"\u1F95", "\u1F9D", "\u1F2D\u0399"},
+	0x1F9E: {"\u1F96", "\u1F9E", "\u1F2E\u0399"},
+	0x1F9F: {"\u1F97", "\u1F9F", "\u1F2F\u0399"},
+	0x1FA0: {"\u1FA0", "\u1FA8", "\u1F68\u0399"},
+	0x1FA1: {"\u1FA1", "\u1FA9", "\u1F69\u0399"},
+	0x1FA2: {"\u1FA2", "\u1FAA", "\u1F6A\u0399"},
+	0x1FA3: {"\u1FA3", "\u1FAB", "\u1F6B\u0399"},
+	0x1FA4: {"\u1FA4", "\u1FAC", "\u1F6C\u0399"},
+	0x1FA5: {"\u1FA5", "\u1FAD", "\u1F6D\u0399"},
+	0x1FA6: {"\u1FA6", "\u1FAE", "\u1F6E\u0399"},
+	0x1FA7: {"\u1FA7", "\u1FAF", "\u1F6F\u0399"},
+	0x1FA8: {"\u1FA0", "\u1FA8", "\u1F68\u0399"},
+	0x1FA9: {"\u1FA1", "\u1FA9", "\u1F69\u0399"},
+	0x1FAA: {"\u1FA2", "\u1FAA", "\u1F6A\u0399"},
+	0x1FAB: {"\u1FA3", "\u1FAB", "\u1F6B\u0399"},
+	0x1FAC: {"\u1FA4", "\u1FAC", "\u1F6C\u0399"},
+	0x1FAD: {"\u1FA5", "\u1FAD", "\u1F6D\u0399"},
+	0x1FAE: {"\u1FA6", "\u1FAE", "\u1F6E\u0399"},
+	0x1FAF: {"\u1FA7", "\u1FAF", "\u1F6F\u0399"},
+	0x1FB2: {"\u1FB2", "\u1FBA\u0345", "\u1FBA\u0399"},
+	0x1FB3: {"\u1FB3", "\u1FBC", "\u0391\u0399"},
+	0x1FB4: {"\u1FB4", "\u0386\u0345", "\u0386\u0399"},
+	0x1FB6: {"\u1FB6", "\u0391\u0342", "\u0391\u0342"},
+	0x1FB7: {"\u1FB7", "\u0391\u0342\u0345", "\u0391\u0342\u0399"},
+	0x1FBC: {"\u1FB3", "\u1FBC", "\u0391\u0399"},
+	0x1FC2: {"\u1FC2", "\u1FCA\u0345", "\u1FCA\u0399"},
+	0x1FC3: {"\u1FC3", "\u1FCC", "\u0397\u0399"},
+	0x1FC4: {"\u1FC4", "\u0389\u0345", "\u0389\u0399"},
+	0x1FC6: {"\u1FC6", "\u0397\u0342", "\u0397\u0342"},
+	0x1FC7: {"\u1FC7", "\u0397\u0342\u0345", "\u0397\u0342\u0399"},
+	0x1FCC: {"\u1FC3", "\u1FCC", "\u0397\u0399"},
+	0x1FD2: {"\u1FD2", "\u0399\u0308\u0300", "\u0399\u0308\u0300"},
+	0x1FD3: {"\u1FD3", "\u0399\u0308\u0301", "\u0399\u0308\u0301"},
+	0x1FD6: {"\u1FD6", "\u0399\u0342", "\u0399\u0342"},
+	0x1FD7: {"\u1FD7", "\u0399\u0308\u0342", "\u0399\u0308\u0342"},
+	0x1FE2: {"\u1FE2", "\u03A5\u0308\u0300", "\u03A5\u0308\u0300"},
+	0x1FE3: {"\u1FE3", "\u03A5\u0308\u0301", "\u03A5\u0308\u0301"},
+	0x1FE4: {"\u1FE4", "\u03A1\u0313", "\u03A1\u0313"},
+	0x1FE6: {"\u1FE6", "\u03A5\u0342", "\u03A5\u0342"},
+	0x1FE7: {"\u1FE7", "\u03A5\u0308\u0342", "\u03A5\u0308\u0342"},
+	0x1FF2: {"\u1FF2", "\u1FFA\u0345", "\u1FFA\u0399"},
+	0x1FF3: {"\u1FF3", "\u1FFC", "\u03A9\u0399"},
+	0x1FF4: {"\u1FF4", "\u038F\u0345", "\u038F\u0399"},
+	0x1FF6: {"\u1FF6", "\u03A9\u0342", "\u03A9\u0342"},
+	0x1FF7: {"\u1FF7", "\u03A9\u0342\u0345", "\u03A9\u0342\u0399"},
+	0x1FFC: {"\u1FF3", "\u1FFC", "\u03A9\u0399"},
+	0xFB00: {"\uFB00", "Ff", "FF"},
+	0xFB01: {"\uFB01", "Fi", "FI"},
+	0xFB02: {"\uFB02", "Fl", "FL"},
+	0xFB03: {"\uFB03", "Ffi", "FFI"},
+	0xFB04: {"\uFB04", "Ffl", "FFL"},
+	0xFB05: {"\uFB05", "St", "ST"},
+	0xFB06: {"\uFB06", "St", "ST"},
+	0xFB13: {"\uFB13", "\u0544\u0576", "\u0544\u0546"},
+	0xFB14: {"\uFB14", "\u0544\u0565", "\u0544\u0535"},
+	0xFB15: {"\uFB15", "\u0544\u056B", "\u0544\u053B"},
+	0xFB16: {"\uFB16", "\u054E\u0576", "\u054E\u0546"},
+	0xFB17: {"\uFB17", "\u0544\u056D", "\u0544\u053D"},
+}
+
+// caseFolding holds the full case foldings of CaseFolding.txt that differ
+// from the simple lowercase mapping, apart from Cherokee.
+var caseFolding = map[rune]string{
+	0x00B5: "\u03BC", 0x00DF: "ss", 0x0130: "i\u0307", 0x0149: "\u02BCn",
+	0x017F: "s", 0x01F0: "j\u030C", 0x0345: "\u03B9", 0x0390: "\u03B9\u0308\u0301",
+	0x03B0: "\u03C5\u0308\u0301", 0x03C2: "\u03C3", 0x03D0: "\u03B2", 0x03D1: "\u03B8",
+	0x03D5: "\u03C6", 0x03D6: "\u03C0", 0x03F0: "\u03BA", 0x03F1: "\u03C1",
+	0x03F5: "\u03B5", 0x0587: "\u0565\u0582", 0x1C80: "\u0432", 0x1C81: "\u0434",
+	0x1C82: "\u043E", 0x1C83: "\u0441", 0x1C84: "\u0442", 0x1C85: "\u0442",
+	0x1C86: "\u044A", 0x1C87: "\u0463", 0x1C88: "\uA64B", 0x1E96: "h\u0331",
+	0x1E97: "t\u0308", 0x1E98: "w\u030A", 0x1E99: "y\u030A", 0x1E9A: "a\u02BE",
+	0x1E9B: "\u1E61", 0x1E9E: "ss", 0x1F50: "\u03C5\u0313", 0x1F52: "\u03C5\u0313\u0300",
+	0x1F54: "\u03C5\u0313\u0301", 0x1F56: "\u03C5\u0313\u0342", 0x1F80: "\u1F00\u03B9", 0x1F81: "\u1F01\u03B9",
+	0x1F82: "\u1F02\u03B9", 0x1F83: "\u1F03\u03B9", 0x1F84: "\u1F04\u03B9", 0x1F85: "\u1F05\u03B9",
+	0x1F86: "\u1F06\u03B9", 0x1F87: "\u1F07\u03B9", 0x1F88: "\u1F00\u03B9", 0x1F89: "\u1F01\u03B9",
+	0x1F8A: "\u1F02\u03B9", 0x1F8B: "\u1F03\u03B9", 0x1F8C: "\u1F04\u03B9", 0x1F8D: "\u1F05\u03B9",
+	0x1F8E: "\u1F06\u03B9", 0x1F8F: "\u1F07\u03B9", 0x1F90: "\u1F20\u03B9", 0x1F91: "\u1F21\u03B9",
+	0x1F92: "\u1F22\u03B9", 0x1F93: "\u1F23\u03B9", 0x1F94: "\u1F24\u03B9", 0x1F95: "\u1F25\u03B9",
+	0x1F96: "\u1F26\u03B9", 0x1F97: "\u1F27\u03B9", 0x1F98: "\u1F20\u03B9", 0x1F99: "\u1F21\u03B9",
+	0x1F9A: "\u1F22\u03B9", 0x1F9B: "\u1F23\u03B9", 0x1F9C: "\u1F24\u03B9", 0x1F9D: "\u1F25\u03B9",
+	0x1F9E: "\u1F26\u03B9", 0x1F9F: "\u1F27\u03B9", 0x1FA0: "\u1F60\u03B9", 0x1FA1: "\u1F61\u03B9",
+	0x1FA2: "\u1F62\u03B9", 0x1FA3: "\u1F63\u03B9", 0x1FA4: "\u1F64\u03B9", 0x1FA5: "\u1F65\u03B9",
+	0x1FA6: "\u1F66\u03B9", 0x1FA7: "\u1F67\u03B9", 0x1FA8: "\u1F60\u03B9", 0x1FA9: "\u1F61\u03B9",
+	0x1FAA: "\u1F62\u03B9", 0x1FAB: "\u1F63\u03B9", 0x1FAC: "\u1F64\u03B9", 0x1FAD: "\u1F65\u03B9",
+	0x1FAE: "\u1F66\u03B9", 0x1FAF: "\u1F67\u03B9", 0x1FB2: "\u1F70\u03B9", 0x1FB3: "\u03B1\u03B9",
+	0x1FB4: "\u03AC\u03B9", 0x1FB6: "\u03B1\u0342", 0x1FB7: "\u03B1\u0342\u03B9", 0x1FBC: "\u03B1\u03B9",
+	0x1FBE: "\u03B9", 0x1FC2: "\u1F74\u03B9", 0x1FC3: "\u03B7\u03B9", 0x1FC4: "\u03AE\u03B9",
+	0x1FC6: "\u03B7\u0342", 0x1FC7: "\u03B7\u0342\u03B9", 0x1FCC: "\u03B7\u03B9", 0x1FD2: "\u03B9\u0308\u0300",
+	0x1FD3: "\u03B9\u0308\u0301", 0x1FD6: "\u03B9\u0342", 0x1FD7: "\u03B9\u0308\u0342", 0x1FE2: "\u03C5\u0308\u0300",
+	0x1FE3: "\u03C5\u0308\u0301", 0x1FE4: "\u03C1\u0313", 0x1FE6: "\u03C5\u0342", 0x1FE7: "\u03C5\u0308\u0342",
+	0x1FF2: "\u1F7C\u03B9", 0x1FF3: "\u03C9\u03B9", 0x1FF4: "\u03CE\u03B9", 0x1FF6: "\u03C9\u0342",
+	0x1FF7: "\u03C9\u0342\u03B9", 0x1FFC: "\u03C9\u03B9", 0xFB00: "ff", 0xFB01: "fi",
+	0xFB02: "fl", 0xFB03: "ffi", 0xFB04: "ffl", 0xFB05: "st",
+	0xFB06: "st", 0xFB13: "\u0574\u0576", 0xFB14: "\u0574\u0565", 0xFB15: "\u0574\u056B",
+	0xFB16: "\u057E\u0576", 0xFB17: "\u0574\u056D",
+}
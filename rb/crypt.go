@@ -0,0 +1,390 @@
+package rb
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Crypt hashes str the way glibc crypt(3) does. The salt selects the
+// algorithm: "$1$" MD5, "$5$" SHA-256, "$6$" SHA-512 (both accepting a
+// "rounds=N$" prefix), otherwise traditional DES using the first two bytes.
+func (str String) Crypt(salt String) (String, error) {
+	if len(salt.Value) < 2 {
+		return String{}, ArgumentError{"salt too short (need >=2 bytes)"}
+	}
+	if strings.IndexByte(str.Value, 0) >= 0 || strings.IndexByte(salt.Value, 0) >= 0 {
+		return String{}, ArgumentError{"string contains null byte"}
+	}
+
+	key, setting := []byte(str.Value), salt.Value
+	switch {
+	case strings.HasPrefix(setting, "$1$"):
+		return NewString(md5Crypt(key, setting)), nil
+	case strings.HasPrefix(setting, "$5$"):
+		return NewString(shaCrypt(key, setting, "$5$", sha256.New, sha256CryptOrder)), nil
+	case strings.HasPrefix(setting, "$6$"):
+		return NewString(shaCrypt(key, setting, "$6$", sha512.New, sha512CryptOrder)), nil
+	}
+
+	if strings.IndexByte(cryptAlphabet, setting[0]) < 0 || strings.IndexByte(cryptAlphabet, setting[1]) < 0 {
+		return String{}, ArgumentError{"invalid salt " + strconv.Quote(setting) + " for crypt"}
+	}
+	return NewString(desCrypt(key, setting[:2])), nil
+}
+
+// cryptBase64 emits bytes of sum in the given order, three at a time, using
+// the crypt alphabet with the least significant six bits first.
+func cryptBase64(sum []byte, order []int) string {
+	var out strings.Builder
+	for i := 0; i < len(order); i += 3 {
+		group := order[i:min(i+3, len(order))]
+		w := 0
+		for _, idx := range group {
+			w = w<<8 | int(sum[idx])
+		}
+		for n := (len(group)*8 + 5) / 6; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	return out.String()
+}
+
+func cryptSalt(setting string, maxLength int) string {
+	if i := strings.IndexByte(setting, '$'); i >= 0 {
+		setting = setting[:i]
+	}
+	if len(setting) > maxLength {
+		setting = setting[:maxLength]
+	}
+	return setting
+}
+
+var md5CryptOrder = []int{0, 6, 12, 1, 7, 13, 2, 8, 14, 3, 9, 15, 4, 10, 5, 11}
+
+func md5Crypt(key []byte, setting string) string {
+	const magic = "$1$"
+	salt := cryptSalt(setting[len(magic):], 8)
+
+	alt := md5.New()
+	alt.Write(key)
+	alt.Write([]byte(salt))
+	alt.Write(key)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(key)
+	ctx.Write([]byte(magic))
+	ctx.Write([]byte(salt))
+	for n := len(key); n > 0; n -= 16 {
+		ctx.Write(altSum[:min(n, 16)])
+	}
+	for n := len(key); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(key[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx := md5.New()
+		if i&1 != 0 {
+			ctx.Write(key)
+		} else {
+			ctx.Write(sum)
+		}
+		if i%3 != 0 {
+			ctx.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx.Write(key)
+		}
+		if i&1 != 0 {
+			ctx.Write(sum)
+		} else {
+			ctx.Write(key)
+		}
+		sum = ctx.Sum(nil)
+	}
+	return magic + salt + "$" + cryptBase64(sum, md5CryptOrder)
+}
+
+var sha256CryptOrder = []int{
+	0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14,
+	15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29,
+	31, 30,
+}
+
+var sha512CryptOrder = []int{
+	0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4,
+	47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+	31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35,
+	15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+	62, 20, 41, 63,
+}
+
+func shaCrypt(key []byte, setting, magic string, newHash func() hash.Hash, order []int) string {
+	const roundsPrefix = "rounds="
+	setting = setting[len(magic):]
+
+	// Like glibc, an out-of-range round count is clamped rather than rejected
+	// and a malformed one is treated as part of the salt.
+	rounds, customRounds := 5000, false
+	if strings.HasPrefix(setting, roundsPrefix) {
+		digits := setting[len(roundsPrefix):]
+		end := 0
+		for end < len(digits) && digits[end] >= '0' && digits[end] <= '9' {
+			end++
+		}
+		if end > 0 && end < len(digits) && digits[end] == '$' {
+			n, err := strconv.ParseUint(digits[:end], 10, 64)
+			if err != nil || n > 999999999 {
+				n = 999999999
+			}
+			rounds, customRounds = max(int(n), 1000), true
+			setting = digits[end+1:]
+		}
+	}
+	salt := []byte(cryptSalt(setting, 16))
+
+	alt := newHash()
+	alt.Write(key)
+	alt.Write(salt)
+	alt.Write(key)
+	altSum := alt.Sum(nil)
+	size := len(altSum)
+
+	ctx := newHash()
+	ctx.Write(key)
+	ctx.Write(salt)
+	n := len(key)
+	for ; n > size; n -= size {
+		ctx.Write(altSum)
+	}
+	ctx.Write(altSum[:n])
+	for n := len(key); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			ctx.Write(altSum)
+		} else {
+			ctx.Write(key)
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	dp := newHash()
+	for range key {
+		dp.Write(key)
+	}
+	p := repeatBytes(dp.Sum(nil), len(key))
+
+	ds := newHash()
+	for i := 0; i < 16+int(sum[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatBytes(ds.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		ctx := newHash()
+		if i&1 != 0 {
+			ctx.Write(p)
+		} else {
+			ctx.Write(sum)
+		}
+		if i%3 != 0 {
+			ctx.Write(s)
+		}
+		if i%7 != 0 {
+			ctx.Write(p)
+		}
+		if i&1 != 0 {
+			ctx.Write(sum)
+		} else {
+			ctx.Write(p)
+		}
+		sum = ctx.Sum(nil)
+	}
+
+	prefix := magic
+	if customRounds {
+		prefix += roundsPrefix + strconv.Itoa(rounds) + "$"
+	}
+	return prefix + string(salt) + "$" + cryptBase64(sum, order)
+}
+
+func repeatBytes(b []byte, length int) []byte {
+	ret := make([]byte, length)
+	for i := 0; i < length; i += len(b) {
+		copy(ret[i:], b)
+	}
+	return ret
+}
+
+var (
+	desPC1 = []byte{
+		57, 49, 41, 33, 25, 17, 9, 1, 58, 50, 42, 34, 26, 18,
+		10, 2, 59, 51, 43, 35, 27, 19, 11, 3, 60, 52, 44, 36,
+		63, 55, 47, 39, 31, 23, 15, 7, 62, 54, 46, 38, 30, 22,
+		14, 6, 61, 53, 45, 37, 29, 21, 13, 5, 28, 20, 12, 4,
+	}
+	desPC2 = []byte{
+		14, 17, 11, 24, 1, 5, 3, 28, 15, 6, 21, 10,
+		23, 19, 12, 4, 26, 8, 16, 7, 27, 20, 13, 2,
+		41, 52, 31, 37, 47, 55, 30, 40, 51, 45, 33, 48,
+		44, 49, 39, 56, 34, 53, 46, 42, 50, 36, 29, 32,
+	}
+	desShifts = []uint{1, 1, 2, 2, 2, 2, 2, 2, 1, 2, 2, 2, 2, 2, 2, 1}
+	desIP     = []byte{
+		58, 50, 42, 34, 26, 18, 10, 2, 60, 52, 44, 36, 28, 20, 12, 4,
+		62, 54, 46, 38, 30, 22, 14, 6, 64, 56, 48, 40, 32, 24, 16, 8,
+		57, 49, 41, 33, 25, 17, 9, 1, 59, 51, 43, 35, 27, 19, 11, 3,
+		61, 53, 45, 37, 29, 21, 13, 5, 63, 55, 47, 39, 31, 23, 15, 7,
+	}
+	desFP = []byte{
+		40, 8, 48, 16, 56, 24, 64, 32, 39, 7, 47, 15, 55, 23, 63, 31,
+		38, 6, 46, 14, 54, 22, 62, 30, 37, 5, 45, 13, 53, 21, 61, 29,
+		36, 4, 44, 12, 52, 20, 60, 28, 35, 3, 43, 11, 51, 19, 59, 27,
+		34, 2, 42, 10, 50, 18, 58, 26, 33, 1, 41, 9, 49, 17, 57, 25,
+	}
+	desE = []byte{
+		32, 1, 2, 3, 4, 5, 4, 5, 6, 7, 8, 9,
+		8, 9, 10, 11, 12, 13, 12, 13, 14, 15, 16, 17,
+		16, 17, 18, 19, 20, 21, 20, 21, 22, 23, 24, 25,
+		24, 25, 26, 27, 28, 29, 28, 29, 30, 31, 32, 1,
+	}
+	desP = []byte{
+		16, 7, 20, 21, 29, 12, 28, 17, 1, 15, 23, 26, 5, 18, 31, 10,
+		2, 8, 24, 14, 32, 27, 3, 9, 19, 13, 30, 6, 22, 11, 4, 25,
+	}
+	desS = [8][64]byte{
+		{
+			14, 4, 13, 1, 2, 15, 11, 8, 3, 10, 6, 12, 5, 9, 0, 7,
+			0, 15, 7, 4, 14, 2, 13, 1, 10, 6, 12, 11, 9, 5, 3, 8,
+			4, 1, 14, 8, 13, 6, 2, 11, 15, 12, 9, 7, 3, 10, 5, 0,
+			15, 12, 8, 2, 4, 9, 1, 7, 5, 11, 3, 14, 10, 0, 6, 13,
+		},
+		{
+			15, 1, 8, 14, 6, 11, 3, 4, 9, 7, 2, 13, 12, 0, 5, 10,
+			3, 13, 4, 7, 15, 2, 8, 14, 12, 0, 1, 10, 6, 9, 11, 5,
+			0, 14, 7, 11, 10, 4, 13, 1, 5, 8, 12, 6, 9, 3, 2, 15,
+			13, 8, 10, 1, 3, 15, 4, 2, 11, 6, 7, 12, 0, 5, 14, 9,
+		},
+		{
+			10, 0, 9, 14, 6, 3, 15, 5, 1, 13, 12, 7, 11, 4, 2, 8,
+			13, 7, 0, 9, 3, 4, 6, 10, 2, 8, 5, 14, 12, 11, 15, 1,
+			13, 6, 4, 9, 8, 15, 3, 0, 11, 1, 2, 12, 5, 10, 14, 7,
+			1, 10, 13, 0, 6, 9, 8, 7, 4, 15, 14, 3, 11, 5, 2, 12,
+		},
+		{
+			7, 13, 14, 3, 0, 6, 9, 10, 1, 2, 8, 5, 11, 12, 4, 15,
+			13, 8, 11, 5, 6, 15, 0, 3, 4, 7, 2, 12, 1, 10, 14, 9,
+			10, 6, 9, 0, 12, 11, 7, 13, 15, 1, 3, 14, 5, 2, 8, 4,
+			3, 15, 0, 6, 10, 1, 13, 8, 9, 4, 5, 11, 12, 7, 2, 14,
+		},
+		{
+			2, 12, 4, 1, 7, 10, 11, 6, 8, 5, 3, 15, 13, 0, 14, 9,
+			14, 11, 2, 12, 4, 7, 13, 1, 5, 0, 15, 10, 3, 9, 8, 6,
+			4, 2, 1, 11, 10, 13, 7, 8, 15, 9, 12, 5, 6, 3, 0, 14,
+			11, 8, 12, 7, 1, 14, 2, 13, 6, 15, 0, 9, 10, 4, 5, 3,
+		},
+		{
+			12, 1, 10, 15, 9, 2, 6, 8, 0, 13, 3, 4, 14, 7, 5, 11,
+			10, 15, 4, 2, 7, 12, 9, 5, 6, 1, 13, 14, 0, 11, 3, 8,
+			9, 14, 15, 5, 2, 8, 12, 3, 7, 0, 4, 10, 1, 13, 11, 6,
+			4, 3, 2, 12, 9, 5, 15, 10, 11, 14, 1, 7, 6, 0, 8, 13,
+		},
+		{
+			4, 11, 2, 14, 15, 0, 8, 13, 3, 12, 9, 7, 5, 10, 6, 1,
+			13, 0, 11, 7, 4, 9, 1, 10, 14, 3, 5, 12, 2, 15, 8, 6,
+			1, 4, 11, 13, 12, 3, 7, 14, 10, 15, 6, 8, 0, 5, 9, 2,
+			6, 11, 13, 8, 1, 4, 10, 7, 9, 5, 0, 15, 14, 2, 3, 12,
+		},
+		{
+			13, 2, 8, 4, 6, 15, 11, 1, 10, 9, 3, 14, 5, 0, 12, 7,
+			1, 15, 13, 8, 10, 3, 7, 4, 12, 5, 6, 11, 0, 14, 9, 2,
+			7, 11, 4, 1, 9, 12, 14, 2, 0, 6, 10, 13, 15, 3, 5, 8,
+			2, 1, 14, 7, 4, 10, 8, 13, 15, 12, 9, 0, 3, 5, 6, 11,
+		},
+	}
+)
+
+// desPermute picks bits of the width-bit value in, numbered from 1 at the
+// most significant end, in table order.
+func desPermute(in uint64, width uint, table []byte) uint64 {
+	var out uint64
+	for _, p := range table {
+		out = out<<1 | in>>(width-uint(p))&1
+	}
+	return out
+}
+
+// desCrypt is the traditional crypt(3): 25 DES encryptions of a zero block
+// keyed by the first eight bytes of key, with the salt swapping entries of
+// the expansion table.
+func desCrypt(key []byte, salt string) string {
+	var k uint64
+	for i := 0; i < 8; i++ {
+		k <<= 8
+		if i < len(key) {
+			k |= uint64(key[i]<<1) & 0xff
+		}
+	}
+
+	var subkeys [16]uint64
+	cd := desPermute(k, 64, desPC1)
+	c, d := cd>>28, cd&0xfffffff
+	for i, shift := range desShifts {
+		c = (c<<shift | c>>(28-shift)) & 0xfffffff
+		d = (d<<shift | d>>(28-shift)) & 0xfffffff
+		subkeys[i] = desPermute(c<<28|d, 56, desPC2)
+	}
+
+	e := append([]byte(nil), desE...)
+	for i := 0; i < 2; i++ {
+		v := strings.IndexByte(cryptAlphabet, salt[i])
+		for j := 0; j < 6; j++ {
+			if v>>j&1 != 0 {
+				e[6*i+j], e[6*i+j+24] = e[6*i+j+24], e[6*i+j]
+			}
+		}
+	}
+
+	var block uint64
+	for n := 0; n < 25; n++ {
+		b := desPermute(block, 64, desIP)
+		l, r := b>>32, b&0xffffffff
+		for _, subkey := range subkeys {
+			x := desPermute(r, 32, e) ^ subkey
+			var f uint64
+			for s := 0; s < 8; s++ {
+				six := x >> (42 - 6*s) & 0x3f
+				row := six>>4&2 | six&1
+				col := six >> 1 & 0xf
+				f = f<<4 | uint64(desS[s][row*16+col])
+			}
+			l, r = r, l^desPermute(f, 32, desP)
+		}
+		block = desPermute(r<<32|l, 64, desFP)
+	}
+
+	ret := make([]byte, 0, 13)
+	ret = append(ret, salt...)
+	for i := 0; i < 11; i++ {
+		shift := 58 - 6*i
+		var v uint64
+		if shift >= 0 {
+			v = block >> uint(shift) & 0x3f
+		} else {
+			v = block << uint(-shift) & 0x3f
+		}
+		ret = append(ret, cryptAlphabet[v])
+	}
+	return string(ret)
+}
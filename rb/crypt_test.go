@@ -0,0 +1,42 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_Crypt(t *testing.T) {
+	tests := []struct {
+		str, salt, expected string
+	}{
+		{"hello", `ab`, `abl0JrMf6tlhw`},
+		{"hello", `abcdef`, `abl0JrMf6tlhw`},
+		{"", `..`, `..X8NBuQ4l6uQ`},
+		{"password", `zz`, `zzXUHfURnGg8I`},
+		{"a long passphrase exceeding eight", `Xy`, `XyA.9agxqA6p6`},
+		{"hello", `$1$saltstring`, `$1$saltstri$FsuJ9Pfj6RQHKxfsv0gQX/`},
+		{"", `$1$`, `$1$$qRPK7m23GJusamGpoGLby/`},
+		{"hello", `$1$abcdefghijk$zz`, `$1$abcdefgh$rwnEbRiN0agqVgZBovWNQ/`},
+		{"hello", `$5$saltstring`, `$5$saltstring$4mLzDd7PmpYGnmV6HHYAR6tJydOUyhkrRSQDy8q2eK8`},
+		{"hello", `$5$rounds=5000$toolongsaltstring`, `$5$rounds=5000$toolongsaltstrin$WTgCiziuKAFphAxOVAMTpslazlD8vDaLhnD3zU8W1B4`},
+		{"hello", `$5$rounds=1000$`, `$5$rounds=1000$$S9N0YmqVuVy2YtUnvHX0TcZlQveW9y1gngy.wwsbqN7`},
+		{"hello", `$5$rounds=10$`, `$5$rounds=1000$$S9N0YmqVuVy2YtUnvHX0TcZlQveW9y1gngy.wwsbqN7`},
+		{"hello", `$6$rounds=1000$abc`, `$6$rounds=1000$abc$ezk7z0ByB2021q.W2WbfEwaXpqLCvdXKfKniTXIu2iAtsO2wmeTc6beQ6jlqtrp9cKRJUPgPePvRAbUfkVx.d1`},
+		{"Hello world!", `$6$saltstring`, `$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1`},
+		{"", `$6$$`, `$6$$/chiBau24cE26QQVW3IfIe68Xu5.JQ4E8Ie7lcRLwqxO5cxGuBhqF2HmTL.zWJ9zjChg3yJYFXeGBQ2y3Ba1d1`},
+	}
+	for _, test := range tests {
+		actual, err := NewString(test.str).Crypt(NewString(test.salt))
+		assert.Nil(t, err, "%q.crypt(%q)", test.str, test.salt)
+		assert.Equal(t, NewString(test.expected), actual, "%q.crypt(%q)", test.str, test.salt)
+	}
+
+	_, err := NewString("hello").Crypt(NewString("a"))
+	assert.Equal(t, ArgumentError{"salt too short (need >=2 bytes)"}, err, "short salt")
+	_, err = NewString("hello").Crypt(NewString("a!"))
+	assert.IsType(t, ArgumentError{}, err, "invalid salt character")
+	_, err = NewString("hello").Crypt(NewString("$7$abc"))
+	assert.IsType(t, ArgumentError{}, err, "unknown method")
+	_, err = NewString("he\x00llo").Crypt(NewString("ab"))
+	assert.Equal(t, ArgumentError{"string contains null byte"}, err, "null byte")
+}
@@ -0,0 +1,535 @@
+package rb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	charValid = iota
+	charInvalid
+	charUndefined
+)
+
+type Encoding struct {
+	name            string
+	aliases         []string
+	asciiCompatible bool
+	unicode         bool
+	minLength       int
+	// decode reads one character from a non-empty s. Invalid byte sequences are
+	// reported with the length of the maximal invalid subpart.
+	decode func(s string) (r rune, width int, state int)
+	encode func(buf *bytes.Buffer, r rune) bool
+}
+
+var (
+	EncodingUTF8        = &Encoding{"UTF-8", []string{"CP65001"}, true, true, 1, decodeUTF8, encodeUTF8}
+	EncodingASCII8Bit   = &Encoding{"ASCII-8BIT", []string{"BINARY"}, true, false, 1, decodeBinary, encodeASCII}
+	EncodingUSASCII     = &Encoding{"US-ASCII", []string{"ASCII", "ANSI_X3.4-1968", "646"}, true, false, 1, decodeASCII, encodeASCII}
+	EncodingISO8859_1   = &Encoding{"ISO-8859-1", []string{"ISO8859-1"}, true, false, 1, decodeLatin1, encodeLatin1}
+	EncodingWindows1252 = &Encoding{"Windows-1252", []string{"CP1252"}, true, false, 1, decodeWindows1252, encodeWindows1252}
+	EncodingUTF16LE     = &Encoding{"UTF-16LE", nil, false, true, 2, decodeUTF16(false), encodeUTF16(false)}
+	EncodingUTF16BE     = &Encoding{"UTF-16BE", []string{"UCS-2BE"}, false, true, 2, decodeUTF16(true), encodeUTF16(true)}
+	EncodingUTF32LE     = &Encoding{"UTF-32LE", []string{"UCS-4LE"}, false, true, 4, decodeUTF32(false), encodeUTF32(false)}
+	EncodingUTF32BE     = &Encoding{"UTF-32BE", []string{"UCS-4BE"}, false, true, 4, decodeUTF32(true), encodeUTF32(true)}
+)
+
+var encodings = []*Encoding{
+	EncodingUTF8, EncodingASCII8Bit, EncodingUSASCII, EncodingISO8859_1, EncodingWindows1252,
+	EncodingUTF16LE, EncodingUTF16BE, EncodingUTF32LE, EncodingUTF32BE,
+}
+
+func FindEncoding(name string) (*Encoding, error) {
+	for _, enc := range encodings {
+		if strings.EqualFold(enc.name, name) {
+			return enc, nil
+		}
+		for _, alias := range enc.aliases {
+			if strings.EqualFold(alias, name) {
+				return enc, nil
+			}
+		}
+	}
+	return nil, ArgumentError{"unknown encoding name - " + name}
+}
+
+func (enc *Encoding) Name() string {
+	return enc.name
+}
+
+func (enc *Encoding) Names() []string {
+	return append([]string{enc.name}, enc.aliases...)
+}
+
+func (enc *Encoding) IsAsciiCompatible() bool {
+	return enc.asciiCompatible
+}
+
+func (enc *Encoding) Inspect() string {
+	return "#<Encoding:" + enc.name + ">"
+}
+
+func (enc *Encoding) String() string {
+	return enc.name
+}
+
+func decodeUTF8(s string) (rune, int, int) {
+	r, width := utf8.DecodeRuneInString(s)
+	if r != utf8.RuneError || width > 1 {
+		return r, width, charValid
+	}
+	lo, hi := byte(0x80), byte(0xBF)
+	need := 0
+	switch b := s[0]; {
+	case b >= 0xC2 && b <= 0xDF:
+		need = 1
+	case b == 0xE0:
+		need, lo = 2, 0xA0
+	case b == 0xED:
+		need, hi = 2, 0x9F
+	case b >= 0xE1 && b <= 0xEF:
+		need = 2
+	case b == 0xF0:
+		need, lo = 3, 0x90
+	case b >= 0xF1 && b <= 0xF3:
+		need = 3
+	case b == 0xF4:
+		need, hi = 3, 0x8F
+	}
+	width = 1
+	for ; width <= need && width < len(s); width++ {
+		if c := s[width]; c < lo || c > hi {
+			break
+		}
+		lo, hi = 0x80, 0xBF
+	}
+	return utf8.RuneError, width, charInvalid
+}
+
+func encodeUTF8(buf *bytes.Buffer, r rune) bool {
+	buf.WriteRune(r)
+	return true
+}
+
+func decodeBinary(s string) (rune, int, int) {
+	if s[0] < 0x80 {
+		return rune(s[0]), 1, charValid
+	}
+	return rune(s[0]), 1, charUndefined
+}
+
+func decodeASCII(s string) (rune, int, int) {
+	if s[0] < 0x80 {
+		return rune(s[0]), 1, charValid
+	}
+	return utf8.RuneError, 1, charInvalid
+}
+
+func encodeASCII(buf *bytes.Buffer, r rune) bool {
+	if r < 0x80 {
+		buf.WriteByte(byte(r))
+		return true
+	}
+	return false
+}
+
+func decodeLatin1(s string) (rune, int, int) {
+	return rune(s[0]), 1, charValid
+}
+
+func encodeLatin1(buf *bytes.Buffer, r rune) bool {
+	if r < 0x100 {
+		buf.WriteByte(byte(r))
+		return true
+	}
+	return false
+}
+
+// windows1252 maps 0x80-0x9F, 0 marks the bytes without a Unicode mapping.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+func decodeWindows1252(s string) (rune, int, int) {
+	b := s[0]
+	if b < 0x80 || b >= 0xA0 {
+		return rune(b), 1, charValid
+	}
+	if r := windows1252[b-0x80]; r != 0 {
+		return r, 1, charValid
+	}
+	return rune(b), 1, charUndefined
+}
+
+func encodeWindows1252(buf *bytes.Buffer, r rune) bool {
+	if r < 0x80 || (r >= 0xA0 && r < 0x100) {
+		buf.WriteByte(byte(r))
+		return true
+	}
+	for i, c := range windows1252 {
+		if c == r && c != 0 {
+			buf.WriteByte(byte(0x80 + i))
+			return true
+		}
+	}
+	return false
+}
+
+func decodeUTF16(bigEndian bool) func(string) (rune, int, int) {
+	unit := func(s string) rune {
+		if bigEndian {
+			return rune(s[0])<<8 | rune(s[1])
+		}
+		return rune(s[1])<<8 | rune(s[0])
+	}
+	return func(s string) (rune, int, int) {
+		if len(s) < 2 {
+			return utf8.RuneError, len(s), charInvalid
+		}
+		r := unit(s)
+		if r < 0xD800 || r > 0xDFFF {
+			return r, 2, charValid
+		}
+		if r >= 0xDC00 {
+			return utf8.RuneError, 2, charInvalid
+		}
+		if len(s) < 4 {
+			return utf8.RuneError, len(s), charInvalid
+		}
+		low := unit(s[2:])
+		if low < 0xDC00 || low > 0xDFFF {
+			return utf8.RuneError, 2, charInvalid
+		}
+		return (r-0xD800)<<10 + (low - 0xDC00) + 0x10000, 4, charValid
+	}
+}
+
+func encodeUTF16(bigEndian bool) func(*bytes.Buffer, rune) bool {
+	unit := func(buf *bytes.Buffer, r rune) {
+		if bigEndian {
+			buf.WriteByte(byte(r >> 8))
+			buf.WriteByte(byte(r))
+		} else {
+			buf.WriteByte(byte(r))
+			buf.WriteByte(byte(r >> 8))
+		}
+	}
+	return func(buf *bytes.Buffer, r rune) bool {
+		if r >= 0x10000 {
+			r -= 0x10000
+			unit(buf, 0xD800+(r>>10))
+			unit(buf, 0xDC00+(r&0x3FF))
+		} else {
+			unit(buf, r)
+		}
+		return true
+	}
+}
+
+func decodeUTF32(bigEndian bool) func(string) (rune, int, int) {
+	return func(s string) (rune, int, int) {
+		if len(s) < 4 {
+			return utf8.RuneError, len(s), charInvalid
+		}
+		var r rune
+		if bigEndian {
+			r = rune(s[0])<<24 | rune(s[1])<<16 | rune(s[2])<<8 | rune(s[3])
+		} else {
+			r = rune(s[3])<<24 | rune(s[2])<<16 | rune(s[1])<<8 | rune(s[0])
+		}
+		if r < 0 || r > utf8.MaxRune || (r >= 0xD800 && r <= 0xDFFF) {
+			return utf8.RuneError, 4, charInvalid
+		}
+		return r, 4, charValid
+	}
+}
+
+func encodeUTF32(bigEndian bool) func(*bytes.Buffer, rune) bool {
+	return func(buf *bytes.Buffer, r rune) bool {
+		if bigEndian {
+			buf.Write([]byte{byte(r >> 24), byte(r >> 16), byte(r >> 8), byte(r)})
+		} else {
+			buf.Write([]byte{byte(r), byte(r >> 8), byte(r >> 16), byte(r >> 24)})
+		}
+		return true
+	}
+}
+
+func escapeBytes(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		fmt.Fprintf(&buf, "\\x%02X", s[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func (str String) Encoding() *Encoding {
+	if str.enc == nil {
+		return EncodingUTF8
+	}
+	return str.enc
+}
+
+func (str String) withEncoding(enc *Encoding) String {
+	if enc == EncodingUTF8 {
+		enc = nil
+	}
+	return String{Value: str.Value, enc: enc}
+}
+
+// withValue returns value as a String in the encoding of str.
+func (str String) withValue(value string) String {
+	return String{Value: value, enc: str.enc}
+}
+
+func (str String) ForceEncoding(enc *Encoding) String {
+	return str.withEncoding(enc)
+}
+
+// compatibleEncoding returns the encoding a combination of a and b has, as
+// Ruby's Encoding.compatible? decides it.
+func compatibleEncoding(a, b String) (*Encoding, error) {
+	encA, encB := a.Encoding(), b.Encoding()
+	switch {
+	case encA == encB, b.Value == "":
+		return encA, nil
+	case a.Value == "":
+		if encA.asciiCompatible && b.IsAsciiOnly() {
+			return encA, nil
+		}
+		return encB, nil
+	case !encA.asciiCompatible || !encB.asciiCompatible:
+	case b.IsAsciiOnly():
+		return encA, nil
+	case a.IsAsciiOnly():
+		return encB, nil
+	}
+	return nil, EncodingCompatibilityError{"incompatible character encodings: " + encA.name + " and " + encB.name}
+}
+
+// decodeChar decodes the first character of s, an invalid sequence is
+// reported one minimum-length unit at a time as Ruby does.
+func (enc *Encoding) decodeChar(s string) (r rune, width int, state int) {
+	r, width, state = enc.decode(s)
+	if state == charInvalid && width > enc.minLength {
+		width = min(enc.minLength, len(s))
+	}
+	return
+}
+
+// eachChar walks the characters of str in its encoding.
+func (str String) eachChar(action func(s string, r rune, state int)) {
+	enc := str.Encoding()
+	for i := 0; i < len(str.Value); {
+		r, width, state := enc.decodeChar(str.Value[i:])
+		action(str.Value[i:i+width], r, state)
+		i += width
+	}
+}
+
+func (str String) IsValidEncoding() bool {
+	enc := str.Encoding()
+	if enc == EncodingUTF8 {
+		return utf8.ValidString(str.Value)
+	}
+	for i := 0; i < len(str.Value); {
+		_, width, state := enc.decode(str.Value[i:])
+		if state == charInvalid {
+			return false
+		}
+		i += width
+	}
+	return true
+}
+
+type EncodeAction int
+
+const (
+	EncodeRaise EncodeAction = iota
+	EncodeReplace
+)
+
+type EncodeNewline int
+
+const (
+	NewlineAsIs EncodeNewline = iota
+	NewlineUniversal
+	NewlineCRLF
+	NewlineCR
+	NewlineLF
+)
+
+type EncodeOptions struct {
+	Invalid EncodeAction
+	Undef   EncodeAction
+	// Replace overrides the default replacement, U+FFFD for Unicode targets and "?" otherwise.
+	Replace *string
+	Newline EncodeNewline
+}
+
+func defaultReplacement(enc *Encoding) string {
+	if enc.unicode {
+		return "�"
+	}
+	return "?"
+}
+
+func convertNewlines(s string, newline EncodeNewline) string {
+	switch newline {
+	case NewlineUniversal:
+		return strings.Replace(strings.Replace(s, "\r\n", "\n", -1), "\r", "\n", -1)
+	case NewlineCRLF:
+		return strings.Replace(s, "\n", "\r\n", -1)
+	case NewlineCR:
+		return strings.Replace(s, "\n", "\r", -1)
+	}
+	return s
+}
+
+func (str String) Encode(to *Encoding, opts EncodeOptions) (String, error) {
+	from := str.Encoding()
+	if from == to {
+		ret := str.Dup()
+		if opts.Invalid == EncodeReplace {
+			var replacement interface{}
+			if opts.Replace != nil {
+				replacement = *opts.Replace
+			}
+			ret = str.Scrub(replacement)
+		}
+		if opts.Newline != NewlineAsIs && from.asciiCompatible {
+			ret = NewString(convertNewlines(ret.Value, opts.Newline)).withEncoding(to)
+		}
+		return ret, nil
+	}
+
+	replacement := defaultReplacement(to)
+	if opts.Replace != nil {
+		replacement = *opts.Replace
+	}
+	var encodedReplacement bytes.Buffer
+	for _, r := range replacement {
+		if !to.encode(&encodedReplacement, r) {
+			return str, UndefinedConversionError{fmt.Sprintf("U+%04X from UTF-8 to %s", r, to.name)}
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	pendingCR := false
+	emit := func(r rune) bool {
+		switch opts.Newline {
+		case NewlineUniversal:
+			if pendingCR {
+				pendingCR = false
+				to.encode(&buf, '\n')
+				if r == '\n' {
+					return true
+				}
+			}
+			if r == '\r' {
+				pendingCR = true
+				return true
+			}
+		case NewlineCRLF:
+			if r == '\n' {
+				to.encode(&buf, '\r')
+			}
+		case NewlineCR:
+			if r == '\n' {
+				r = '\r'
+			}
+		}
+		return to.encode(&buf, r)
+	}
+	for i := 0; i < len(str.Value) && err == nil; {
+		r, width, state := from.decode(str.Value[i:])
+		switch state {
+		case charInvalid:
+			if opts.Invalid == EncodeReplace {
+				buf.Write(encodedReplacement.Bytes())
+			} else {
+				err = InvalidByteSequenceError{escapeBytes(str.Value[i:i+width]) + " on " + from.name}
+			}
+		case charUndefined:
+			if opts.Undef == EncodeReplace {
+				buf.Write(encodedReplacement.Bytes())
+			} else if to == EncodingUTF8 {
+				err = UndefinedConversionError{escapeBytes(str.Value[i:i+width]) + " from " + from.name + " to UTF-8"}
+			} else {
+				err = UndefinedConversionError{escapeBytes(str.Value[i:i+width]) + " to UTF-8 in conversion from " + from.name + " to UTF-8 to " + to.name}
+			}
+		default:
+			if !emit(r) {
+				if opts.Undef == EncodeReplace {
+					buf.Write(encodedReplacement.Bytes())
+				} else if from == EncodingUTF8 {
+					err = UndefinedConversionError{fmt.Sprintf("U+%04X from UTF-8 to %s", r, to.name)}
+				} else {
+					err = UndefinedConversionError{fmt.Sprintf("U+%04X to %s in conversion from %s to UTF-8 to %s", r, to.name, from.name, to.name)}
+				}
+			}
+		}
+		i += width
+	}
+	if err != nil {
+		return str, err
+	}
+	if pendingCR {
+		to.encode(&buf, '\n')
+	}
+	return NewString(buf.String()).withEncoding(to), nil
+}
+
+func (str String) Scrub(replacement interface{}) String {
+	enc := str.Encoding()
+	var replace func(String) String
+	switch repl := replacement.(type) {
+	case nil:
+		replace = func(String) String {
+			return NewString(defaultReplacement(enc))
+		}
+	case string:
+		replace = func(String) String {
+			return NewString(repl)
+		}
+	case String:
+		replace = func(String) String {
+			return repl
+		}
+	case func(String) String:
+		replace = repl
+	default:
+		panic("Replacement type must be one of: nil, string, String, func(String) String")
+	}
+
+	if str.IsValidEncoding() {
+		return str.Dup()
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(str.Value); {
+		_, width, state := enc.decode(str.Value[i:])
+		if state == charInvalid {
+			rep := replace(NewString(str.Value[i : i+width]).withEncoding(enc))
+			if enc.asciiCompatible || rep.Encoding() == enc {
+				buf.WriteString(rep.Value)
+			} else {
+				for _, r := range rep.Value {
+					enc.encode(&buf, r)
+				}
+			}
+		} else {
+			buf.WriteString(str.Value[i : i+width])
+		}
+		i += width
+	}
+	return NewString(buf.String()).withEncoding(enc)
+}
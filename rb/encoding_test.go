@@ -0,0 +1,103 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindEncoding(t *testing.T) {
+	enc, err := FindEncoding("binary")
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingASCII8Bit, enc, "alias lookup")
+
+	_, err = FindEncoding("EBCDIC-X")
+	assert.Equal(t, ArgumentError{"unknown encoding name - EBCDIC-X"}, err, "unknown encoding")
+}
+
+func TestString_ForceEncoding(t *testing.T) {
+	str := NewString("h\xC3\xA9")
+	assert.Equal(t, EncodingUTF8, str.Encoding(), "UTF-8 by default")
+	assert.Equal(t, 2, str.Length(), "UTF-8 length")
+
+	latin1 := str.ForceEncoding(EncodingISO8859_1)
+	assert.Equal(t, EncodingISO8859_1, latin1.Encoding(), "forced encoding")
+	assert.Equal(t, 3, latin1.Length(), "ISO-8859-1 length")
+	assert.Equal(t, str, latin1.ForceEncoding(EncodingUTF8), "force back to UTF-8")
+	assert.Equal(t, []String{NewString("h").ForceEncoding(EncodingISO8859_1),
+		NewString("\xC3").ForceEncoding(EncodingISO8859_1),
+		NewString("\xA9").ForceEncoding(EncodingISO8859_1)}, latin1.Chars(), "ISO-8859-1 chars")
+}
+
+func TestString_IsValidEncoding(t *testing.T) {
+	assert.True(t, NewString("héllo").IsValidEncoding(), "valid UTF-8")
+	assert.False(t, NewString("h\xFFllo").IsValidEncoding(), "invalid UTF-8")
+	assert.True(t, NewString("h\xFF").ForceEncoding(EncodingASCII8Bit).IsValidEncoding(), "binary is always valid")
+	assert.False(t, NewString("h\xFF").ForceEncoding(EncodingUSASCII).IsValidEncoding(), "invalid US-ASCII")
+	assert.False(t, NewString("\x00\xD8").ForceEncoding(EncodingUTF16LE).IsValidEncoding(), "lone surrogate")
+	assert.False(t, NewString("a\x00b").ForceEncoding(EncodingUTF16LE).IsValidEncoding(), "truncated UTF-16")
+}
+
+func TestString_Encode(t *testing.T) {
+	ret, err := NewString("h€llo").Encode(EncodingWindows1252, EncodeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, NewString("h\x80llo").ForceEncoding(EncodingWindows1252), ret, "UTF-8 to Windows-1252")
+
+	ret, err = ret.Encode(EncodingUTF8, EncodeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, NewString("h€llo"), ret, "Windows-1252 to UTF-8")
+
+	ret, err = NewString("a😀").Encode(EncodingUTF16BE, EncodeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "\x00a\xD8\x3D\xDE\x00", ret.Value, "UTF-8 to UTF-16BE")
+	assert.Equal(t, 2, ret.Length(), "UTF-16BE length")
+	assert.Equal(t, `"\x00a\xD8=\xDE\x00".dup.force_encoding("UTF-16BE")`, ret.Dump().Value, "UTF-16BE dump")
+
+	ret, err = ret.Encode(EncodingUTF32LE, EncodeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a\x00\x00\x00\x00\xF6\x01\x00", ret.Value, "UTF-16BE to UTF-32LE")
+
+	_, err = NewString("é").Encode(EncodingUSASCII, EncodeOptions{})
+	assert.Equal(t, UndefinedConversionError{"U+00E9 from UTF-8 to US-ASCII"}, err, "undefined conversion")
+
+	_, err = NewString("a\xFF").Encode(EncodingISO8859_1, EncodeOptions{})
+	assert.Equal(t, InvalidByteSequenceError{`"\xFF" on UTF-8`}, err, "invalid byte sequence")
+
+	_, err = NewString("\xFF").ForceEncoding(EncodingASCII8Bit).Encode(EncodingUTF8, EncodeOptions{})
+	assert.Equal(t, UndefinedConversionError{`"\xFF" from ASCII-8BIT to UTF-8`}, err, "binary to UTF-8")
+
+	ret, err = NewString("é\xFFa").Encode(EncodingUSASCII, EncodeOptions{Invalid: EncodeReplace, Undef: EncodeReplace})
+	assert.Nil(t, err)
+	assert.Equal(t, "??a", ret.Value, "replace invalid and undefined")
+
+	replace := "*"
+	ret, err = NewString("é\xFFa").Encode(EncodingUSASCII, EncodeOptions{Invalid: EncodeReplace, Undef: EncodeReplace, Replace: &replace})
+	assert.Nil(t, err)
+	assert.Equal(t, "**a", ret.Value, "custom replacement")
+
+	ret, err = NewString("\xE3\x81a").Encode(EncodingUTF8, EncodeOptions{Invalid: EncodeReplace})
+	assert.Nil(t, err)
+	assert.Equal(t, "�a", ret.Value, "replace invalid on same encoding")
+
+	ret, err = NewString("a\r\nb\rc\n").Encode(EncodingUTF16LE, EncodeOptions{Newline: NewlineUniversal})
+	assert.Nil(t, err)
+	assert.Equal(t, "a\x00\n\x00b\x00\n\x00c\x00\n\x00", ret.Value, "universal newline")
+
+	ret, err = NewString("a\nb").Encode(EncodingUTF8, EncodeOptions{Newline: NewlineCRLF})
+	assert.Nil(t, err)
+	assert.Equal(t, "a\r\nb", ret.Value, "crlf newline")
+}
+
+func TestString_Scrub(t *testing.T) {
+	assert.Equal(t, "abc", NewString("abc").Scrub(nil).Value, "valid string")
+	assert.Equal(t, "a�b��", NewString("a\xE3\x81b\xFF\xFF").Scrub(nil).Value, "default replacement")
+	assert.Equal(t, "a?b", NewString("a\xFFb").Scrub("?").Value, "string replacement")
+	assert.Equal(t, "a<FF>b", NewString("a\xFFb").Scrub(func(bad String) String {
+		return NewString("<" + fmtHex(bad) + ">")
+	}).Value, "block replacement")
+	assert.Equal(t, "a\x00\xFD\xFF", NewString("a\x00\x00\xD8").ForceEncoding(EncodingUTF16LE).Scrub(nil).Value, "UTF-16 replacement")
+}
+
+func fmtHex(str String) string {
+	ret, _ := NewString("%02X").Format(str.Bytes()[0])
+	return ret.Value
+}
@@ -0,0 +1,113 @@
+package rb
+
+type IndexError struct {
+	Message string
+}
+
+func (e IndexError) Error() string {
+	return e.Message
+}
+
+type RangeError struct {
+	Message string
+}
+
+func (e RangeError) Error() string {
+	return e.Message
+}
+
+type ArgumentError struct {
+	Message string
+}
+
+func (e ArgumentError) Error() string {
+	return e.Message
+}
+
+type TypeError struct {
+	Message string
+}
+
+func (e TypeError) Error() string {
+	return e.Message
+}
+
+type KeyError struct {
+	Message string
+}
+
+func (e KeyError) Error() string {
+	return e.Message
+}
+
+type InvalidByteSequenceError struct {
+	Message string
+}
+
+func (e InvalidByteSequenceError) Error() string {
+	return e.Message
+}
+
+type UndefinedConversionError struct {
+	Message string
+}
+
+func (e UndefinedConversionError) Error() string {
+	return e.Message
+}
+
+type RuntimeError struct {
+	Message string
+}
+
+func (e RuntimeError) Error() string {
+	return e.Message
+}
+
+type RegexpError struct {
+	Message string
+}
+
+func (e RegexpError) Error() string {
+	return e.Message
+}
+
+type RegexpTimeoutError struct {
+	Message string
+}
+
+func (e RegexpTimeoutError) Error() string {
+	return e.Message
+}
+
+type EncodingCompatibilityError struct {
+	Message string
+}
+
+func (e EncodingCompatibilityError) Error() string {
+	return e.Message
+}
+
+type FrozenError struct {
+	Message string
+}
+
+func (e FrozenError) Error() string {
+	return e.Message
+}
+
+type ZeroDivisionError struct {
+	Message string
+}
+
+func (e ZeroDivisionError) Error() string {
+	return e.Message
+}
+
+type ScanError struct {
+	Message string
+}
+
+func (e ScanError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,696 @@
+package rb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type RegexpOptions int
+
+const (
+	RegexpIgnoreCase RegexpOptions = 1
+	RegexpExtended   RegexpOptions = 2
+	RegexpMultiline  RegexpOptions = 4
+)
+
+// GoRegexp is a Ruby regular expression translated to Go's regexp syntax:
+// ^ and $ always anchor at lines, /m lets dot match a newline and /x strips
+// whitespace and comments. Constructs RE2 cannot run, such as lookaround or
+// backreferences, are rejected; Regexp supports them.
+type GoRegexp struct {
+	*regexp.Regexp
+	source  string
+	options RegexpOptions
+}
+
+func CompileGoRegexp(source string, options RegexpOptions) (*GoRegexp, error) {
+	expr, err := translateRegexp(source, options)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, RegexpError{err.Error() + ": /" + source + "/"}
+	}
+	return &GoRegexp{re, source, options}, nil
+}
+
+func MustCompileGoRegexp(source string, options RegexpOptions) *GoRegexp {
+	re, err := CompileGoRegexp(source, options)
+	if err != nil {
+		panic(err.Error())
+	}
+	return re
+}
+
+func RegexpEscape(str String) String {
+	var buf strings.Builder
+	for _, r := range str.Value {
+		switch r {
+		case '[', ']', '{', '}', '(', ')', '|', '-', '*', '.', '\\', '?', '+', '^', '$', '#', ' ':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return str.withValue(buf.String())
+}
+
+// RegexpUnion builds a regexp matching any of patterns, which may be
+// strings, matched literally, or *GoRegexp, keeping their own options.
+func RegexpUnion(patterns ...interface{}) (*GoRegexp, error) {
+	if len(patterns) == 0 {
+		return CompileGoRegexp("(?!)", 0)
+	}
+	sources := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		switch p := pattern.(type) {
+		case *GoRegexp:
+			if len(patterns) == 1 {
+				return p, nil
+			}
+			sources[i] = p.ToS()
+		case String:
+			sources[i] = RegexpEscape(p).Value
+		case string:
+			sources[i] = RegexpEscape(NewString(p)).Value
+		default:
+			panic("Pattern type must be one of: string, String, *GoRegexp")
+		}
+	}
+	return CompileGoRegexp(strings.Join(sources, "|"), 0)
+}
+
+func (re *GoRegexp) Source() string {
+	return re.source
+}
+
+func (re *GoRegexp) Options() RegexpOptions {
+	return re.options
+}
+
+func (re *GoRegexp) IsCasefold() bool {
+	return re.options&RegexpIgnoreCase != 0
+}
+
+func optionLetters(options RegexpOptions) (on, off string) {
+	for _, option := range []struct {
+		flag   RegexpOptions
+		letter string
+	}{{RegexpMultiline, "m"}, {RegexpIgnoreCase, "i"}, {RegexpExtended, "x"}} {
+		if options&option.flag != 0 {
+			on += option.letter
+		} else {
+			off += option.letter
+		}
+	}
+	return
+}
+
+// ToS embeds the options in the source, as in "(?i-mx:abc)". A source that is
+// already one whole option group is unwrapped first.
+func (re *GoRegexp) ToS() string {
+	source, options := re.source, re.options
+	if inner, on, off, ok := splitOptionGroup(source); ok {
+		source = inner
+		options = options&^off | on
+	}
+	on, off := optionLetters(options)
+	if off != "" {
+		off = "-" + off
+	}
+	return "(?" + on + off + ":" + source + ")"
+}
+
+func (re *GoRegexp) Inspect() string {
+	on, _ := optionLetters(re.options)
+	return inspectRegexpSource(re.source) + on
+}
+
+// inspectRegexpSource wraps source in slashes, escaping the unescaped ones.
+func inspectRegexpSource(source string) string {
+	var buf strings.Builder
+	buf.WriteByte('/')
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		if c == '\\' && i+1 < len(source) {
+			buf.WriteString(source[i : i+2])
+			i++
+			continue
+		}
+		if c == '/' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('/')
+	return buf.String()
+}
+
+func (re *GoRegexp) String() string {
+	return re.ToS()
+}
+
+// FindAllStringSubmatchIndex advances as Ruby's scan does, so unlike Go an
+// empty match may directly follow a non-empty one.
+func (re *GoRegexp) FindAllStringSubmatchIndex(s string, n int) [][]int {
+	return findAll(re, s, n)
+}
+
+func (re *GoRegexp) matchFrom(s string, pos int) []int {
+	return goMatchFrom(re.Regexp, s, pos)
+}
+
+func (re *GoRegexp) matchAt(s string, pos int) []int {
+	return goMatchAt(re.Regexp, s, pos)
+}
+
+// goContext holds a Go expression behind one leading character of context,
+// unanchored and anchored, and the expression anchored alone.
+type goContext struct {
+	from, at, start *regexp.Regexp
+}
+
+// goContexts caches a *goContext per Go expression.
+var goContexts sync.Map
+
+func contextOf(re *regexp.Regexp) *goContext {
+	expr := re.String()
+	if context, ok := goContexts.Load(expr); ok {
+		return context.(*goContext)
+	}
+	context, _ := goContexts.LoadOrStore(expr, &goContext{
+		from:  regexp.MustCompile(`(?s:.)(` + expr + `)`),
+		at:    regexp.MustCompile(`\A(?s:.)(` + expr + `)`),
+		start: regexp.MustCompile(`\A(` + expr + `)`),
+	})
+	return context.(*goContext)
+}
+
+// goMatchFrom finds the first match of re at or after pos. Go's regexp cannot
+// start in the middle of a string, so the search runs from the character
+// before pos with that character consumed by the pattern, which lets ^, \b
+// and \B see it.
+func goMatchFrom(re *regexp.Regexp, s string, pos int) []int {
+	if pos == 0 {
+		return re.FindStringSubmatchIndex(s)
+	}
+	return contextMatch(contextOf(re).from, s, pos)
+}
+
+func goMatchesFrom(re *regexp.Regexp, s string, pos int) bool {
+	if pos == 0 {
+		return re.MatchString(s)
+	}
+	_, width := utf8.DecodeLastRuneInString(s[:pos])
+	return contextOf(re).from.MatchString(s[pos-width:])
+}
+
+// goMatchAt matches re anchored at pos, seeing the character before pos as
+// goMatchFrom does.
+func goMatchAt(re *regexp.Regexp, s string, pos int) []int {
+	if pos == 0 {
+		return contextMatch(contextOf(re).start, s, 0)
+	}
+	return contextMatch(contextOf(re).at, s, pos)
+}
+
+// contextMatch runs a context expression from the character before pos and
+// drops its leading character from the match.
+func contextMatch(context *regexp.Regexp, s string, pos int) []int {
+	_, width := utf8.DecodeLastRuneInString(s[:pos])
+	start := pos - width
+	index := context.FindStringSubmatchIndex(s[start:])
+	if index == nil {
+		return nil
+	}
+	index = index[2:]
+	for i := range index {
+		if index[i] >= 0 {
+			index[i] += start
+		}
+	}
+	return index
+}
+
+// splitOptionGroup recognizes a source of the form "(?mi-x:...)" whose group
+// spans the whole source.
+func splitOptionGroup(source string) (inner string, on, off RegexpOptions, ok bool) {
+	if !strings.HasPrefix(source, "(?") || !strings.HasSuffix(source, ")") {
+		return
+	}
+	i, negate := 2, false
+	for ; i < len(source); i++ {
+		var flag RegexpOptions
+		switch source[i] {
+		case 'm':
+			flag = RegexpMultiline
+		case 'i':
+			flag = RegexpIgnoreCase
+		case 'x':
+			flag = RegexpExtended
+		case '-':
+			if negate {
+				return
+			}
+			negate = true
+			continue
+		case ':':
+			inner = source[i+1 : len(source)-1]
+			depth := 0
+			for j := 0; j < len(inner); j++ {
+				switch inner[j] {
+				case '\\':
+					j++
+				case '(':
+					depth++
+				case ')':
+					if depth--; depth < 0 {
+						return "", 0, 0, false
+					}
+				}
+			}
+			return inner, on, off, depth == 0
+		default:
+			return
+		}
+		if negate {
+			off |= flag
+		} else {
+			on |= flag
+		}
+	}
+	return
+}
+
+type goTranslator struct {
+	reParser
+	out      strings.Builder
+	noGroups bool
+	sawNamed bool
+}
+
+func translateRegexp(source string, options RegexpOptions) (expr string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			syntaxErr, ok := e.(reSyntaxError)
+			if !ok {
+				panic(e)
+			}
+			expr, err = "", RegexpError{syntaxErr.message + ": /" + source + "/"}
+		}
+	}()
+
+	translate := func(noGroups bool) *goTranslator {
+		t := &goTranslator{reParser: reParser{src: source}, noGroups: noGroups}
+		if options&RegexpExtended != 0 {
+			t.flags |= reExtended
+		}
+		t.out.WriteString("(?m")
+		if options&RegexpIgnoreCase != 0 {
+			t.out.WriteString("i")
+		}
+		if options&RegexpMultiline != 0 {
+			t.out.WriteString("s")
+		}
+		t.out.WriteString(")")
+		t.translate(0)
+		return t
+	}
+	t := translate(false)
+	if t.sawNamed {
+		// like Ruby, plain groups stop capturing once a named group is present
+		t = translate(true)
+	}
+	return t.out.String(), nil
+}
+
+func (t *goTranslator) unsupported(what string) {
+	t.fail(what + " is not supported by Go regexp")
+}
+
+func (t *goTranslator) writeRune(r rune) {
+	t.out.WriteString(`\x{` + strconv.FormatInt(int64(r), 16) + `}`)
+}
+
+func (t *goTranslator) translate(depth int) {
+	for {
+		t.skipExtended()
+		if !t.more() {
+			if depth > 0 {
+				t.fail("end pattern with unmatched parenthesis")
+			}
+			return
+		}
+		c := t.next()
+		switch c {
+		case ')':
+			if depth == 0 {
+				t.fail("unmatched close parenthesis")
+			}
+			return
+		case '(':
+			t.group(depth)
+		case '[':
+			t.out.WriteByte('[')
+			t.class()
+		case '\\':
+			t.escape()
+		case '*', '+', '?':
+			t.out.WriteRune(c)
+			t.quantifierSuffix(false)
+		case '{':
+			min, max, size := parseInterval(t.src[t.pos-1:])
+			if size == 0 {
+				t.out.WriteString(`\{`)
+				continue
+			}
+			t.pos += size - 1
+			t.out.WriteString("{" + strconv.Itoa(min))
+			if max != min {
+				t.out.WriteByte(',')
+				if max >= 0 {
+					t.out.WriteString(strconv.Itoa(max))
+				}
+			}
+			t.out.WriteByte('}')
+			t.quantifierSuffix(true)
+		default:
+			t.out.WriteRune(c)
+		}
+	}
+}
+
+func (t *goTranslator) quantifierSuffix(interval bool) {
+	if t.consume("?") {
+		t.out.WriteByte('?')
+	} else if t.more() && t.peek() == '+' {
+		if interval {
+			t.unsupported("nested repetition")
+		}
+		t.unsupported("possessive quantifier")
+	}
+}
+
+func (t *goTranslator) body(depth int) {
+	saved := t.flags
+	t.translate(depth + 1)
+	t.flags = saved
+	t.out.WriteByte(')')
+}
+
+func (t *goTranslator) group(depth int) {
+	if !t.consume("?") {
+		if t.noGroups {
+			t.out.WriteString("(?:")
+		} else {
+			t.out.WriteByte('(')
+		}
+		t.body(depth)
+		return
+	}
+	switch {
+	case t.consume("#"):
+		end := strings.IndexByte(t.src[t.pos:], ')')
+		if end < 0 {
+			t.fail("end pattern in group")
+		}
+		t.pos += end + 1
+	case t.consume(":"):
+		t.out.WriteString("(?:")
+		t.body(depth)
+	case t.consume("!)"):
+		// the empty negative lookahead never matches
+		t.out.WriteString(`[^\x00-\x{10FFFF}]`)
+	case t.consume("="), t.consume("!"):
+		t.unsupported("lookahead")
+	case t.consume("<="), t.consume("<!"):
+		t.unsupported("lookbehind")
+	case t.consume(">"):
+		t.unsupported("atomic group")
+	case t.consume("~"):
+		t.unsupported("absent operator")
+	case t.consume("("):
+		t.unsupported("conditional")
+	case t.consume("<"), t.consume("'"):
+		close := byte('>')
+		if t.src[t.pos-1] == '\'' {
+			close = '\''
+		}
+		name := t.groupName(close)
+		if !isGroupName(name) {
+			t.fail("invalid group name <" + name + ">")
+		}
+		t.sawNamed = true
+		t.out.WriteString("(?P<" + name + ">")
+		t.body(depth)
+	default:
+		t.options(depth)
+	}
+}
+
+func (t *goTranslator) options(depth int) {
+	var on, off string
+	flags, negate := t.flags, false
+	for t.more() {
+		c := t.next()
+		switch c {
+		case 'i', 'm':
+			letter := "i"
+			if c == 'm' {
+				letter = "s"
+			}
+			if negate {
+				off += letter
+			} else {
+				on += letter
+			}
+		case 'x':
+			if negate {
+				flags &^= reExtended
+			} else {
+				flags |= reExtended
+			}
+		case '-':
+			if negate {
+				t.fail("undefined group option")
+			}
+			negate = true
+		case ':', ')':
+			if off != "" {
+				off = "-" + off
+			}
+			if c == ':' {
+				t.out.WriteString("(?" + on + off + ":")
+				saved := t.flags
+				t.flags = flags
+				t.body(depth)
+				t.flags = saved
+			} else {
+				if on+off != "" {
+					t.out.WriteString("(?" + on + off + ")")
+				}
+				t.flags = flags
+			}
+			return
+		default:
+			t.fail("undefined group option")
+		}
+	}
+	t.fail("end pattern in group")
+}
+
+var goPropertyClasses = map[string]string{
+	"alpha":  `\p{L}\p{M}\p{Nl}`,
+	"alnum":  `\p{L}\p{M}\p{Nl}\p{Nd}`,
+	"ascii":  `\x00-\x7F`,
+	"any":    `\x00-\x{10FFFF}`,
+	"blank":  `\t\p{Zs}`,
+	"cntrl":  `\p{Cc}`,
+	"digit":  `\p{Nd}`,
+	"lower":  `\p{Ll}`,
+	"punct":  `\p{P}`,
+	"space":  `\t\n\v\f\r\x{85}\p{Z}`,
+	"upper":  `\p{Lu}`,
+	"word":   `\p{L}\p{M}\p{Nd}\p{Pc}`,
+	"xdigit": `0-9a-fA-F`,
+}
+
+// property translates \p{...} either into one of Go's property names or into
+// the body of a character class.
+func (t *goTranslator) property(negate, inClass bool) {
+	if !t.consume("{") {
+		t.fail("invalid character property name {" + string(t.peek()) + "}")
+	}
+	end := strings.IndexByte(t.src[t.pos:], '}')
+	if end < 0 {
+		t.fail("invalid character property name {" + t.src[t.pos:] + "}")
+	}
+	name := t.src[t.pos : t.pos+end]
+	t.pos += end + 1
+	if strings.HasPrefix(name, "^") {
+		negate = !negate
+		name = name[1:]
+	}
+	key := normalizePropertyName(name)
+
+	goName := ""
+	for long, short := range categoryNames {
+		if normalizePropertyName(long) == key {
+			goName = short
+		}
+	}
+	for _, tables := range []map[string]*unicode.RangeTable{unicode.Categories, unicode.Scripts} {
+		for n := range tables {
+			if normalizePropertyName(n) == key {
+				goName = n
+			}
+		}
+	}
+	if goName != "" {
+		if negate {
+			t.out.WriteString(`\P{` + goName + `}`)
+		} else {
+			t.out.WriteString(`\p{` + goName + `}`)
+		}
+		return
+	}
+
+	class, ok := goPropertyClasses[key]
+	if !ok {
+		t.fail("invalid character property name {" + name + "}")
+	}
+	switch {
+	case !inClass && negate:
+		t.out.WriteString("[^" + class + "]")
+	case !inClass:
+		t.out.WriteString("[" + class + "]")
+	case negate:
+		t.unsupported("negated property {" + name + "} in a character class")
+	default:
+		t.out.WriteString(class)
+	}
+}
+
+func (t *goTranslator) charEscape(c rune, inClass bool) {
+	for _, r := range t.parseCharEscape(c, inClass) {
+		switch {
+		case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' '):
+			t.out.WriteRune(r)
+		case r < 0x80 && unicode.IsPrint(r):
+			t.out.WriteByte('\\')
+			t.out.WriteRune(r)
+		default:
+			t.writeRune(r)
+		}
+	}
+}
+
+func (t *goTranslator) escape() {
+	if !t.more() {
+		t.fail("end pattern at escape")
+	}
+	c := t.next()
+	switch c {
+	case 'A', 'z', 'b', 'B', 'd', 'D', 'w', 'W':
+		t.out.WriteString(`\` + string(c))
+	case 's':
+		t.out.WriteString(`[\t\n\v\f\r ]`)
+	case 'S':
+		t.out.WriteString(`[^\t\n\v\f\r ]`)
+	case 'h':
+		t.out.WriteString(`[0-9a-fA-F]`)
+	case 'H':
+		t.out.WriteString(`[^0-9a-fA-F]`)
+	case 'R':
+		t.out.WriteString(`(?:\r\n|[\n\v\f\r\x{85}\x{2028}\x{2029}])`)
+	case 'p', 'P':
+		t.property(c == 'P', false)
+	case 'Z':
+		t.unsupported(`\Z`)
+	case 'G':
+		t.unsupported(`\G`)
+	case 'K':
+		t.unsupported(`\K`)
+	case 'X':
+		t.unsupported(`\X`)
+	case 'g':
+		t.unsupported("subexpression call")
+	case 'k', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		t.unsupported("backreference")
+	default:
+		t.charEscape(c, false)
+	}
+}
+
+func (t *goTranslator) class() {
+	if t.consume("^") {
+		t.out.WriteByte('^')
+	}
+	for first := true; ; first = false {
+		if !t.more() {
+			t.fail("premature end of char-class")
+		}
+		if t.src[t.pos] == ']' {
+			t.pos++
+			if first {
+				t.out.WriteString(`\]`)
+				continue
+			}
+			t.out.WriteByte(']')
+			return
+		}
+		if strings.HasPrefix(t.src[t.pos:], "&&") {
+			t.unsupported("character class intersection")
+		}
+		if strings.HasPrefix(t.src[t.pos:], "[:") {
+			if end := strings.Index(t.src[t.pos:], ":]"); end >= 0 {
+				t.out.WriteString(t.src[t.pos : t.pos+end+2])
+				t.pos += end + 2
+				continue
+			}
+		}
+		c := t.next()
+		switch c {
+		case '[':
+			t.unsupported("nested character class")
+		case '\\':
+			if !t.more() {
+				t.fail("end pattern at escape")
+			}
+			switch e := t.next(); e {
+			case 'd', 'D', 'w', 'W':
+				t.out.WriteString(`\` + string(e))
+			case 's':
+				t.out.WriteString(`\t\n\v\f\r `)
+			case 'S':
+				t.out.WriteString(`\x00-\x08\x0E-\x1F\x21-\x{10FFFF}`)
+			case 'h':
+				t.out.WriteString(`0-9a-fA-F`)
+			case 'H':
+				t.out.WriteString(`\x00-\x2F\x3A-\x40\x47-\x60\x67-\x{10FFFF}`)
+			case 'p', 'P':
+				t.property(e == 'P', true)
+			default:
+				t.charEscape(e, true)
+			}
+		default:
+			t.out.WriteRune(c)
+		}
+	}
+}
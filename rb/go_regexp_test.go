@@ -0,0 +1,124 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoRegexp_Match(t *testing.T) {
+	tests := []struct {
+		source   string
+		options  RegexpOptions
+		input    string
+		expected []string
+	}{
+		{`^b`, 0, "a\nb", []string{"b"}},
+		{`a$`, 0, "a\nb", []string{"a"}},
+		{`a.b`, 0, "a\nb", nil},
+		{`a.b`, RegexpMultiline, "a\nb", []string{"a\nb"}},
+		{`(?m:a.b)`, 0, "a\nb", []string{"a\nb"}},
+		{`hello`, RegexpIgnoreCase, "say HeLLo", []string{"HeLLo"}},
+		{`a \s+ b # trailing comment`, RegexpExtended, "a   b", []string{"a   b"}},
+		{`(?x: a b )c`, 0, "ab c abc", []string{"abc"}},
+		{`a\ b`, RegexpExtended, "a b", []string{"a b"}},
+		{`[ ]b`, RegexpExtended, "a b", []string{" b"}},
+		{`\h+`, 0, "zz1fz", []string{"1f"}},
+		{`[\h\s]+`, 0, "zz1 fz", []string{"1 f"}},
+		{`\s`, 0, "a\vb", []string{"\v"}},
+		{`a{,2}b`, 0, "aaab", []string{"aab"}},
+		{`x{a}`, 0, "x{a}", []string{"x{a}"}},
+		{`\p{greek}+`, 0, "abc αβγ", []string{"αβγ"}},
+		{`\p{Alpha}+`, 0, "123héllo", []string{"héllo"}},
+		{`\P{Alpha}+`, 0, "héllo123", []string{"123"}},
+		{`\u{48 49}\x21`, 0, "HI!", []string{"HI!"}},
+		{`\xE3\x81\x82`, 0, "あ", []string{"あ"}},
+		{`\R`, 0, "a\r\nb", []string{"\r\n"}},
+		{`(?<y>\d+)-(\d+)`, 0, "2024-10", []string{"2024-10", "2024"}},
+		{`(?#comment)a`, 0, "a", []string{"a"}},
+	}
+	for _, test := range tests {
+		re, err := CompileGoRegexp(test.source, test.options)
+		if !assert.Nil(t, err, "/%s/", test.source) {
+			continue
+		}
+		index := re.FindStringSubmatchIndex(test.input)
+		if test.expected == nil {
+			assert.Nil(t, index, "/%s/ =~ %q", test.source, test.input)
+			continue
+		}
+		if !assert.NotNil(t, index, "/%s/ =~ %q", test.source, test.input) {
+			continue
+		}
+		groups := make([]string, len(index)/2)
+		for i := range groups {
+			if index[2*i] >= 0 {
+				groups[i] = test.input[index[2*i]:index[2*i+1]]
+			}
+		}
+		assert.Equal(t, test.expected, groups, "/%s/ =~ %q", test.source, test.input)
+	}
+
+	assert.Equal(t, [][]int{{0, 0}, {1, 4}, {4, 4}}, MustCompileGoRegexp(`a*`, 0).FindAllStringSubmatchIndex("baaa", -1), "empty match after a match")
+	assert.Equal(t, [][]int{{0, 0}}, MustCompileGoRegexp(`a*`, 0).FindAllStringSubmatchIndex("baaa", 1), "limit")
+}
+
+func TestGoRegexp_Errors(t *testing.T) {
+	tests := []struct {
+		source, message string
+	}{
+		{`a(?=b)`, "lookahead is not supported by Go regexp: /a(?=b)/"},
+		{`(?<=a)b`, "lookbehind is not supported by Go regexp: /(?<=a)b/"},
+		{`(a)\1`, `backreference is not supported by Go regexp: /(a)\1/`},
+		{`a++`, "possessive quantifier is not supported by Go regexp: /a++/"},
+		{`[a-z&&[^a]]`, "character class intersection is not supported by Go regexp: /[a-z&&[^a]]/"},
+		{`(a`, "end pattern with unmatched parenthesis: /(a/"},
+		{`a)`, "unmatched close parenthesis: /a)/"},
+		{`\p{Foo}`, `invalid character property name {Foo}: /\p{Foo}/`},
+	}
+	for _, test := range tests {
+		_, err := CompileGoRegexp(test.source, 0)
+		assert.Equal(t, RegexpError{test.message}, err, "/%s/", test.source)
+	}
+}
+
+func TestGoRegexp_ToS(t *testing.T) {
+	re := MustCompileGoRegexp("ab", RegexpIgnoreCase|RegexpMultiline)
+	assert.Equal(t, "ab", re.Source(), "Source")
+	assert.Equal(t, RegexpIgnoreCase|RegexpMultiline, re.Options(), "Options")
+	assert.True(t, re.IsCasefold(), "IsCasefold")
+	assert.Equal(t, "(?mi-x:ab)", re.ToS(), "ToS")
+	assert.Equal(t, "/ab/mi", re.Inspect(), "Inspect")
+
+	assert.Equal(t, "(?-mix:ab)", MustCompileGoRegexp("ab", 0).ToS(), "ToS without options")
+	assert.Equal(t, "(?i-mx:ab)", MustCompileGoRegexp("(?i:ab)", 0).ToS(), "ToS of an option group")
+	assert.Equal(t, "(?-mix:(?i:a)b)", MustCompileGoRegexp("(?i:a)b", 0).ToS(), "ToS of a partial option group")
+	assert.Equal(t, `/a\/b/x`, MustCompileGoRegexp("a/b", RegexpExtended).Inspect(), "Inspect escapes slashes")
+}
+
+func TestGoRegexp_EscapeUnion(t *testing.T) {
+	assert.Equal(t, `a\.b\*c\n\ d\?`, RegexpEscape(NewString("a.b*c\n d?")).Value, "RegexpEscape")
+
+	re, err := RegexpUnion("a.b", MustCompileGoRegexp("c", RegexpIgnoreCase))
+	assert.Nil(t, err, "RegexpUnion")
+	assert.Equal(t, `a\.b|(?i-mx:c)`, re.Source(), "RegexpUnion source")
+	assert.True(t, re.MatchString("C"), "RegexpUnion keeps options")
+	assert.False(t, re.MatchString("axb"), "RegexpUnion escapes strings")
+
+	re, _ = RegexpUnion()
+	assert.Equal(t, "/(?!)/", re.Inspect(), "empty RegexpUnion")
+	assert.False(t, re.MatchString(""), "empty RegexpUnion never matches")
+
+	single := MustCompileGoRegexp("x", 0)
+	re, _ = RegexpUnion(single)
+	assert.Equal(t, single, re, "RegexpUnion of one regexp")
+}
+
+func TestGoRegexp_String(t *testing.T) {
+	assert.Equal(t, "> foo\n> bar", NewString("foo\nbar").Gsub(MustCompileGoRegexp("^", 0), "> ").Value, "Gsub at line starts")
+	assert.Equal(t, "x", NewString("a\nb").Sub(MustCompileGoRegexp("a.b", RegexpMultiline), "x").Value, "Sub with /m")
+
+	m, ok := NewString("Date: 2024-10").Match(MustCompileGoRegexp(`(?<year>\d+) - (\d+)`, RegexpExtended), 0)
+	assert.True(t, ok, "Match")
+	assert.Equal(t, "2024", *m.NamedCaptures()["year"], "Match named captures")
+	assert.Equal(t, []interface{}{NewString("A"), NewString("a")}, NewString("Aba").Scan(MustCompileGoRegexp("a", RegexpIgnoreCase)), "Scan")
+}
@@ -0,0 +1,391 @@
+package rb
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+type graphemeBreak int
+
+const (
+	gbOther graphemeBreak = iota
+	gbCR
+	gbLF
+	gbControl
+	gbExtend
+	gbZWJ
+	gbRegionalIndicator
+	gbPrepend
+	gbSpacingMark
+	gbL
+	gbV
+	gbT
+	gbLV
+	gbLVT
+)
+
+type WidthMode int
+
+const (
+	WidthChars WidthMode = iota
+	WidthDisplay
+	// WidthDisplayCJK counts East Asian ambiguous characters as wide
+	WidthDisplayCJK
+)
+
+// prependLetters are the Consonant_Preceding_Repha and Consonant_Prefixed
+// letters, which are Prepend besides the prepended concatenation marks.
+var prependLetters = &unicode.RangeTable{
+	R16: []unicode.Range16{{0x0D4E, 0x0D4E, 1}},
+	R32: []unicode.Range32{
+		{0x111C2, 0x111C3, 1}, {0x1193F, 0x11941, 2}, {0x11A3A, 0x11A3A, 1},
+		{0x11A84, 0x11A89, 1}, {0x11D46, 0x11D46, 1}, {0x11F02, 0x11F02, 1},
+	},
+}
+
+// spacingMarkExceptions are the spacing marks UAX #29 leaves as Other.
+var spacingMarkExceptions = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x102B, 0x102C, 1}, {0x1038, 0x1038, 1}, {0x1062, 0x1064, 1}, {0x1067, 0x106D, 1},
+		{0x1083, 0x1083, 1}, {0x1087, 0x108C, 1}, {0x108F, 0x108F, 1}, {0x109A, 0x109C, 1},
+		{0x1A61, 0x1A63, 2}, {0x1A64, 0x1A64, 1}, {0xAA7B, 0xAA7D, 2},
+	},
+	R32: []unicode.Range32{{0x11720, 0x11721, 1}},
+}
+
+// conjunctLinkers and conjunctConsonants are the Indic_Conjunct_Break
+// Linker and Consonant characters.
+var conjunctLinkers = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x094D, 0x094D, 1}, {0x09CD, 0x09CD, 1}, {0x0ACD, 0x0ACD, 1},
+		{0x0B4D, 0x0B4D, 1}, {0x0C4D, 0x0C4D, 1}, {0x0D4D, 0x0D4D, 1},
+	},
+}
+
+var conjunctConsonants = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0915, 0x0939, 1}, {0x0958, 0x095F, 1}, {0x0978, 0x097F, 1}, {0x0995, 0x09A8, 1},
+		{0x09AA, 0x09B0, 1}, {0x09B2, 0x09B2, 1}, {0x09B6, 0x09B9, 1}, {0x09DC, 0x09DD, 1},
+		{0x09DF, 0x09DF, 1}, {0x09F0, 0x09F1, 1}, {0x0A95, 0x0AA8, 1}, {0x0AAA, 0x0AB0, 1},
+		{0x0AB2, 0x0AB3, 1}, {0x0AB5, 0x0AB9, 1}, {0x0AF9, 0x0AF9, 1}, {0x0B15, 0x0B28, 1},
+		{0x0B2A, 0x0B30, 1}, {0x0B32, 0x0B33, 1}, {0x0B35, 0x0B39, 1}, {0x0B5C, 0x0B5D, 1},
+		{0x0B5F, 0x0B5F, 1}, {0x0B71, 0x0B71, 1}, {0x0C15, 0x0C28, 1}, {0x0C2A, 0x0C39, 1},
+		{0x0C58, 0x0C5A, 1}, {0x0D15, 0x0D3A, 1},
+	},
+}
+
+var extendedPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00A9, 0x00A9, 1}, {0x00AE, 0x00AE, 1}, {0x203C, 0x203C, 1}, {0x2049, 0x2049, 1},
+		{0x2122, 0x2122, 1}, {0x2139, 0x2139, 1}, {0x2194, 0x2199, 1}, {0x21A9, 0x21AA, 1},
+		{0x231A, 0x231B, 1}, {0x2328, 0x2328, 1}, {0x2388, 0x2388, 1}, {0x23CF, 0x23CF, 1},
+		{0x23E9, 0x23F3, 1}, {0x23F8, 0x23FA, 1}, {0x24C2, 0x24C2, 1}, {0x25AA, 0x25AB, 1},
+		{0x25B6, 0x25B6, 1}, {0x25C0, 0x25C0, 1}, {0x25FB, 0x25FE, 1}, {0x2600, 0x2605, 1},
+		{0x2607, 0x2612, 1}, {0x2614, 0x2685, 1}, {0x2690, 0x2705, 1}, {0x2708, 0x2712, 1},
+		{0x2714, 0x2714, 1}, {0x2716, 0x2716, 1}, {0x271D, 0x271D, 1}, {0x2721, 0x2721, 1},
+		{0x2728, 0x2728, 1}, {0x2733, 0x2734, 1}, {0x2744, 0x2744, 1}, {0x2747, 0x2747, 1},
+		{0x274C, 0x274C, 1}, {0x274E, 0x274E, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2763, 0x2767, 1}, {0x2795, 0x2797, 1}, {0x27A1, 0x27A1, 1}, {0x27B0, 0x27B0, 1},
+		{0x27BF, 0x27BF, 1}, {0x2934, 0x2935, 1}, {0x2B05, 0x2B07, 1}, {0x2B1B, 0x2B1C, 1},
+		{0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1}, {0x3030, 0x3030, 1}, {0x303D, 0x303D, 1},
+		{0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F000, 0x1F0FF, 1}, {0x1F10D, 0x1F10F, 1}, {0x1F12F, 0x1F12F, 1},
+		{0x1F16C, 0x1F171, 1}, {0x1F17E, 0x1F17F, 1}, {0x1F18E, 0x1F18E, 1},
+		{0x1F191, 0x1F19A, 1}, {0x1F1AD, 0x1F1E5, 1}, {0x1F201, 0x1F20F, 1},
+		{0x1F21A, 0x1F21A, 1}, {0x1F22F, 0x1F22F, 1}, {0x1F232, 0x1F23A, 1},
+		{0x1F23C, 0x1F23F, 1}, {0x1F249, 0x1F3FA, 1}, {0x1F400, 0x1F53D, 1},
+		{0x1F546, 0x1F64F, 1}, {0x1F680, 0x1F6FF, 1}, {0x1F774, 0x1F77F, 1},
+		{0x1F7D5, 0x1F7FF, 1}, {0x1F80C, 0x1F80F, 1}, {0x1F848, 0x1F84F, 1},
+		{0x1F85A, 0x1F85F, 1}, {0x1F888, 0x1F88F, 1}, {0x1F8AE, 0x1F8FF, 1},
+		{0x1F90C, 0x1F93A, 1}, {0x1F93C, 0x1F945, 1}, {0x1F947, 0x1FAFF, 1},
+		{0x1FC00, 0x1FFFD, 1},
+	},
+}
+
+// eastAsianWide holds the East Asian Width W and F characters.
+var eastAsianWide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115F, 1}, {0x231A, 0x231B, 1}, {0x2329, 0x232A, 1}, {0x23E9, 0x23EC, 1},
+		{0x23F0, 0x23F0, 1}, {0x23F3, 0x23F3, 1}, {0x25FD, 0x25FE, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267F, 0x267F, 1}, {0x2693, 0x2693, 1}, {0x26A1, 0x26A1, 1},
+		{0x26AA, 0x26AB, 1}, {0x26BD, 0x26BE, 1}, {0x26C4, 0x26C5, 1}, {0x26CE, 0x26CE, 1},
+		{0x26D4, 0x26D4, 1}, {0x26EA, 0x26EA, 1}, {0x26F2, 0x26F3, 1}, {0x26F5, 0x26F5, 1},
+		{0x26FA, 0x26FA, 1}, {0x26FD, 0x26FD, 1}, {0x2705, 0x2705, 1}, {0x270A, 0x270B, 1},
+		{0x2728, 0x2728, 1}, {0x274C, 0x274C, 1}, {0x274E, 0x274E, 1}, {0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1}, {0x2795, 0x2797, 1}, {0x27B0, 0x27B0, 1}, {0x27BF, 0x27BF, 1},
+		{0x2B1B, 0x2B1C, 1}, {0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1}, {0x2E80, 0x303E, 1},
+		{0x3041, 0x3247, 1}, {0x3250, 0x4DBF, 1}, {0x4E00, 0xA4C6, 1}, {0xA960, 0xA97C, 1},
+		{0xAC00, 0xD7A3, 1}, {0xF900, 0xFAD9, 1}, {0xFE10, 0xFE19, 1}, {0xFE30, 0xFE6B, 1},
+		{0xFF01, 0xFF60, 1}, {0xFFE0, 0xFFE6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16FE0, 0x1B2FB, 1}, {0x1F004, 0x1F004, 1}, {0x1F0CF, 0x1F0CF, 1},
+		{0x1F18E, 0x1F18E, 1}, {0x1F191, 0x1F19A, 1}, {0x1F200, 0x1F320, 1},
+		{0x1F32D, 0x1F335, 1}, {0x1F337, 0x1F37C, 1}, {0x1F37E, 0x1F393, 1},
+		{0x1F3A0, 0x1F3CA, 1}, {0x1F3CF, 0x1F3D3, 1}, {0x1F3E0, 0x1F3F0, 1},
+		{0x1F3F4, 0x1F3F4, 1}, {0x1F3F8, 0x1F43E, 1}, {0x1F440, 0x1F440, 1},
+		{0x1F442, 0x1F4FC, 1}, {0x1F4FF, 0x1F53D, 1}, {0x1F54B, 0x1F54E, 1},
+		{0x1F550, 0x1F567, 1}, {0x1F57A, 0x1F57A, 1}, {0x1F595, 0x1F596, 1},
+		{0x1F5A4, 0x1F5A4, 1}, {0x1F5FB, 0x1F64F, 1}, {0x1F680, 0x1F6C5, 1},
+		{0x1F6CC, 0x1F6CC, 1}, {0x1F6D0, 0x1F6D2, 1}, {0x1F6D5, 0x1F6DF, 1},
+		{0x1F6EB, 0x1F6EC, 1}, {0x1F6F4, 0x1F6FC, 1}, {0x1F7E0, 0x1F7F0, 1},
+		{0x1F90C, 0x1F93A, 1}, {0x1F93C, 0x1F945, 1}, {0x1F947, 0x1F9FF, 1},
+		{0x1FA70, 0x1FAFF, 1}, {0x20000, 0x3FFFD, 1},
+	},
+}
+
+// eastAsianAmbiguous holds the East Asian Width A characters, apart from
+// private use ones.
+var eastAsianAmbiguous = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00A1, 0x00A1, 1}, {0x00A4, 0x00A4, 1}, {0x00A7, 0x00A8, 1}, {0x00AA, 0x00AA, 1},
+		{0x00AD, 0x00AE, 1}, {0x00B0, 0x00B4, 1}, {0x00B6, 0x00BA, 1}, {0x00BC, 0x00BF, 1},
+		{0x00C6, 0x00C6, 1}, {0x00D0, 0x00D0, 1}, {0x00D7, 0x00D8, 1}, {0x00DE, 0x00E1, 1},
+		{0x00E6, 0x00E6, 1}, {0x00E8, 0x00EA, 1}, {0x00EC, 0x00ED, 1}, {0x00F0, 0x00F0, 1},
+		{0x00F2, 0x00F3, 1}, {0x00F7, 0x00FA, 1}, {0x00FC, 0x00FC, 1}, {0x00FE, 0x00FE, 1},
+		{0x0101, 0x0101, 1}, {0x0111, 0x0111, 1}, {0x0113, 0x0113, 1}, {0x011B, 0x011B, 1},
+		{0x0126, 0x0127, 1}, {0x012B, 0x012B, 1}, {0x0131, 0x0133, 1}, {0x0138, 0x0138, 1},
+		{0x013F, 0x0142, 1}, {0x0144, 0x0144, 1}, {0x0148, 0x014B, 1}, {0x014D, 0x014D, 1},
+		{0x0152, 0x0153, 1}, {0x0166, 0x0167, 1}, {0x016B, 0x016B, 1}, {0x01CE, 0x01CE, 1},
+		{0x01D0, 0x01D0, 1}, {0x01D2, 0x01D2, 1}, {0x01D4, 0x01D4, 1}, {0x01D6, 0x01D6, 1},
+		{0x01D8, 0x01D8, 1}, {0x01DA, 0x01DA, 1}, {0x01DC, 0x01DC, 1}, {0x0251, 0x0251, 1},
+		{0x0261, 0x0261, 1}, {0x02C4, 0x02C4, 1}, {0x02C7, 0x02C7, 1}, {0x02C9, 0x02CB, 1},
+		{0x02CD, 0x02CD, 1}, {0x02D0, 0x02D0, 1}, {0x02D8, 0x02DB, 1}, {0x02DD, 0x02DD, 1},
+		{0x02DF, 0x02DF, 1}, {0x0300, 0x036F, 1}, {0x0391, 0x03A9, 1}, {0x03B1, 0x03C1, 1},
+		{0x03C3, 0x03C9, 1}, {0x0401, 0x0401, 1}, {0x0410, 0x044F, 1}, {0x0451, 0x0451, 1},
+		{0x2010, 0x2010, 1}, {0x2013, 0x2016, 1}, {0x2018, 0x2019, 1}, {0x201C, 0x201D, 1},
+		{0x2020, 0x2022, 1}, {0x2024, 0x2027, 1}, {0x2030, 0x2030, 1}, {0x2032, 0x2033, 1},
+		{0x2035, 0x2035, 1}, {0x203B, 0x203B, 1}, {0x203E, 0x203E, 1}, {0x2074, 0x2074, 1},
+		{0x207F, 0x207F, 1}, {0x2081, 0x2084, 1}, {0x20AC, 0x20AC, 1}, {0x2103, 0x2103, 1},
+		{0x2105, 0x2105, 1}, {0x2109, 0x2109, 1}, {0x2113, 0x2113, 1}, {0x2116, 0x2116, 1},
+		{0x2121, 0x2122, 1}, {0x2126, 0x2126, 1}, {0x212B, 0x212B, 1}, {0x2153, 0x2154, 1},
+		{0x215B, 0x215E, 1}, {0x2160, 0x216B, 1}, {0x2170, 0x2179, 1}, {0x2189, 0x2189, 1},
+		{0x2190, 0x2199, 1}, {0x21B8, 0x21B9, 1}, {0x21D2, 0x21D2, 1}, {0x21D4, 0x21D4, 1},
+		{0x21E7, 0x21E7, 1}, {0x2200, 0x2200, 1}, {0x2202, 0x2203, 1}, {0x2207, 0x2208, 1},
+		{0x220B, 0x220B, 1}, {0x220F, 0x220F, 1}, {0x2211, 0x2211, 1}, {0x2215, 0x2215, 1},
+		{0x221A, 0x221A, 1}, {0x221D, 0x2220, 1}, {0x2223, 0x2223, 1}, {0x2225, 0x2225, 1},
+		{0x2227, 0x222C, 1}, {0x222E, 0x222E, 1}, {0x2234, 0x2237, 1}, {0x223C, 0x223D, 1},
+		{0x2248, 0x2248, 1}, {0x224C, 0x224C, 1}, {0x2252, 0x2252, 1}, {0x2260, 0x2261, 1},
+		{0x2264, 0x2267, 1}, {0x226A, 0x226B, 1}, {0x226E, 0x226F, 1}, {0x2282, 0x2283, 1},
+		{0x2286, 0x2287, 1}, {0x2295, 0x2295, 1}, {0x2299, 0x2299, 1}, {0x22A5, 0x22A5, 1},
+		{0x22BF, 0x22BF, 1}, {0x2312, 0x2312, 1}, {0x2460, 0x24E9, 1}, {0x24EB, 0x254B, 1},
+		{0x2550, 0x2573, 1}, {0x2580, 0x258F, 1}, {0x2592, 0x2595, 1}, {0x25A0, 0x25A1, 1},
+		{0x25A3, 0x25A9, 1}, {0x25B2, 0x25B3, 1}, {0x25B6, 0x25B7, 1}, {0x25BC, 0x25BD, 1},
+		{0x25C0, 0x25C1, 1}, {0x25C6, 0x25C8, 1}, {0x25CB, 0x25CB, 1}, {0x25CE, 0x25D1, 1},
+		{0x25E2, 0x25E5, 1}, {0x25EF, 0x25EF, 1}, {0x2605, 0x2606, 1}, {0x2609, 0x2609, 1},
+		{0x260E, 0x260F, 1}, {0x261C, 0x261C, 1}, {0x261E, 0x261E, 1}, {0x2640, 0x2640, 1},
+		{0x2642, 0x2642, 1}, {0x2660, 0x2661, 1}, {0x2663, 0x2665, 1}, {0x2667, 0x266A, 1},
+		{0x266C, 0x266D, 1}, {0x266F, 0x266F, 1}, {0x269E, 0x269F, 1}, {0x26BF, 0x26BF, 1},
+		{0x26C6, 0x26CD, 1}, {0x26CF, 0x26D3, 1}, {0x26D5, 0x26E1, 1}, {0x26E3, 0x26E3, 1},
+		{0x26E8, 0x26E9, 1}, {0x26EB, 0x26F1, 1}, {0x26F4, 0x26F4, 1}, {0x26F6, 0x26F9, 1},
+		{0x26FB, 0x26FC, 1}, {0x26FE, 0x26FF, 1}, {0x273D, 0x273D, 1}, {0x2776, 0x277F, 1},
+		{0x2B56, 0x2B59, 1}, {0x3248, 0x324F, 1}, {0xFE00, 0xFE0F, 1}, {0xFFFD, 0xFFFD, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F100, 0x1F10A, 1}, {0x1F110, 0x1F12D, 1}, {0x1F130, 0x1F169, 1},
+		{0x1F170, 0x1F18D, 1}, {0x1F18F, 0x1F190, 1}, {0x1F19B, 0x1F1AC, 1},
+		{0xE0100, 0xE01EF, 1},
+	},
+}
+
+func graphemeBreakOf(r rune) graphemeBreak {
+	switch {
+	case r == '\r':
+		return gbCR
+	case r == '\n':
+		return gbLF
+	case r == 0x200D:
+		return gbZWJ
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gbRegionalIndicator
+	case r >= hangulSBase && r < hangulSBase+hangulSCount:
+		if (r-hangulSBase)%hangulTCount == 0 {
+			return gbLV
+		}
+		return gbLVT
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gbL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gbV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gbT
+	case unicode.In(r, unicode.Prepended_Concatenation_Mark, prependLetters):
+		return gbPrepend
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Other_Grapheme_Extend), r >= 0x1F3FB && r <= 0x1F3FF:
+		return gbExtend
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp),
+		unicode.Is(unicode.Other_Default_Ignorable_Code_Point, r) && !isAssigned(r):
+		return gbControl
+	case r == 0x0E33, r == 0x0EB3, unicode.Is(unicode.Mc, r) && !unicode.Is(spacingMarkExceptions, r):
+		return gbSpacingMark
+	}
+	return gbOther
+}
+
+// graphemeSegmenter follows the UAX #29 rules for extended grapheme clusters,
+// one character at a time.
+type graphemeSegmenter struct {
+	prev     graphemeBreak
+	started  bool
+	regional int  // regional indicators in a row
+	emoji    bool // after Extended_Pictographic Extend*
+	emojiZWJ bool // after Extended_Pictographic Extend* ZWJ
+	conjunct int  // 1 after an Indic consonant, 2 once a linker follows it
+}
+
+// next reports whether a cluster boundary comes before r.
+func (g *graphemeSegmenter) next(r rune, gb graphemeBreak) bool {
+	prev := g.prev
+	boundary := g.started
+	switch {
+	case !g.started:
+	case prev == gbCR && gb == gbLF:
+		boundary = false
+	case prev == gbCR || prev == gbLF || prev == gbControl || gb == gbCR || gb == gbLF || gb == gbControl:
+	case prev == gbL && (gb == gbL || gb == gbV || gb == gbLV || gb == gbLVT),
+		(prev == gbLV || prev == gbV) && (gb == gbV || gb == gbT),
+		(prev == gbLVT || prev == gbT) && gb == gbT:
+		boundary = false
+	case gb == gbExtend || gb == gbZWJ || gb == gbSpacingMark || prev == gbPrepend:
+		boundary = false
+	case g.conjunct == 2 && unicode.Is(conjunctConsonants, r):
+		boundary = false
+	case g.emojiZWJ && unicode.Is(extendedPictographic, r):
+		boundary = false
+	case gb == gbRegionalIndicator && g.regional%2 == 1:
+		boundary = false
+	}
+
+	g.prev, g.started = gb, true
+	if gb == gbRegionalIndicator {
+		g.regional++
+	} else {
+		g.regional = 0
+	}
+	g.emojiZWJ = gb == gbZWJ && g.emoji
+	g.emoji = unicode.Is(extendedPictographic, r) || g.emoji && gb == gbExtend
+	switch {
+	case unicode.Is(conjunctConsonants, r):
+		g.conjunct = 1
+	case g.conjunct > 0 && unicode.Is(conjunctLinkers, r):
+		g.conjunct = 2
+	case g.conjunct > 0 && (gb == gbExtend || gb == gbZWJ):
+	default:
+		g.conjunct = 0
+	}
+	return boundary
+}
+
+// eachGraphemeCluster walks the extended grapheme clusters of str along with
+// their characters. Strings in other encodings than Unicode ones, and invalid
+// byte sequences, are split into characters.
+func (str String) eachGraphemeCluster(action func(s string, runes []rune)) {
+	unicodeEncoding := str.Encoding().unicode
+	var g graphemeSegmenter
+	var runes []rune
+	start, end := 0, 0
+	str.eachChar(func(s string, r rune, state int) {
+		gb := gbControl
+		if state == charValid && unicodeEncoding {
+			gb = graphemeBreakOf(r)
+		}
+		if g.next(r, gb) {
+			action(str.Value[start:end], runes)
+			start, runes = end, nil
+		}
+		runes = append(runes, r)
+		end += len(s)
+	})
+	if end > start {
+		action(str.Value[start:end], runes)
+	}
+}
+
+func (str String) EachGraphemeCluster(action func(String)) (ret String) {
+	ret = str
+	defer RecoverBreak("")
+	str.eachGraphemeCluster(func(s string, _ []rune) {
+		action(str.withValue(s))
+	})
+	return
+}
+
+func (str String) GraphemeClusters() []String {
+	var clusters []String
+	str.eachGraphemeCluster(func(s string, _ []rune) {
+		clusters = append(clusters, str.withValue(s))
+	})
+	return clusters
+}
+
+// clusterWidth is the number of terminal columns a grapheme cluster takes,
+// decided by its first character.
+func clusterWidth(runes []rune, mode WidthMode) int {
+	r := runes[0]
+	switch {
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Mn, unicode.Me):
+		return 0
+	case r >= 0x1F1E6 && r <= 0x1F1FF && len(runes) > 1,
+		unicode.Is(eastAsianWide, r),
+		unicode.Is(extendedPictographic, r) && len(runes) > 1 && runes[1] == 0xFE0F:
+		return 2
+	case mode == WidthDisplayCJK && unicode.Is(eastAsianAmbiguous, r):
+		return 2
+	}
+	return 1
+}
+
+// Width measures str in characters or, in a display mode, in terminal
+// columns following East Asian Width.
+func (str String) Width(mode WidthMode) int {
+	if mode == WidthChars {
+		return str.Length()
+	}
+	width := 0
+	str.eachGraphemeCluster(func(_ string, runes []rune) {
+		width += clusterWidth(runes, mode)
+	})
+	return width
+}
+
+func (str String) DisplayWidth() int {
+	return str.Width(WidthDisplay)
+}
+
+// fillToWidth repeats the grapheme clusters of str over width columns. When a
+// wide cluster does not fit in the last column, spaces take its place.
+// WidthChars repeats characters, as fillToLength does.
+func fillToWidth(str String, width int, mode WidthMode) string {
+	if mode == WidthChars {
+		return fillToLength(str, width)
+	}
+	type cluster struct {
+		s     string
+		width int
+	}
+	var clusters []cluster
+	total := 0
+	str.eachGraphemeCluster(func(s string, runes []rune) {
+		w := clusterWidth(runes, mode)
+		clusters = append(clusters, cluster{s, w})
+		total += w
+	})
+	if total == 0 {
+		panic("Zero width padding")
+	}
+	var buf bytes.Buffer
+	for width > 0 {
+		for _, c := range clusters {
+			if c.width > width {
+				buf.WriteString(strings.Repeat(" ", width))
+				return buf.String()
+			}
+			buf.WriteString(c.s)
+			width -= c.width
+		}
+	}
+	return buf.String()
+}
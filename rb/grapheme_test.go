@@ -0,0 +1,75 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_GraphemeClusters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []String
+	}{
+		{"e\u0301x", newStrings("e\u0301", "x")},
+		{"a\r\nb", newStrings("a", "\r\n", "b")},
+		{"\U0001F468\u200D\U0001F469\u200D\U0001F466!", newStrings("\U0001F468\u200D\U0001F469\u200D\U0001F466", "!")},
+		{"\U0001F44D\U0001F3FD", newStrings("\U0001F44D\U0001F3FD")},
+		{"\U0001F1FA\U0001F1F8\U0001F1EF\U0001F1F5\U0001F1EB", newStrings("\U0001F1FA\U0001F1F8", "\U0001F1EF\U0001F1F5", "\U0001F1EB")},
+		{"한글", newStrings("한", "글")},
+		{"क\u094Dष\u093F", newStrings("क\u094Dष\u093F")},
+		{"\u0600a", newStrings("\u0600a")},
+		{"", nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).GraphemeClusters(), "%+q", test.input)
+	}
+
+	latin1 := NewString("e\xb4").ForceEncoding(EncodingISO8859_1)
+	assert.Equal(t, 2, len(latin1.GraphemeClusters()), "non-Unicode encodings split into characters")
+
+	var clusters []String
+	ret := NewString("a\u0301bc").EachGraphemeCluster(func(c String) {
+		if c.Value == "c" {
+			Break()
+		}
+		clusters = append(clusters, c)
+	})
+	assert.Equal(t, newStrings("a\u0301", "b"), clusters, "EachGraphemeCluster with Break")
+	assert.Equal(t, "a\u0301bc", ret.Value, "EachGraphemeCluster returns the receiver")
+}
+
+func TestString_DisplayWidth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"abc", 3},
+		{"中文", 4},
+		{"e\u0301", 1},
+		{"\U0001F468\u200D\U0001F469\u200D\U0001F466", 2},
+		{"\U0001F1EF\U0001F1F5", 2},
+		{"❤\uFE0F", 2},
+		{"❤", 1},
+		{"ＡＢ", 4},
+		{"α", 1},
+		{"a\tb", 2},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).DisplayWidth(), "%+q", test.input)
+	}
+	assert.Equal(t, 2, NewString("α").Width(WidthDisplayCJK), "ambiguous width in CJK mode")
+	assert.Equal(t, 2, NewString("e\u0301").Width(WidthChars), "WidthChars counts characters")
+}
+
+func TestString_PaddingWidth(t *testing.T) {
+	assert.Equal(t, "中文****", NewString("中文").Ljust2(6, NewString("*")).Value, "characters by default")
+	assert.Equal(t, "中文****", NewString("中文").LjustWidth(6, NewString("*"), WidthChars).Value, "WidthChars")
+
+	space := NewString(" ")
+	assert.Equal(t, " 中文 ", NewString("中文").CenterWidth(6, space, WidthDisplay).Value, "Center")
+	assert.Equal(t, "中文**", NewString("中文").LjustWidth(6, NewString("*"), WidthDisplay).Value, "Ljust")
+	assert.Equal(t, "  e\u0301", NewString("e\u0301").RjustWidth(3, space, WidthDisplay).Value, "Rjust")
+	assert.Equal(t, "ab中中 ", NewString("ab").LjustWidth(7, NewString("中"), WidthDisplay).Value, "wide padding")
+	assert.Equal(t, "中文", NewString("中文").RjustWidth(3, space, WidthDisplay).Value, "too wide already")
+	assert.Equal(t, "α ", NewString("α").LjustWidth(3, space, WidthDisplayCJK).Value, "ambiguous width in CJK mode")
+}
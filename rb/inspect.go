@@ -0,0 +1,276 @@
+package rb
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inspecter is implemented by values with a Ruby inspect representation.
+type Inspecter interface {
+	Inspect() string
+}
+
+// Inspect quotes str as Ruby's String#inspect does: printable characters of
+// a UTF-8 string are kept, other characters of Unicode strings get \u
+// escapes and everything else gets \x escapes.
+func (str String) Inspect() string {
+	enc := str.Encoding()
+	s := str.Value
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, width, state := enc.decodeChar(s[i:])
+		if state == charInvalid {
+			for _, b := range []byte(s[i : i+width]) {
+				fmt.Fprintf(&buf, `\x%02X`, b)
+			}
+			i += width
+			continue
+		}
+		i += width
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '#':
+			if enc.asciiCompatible && i < len(s) && strings.IndexByte("{$@", s[i]) >= 0 {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte('#')
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\013':
+			buf.WriteString(`\v`)
+		case '\010':
+			buf.WriteString(`\b`)
+		case '\007':
+			buf.WriteString(`\a`)
+		case '\033':
+			buf.WriteString(`\e`)
+		default:
+			switch {
+			case r >= 0x20 && r < 0x7F || enc == EncodingUTF8 && isPrint(r):
+				buf.WriteRune(r)
+			case enc.unicode && r < 0x10000:
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			case enc.unicode:
+				fmt.Fprintf(&buf, `\u{%X}`, r)
+			default:
+				for _, b := range []byte(s[i-width : i]) {
+					fmt.Fprintf(&buf, `\x%02X`, b)
+				}
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Inspect renders value in Ruby notation. Slices and arrays become arrays,
+// maps become hashes, structs become Ruby structs of their exported fields,
+// and pointers are followed. A value already being rendered is shown as
+// [...], {...} or #<struct Name:...>.
+func Inspect(value interface{}) string {
+	in := inspector{map[visit]bool{}}
+	return in.inspect(reflect.ValueOf(value))
+}
+
+// P prints each value in Ruby notation on its own line, as Ruby's p does,
+// and returns nil, the only value or all of them.
+func P(values ...interface{}) interface{} {
+	for _, value := range values {
+		fmt.Fprintln(os.Stdout, Inspect(value))
+	}
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	}
+	return values
+}
+
+type visit struct {
+	ptr    uintptr
+	typ    reflect.Type
+	length int
+}
+
+type inspector struct {
+	visiting map[visit]bool
+}
+
+// inspectAtom renders nil and the values that know their own notation; it
+// reports false for anything that has to be taken apart.
+func inspectAtom(v reflect.Value) (string, bool) {
+	if !v.IsValid() {
+		return "nil", true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return "nil", true
+		}
+	}
+	if !v.CanInterface() {
+		return "", false
+	}
+	switch value := v.Interface().(type) {
+	case Inspecter:
+		return value.Inspect(), true
+	case string:
+		return NewString(value).Inspect(), true
+	case *big.Int:
+		return value.String(), true
+	case *big.Rat:
+		return "(" + value.String() + ")", true
+	case *regexp.Regexp:
+		return inspectRegexpSource(value.String()), true
+	case error:
+		t := reflect.TypeOf(value)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return "#<" + t.Name() + ": " + value.Error() + ">", true
+	case fmt.Stringer:
+		return value.String(), true
+	}
+	return "", false
+}
+
+func (in inspector) inspect(v reflect.Value) string {
+	if s, ok := inspectAtom(v); ok {
+		return s
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return inspectFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		sign := "+"
+		if math.Signbit(imag(c)) {
+			sign = "-"
+		}
+		return "(" + inspectFloat(real(c)) + sign + inspectFloat(math.Abs(imag(c))) + "i)"
+	case reflect.String:
+		return NewString(v.String()).Inspect()
+	case reflect.Interface:
+		return in.inspect(v.Elem())
+	case reflect.Ptr:
+		key := visit{v.Pointer(), v.Type(), 0}
+		if in.visiting[key] {
+			if v.Elem().Kind() == reflect.Struct {
+				return "#<struct " + v.Elem().Type().Name() + ":...>"
+			}
+			return "..."
+		}
+		in.visiting[key] = true
+		defer delete(in.visiting, key)
+		return in.inspect(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			key := visit{v.Pointer(), v.Type(), v.Len()}
+			if in.visiting[key] {
+				return "[...]"
+			}
+			in.visiting[key] = true
+			defer delete(in.visiting, key)
+		}
+		elements := make([]string, v.Len())
+		for i := range elements {
+			elements[i] = in.inspect(v.Index(i))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case reflect.Map:
+		key := visit{v.Pointer(), v.Type(), 0}
+		if in.visiting[key] {
+			return "{...}"
+		}
+		in.visiting[key] = true
+		defer delete(in.visiting, key)
+		pairs := make([]string, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			pairs = append(pairs, in.inspect(iter.Key())+" => "+in.inspect(iter.Value()))
+		}
+		if len(pairs) == 0 {
+			return "{}"
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case reflect.Struct:
+		var buf strings.Builder
+		buf.WriteString("#<struct ")
+		if name := v.Type().Name(); name != "" {
+			buf.WriteString(name + " ")
+		}
+		fields := make([]string, 0, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				fields = append(fields, field.Name+"="+in.inspect(v.Field(i)))
+			}
+		}
+		buf.WriteString(strings.Join(fields, ", "))
+		return strings.TrimSuffix(buf.String(), " ") + ">"
+	}
+	return "#<" + v.Type().String() + ">"
+}
+
+// inspectFloat formats f as Ruby's Float#inspect does: the shortest
+// representation, with a fraction always shown and an exponent only for
+// very large or very small magnitudes.
+func inspectFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	e := strings.IndexByte(s, 'e')
+	exponent, _ := strconv.Atoi(s[e+1:])
+	digits := strings.Replace(s[:e], ".", "", 1)
+	point := exponent + 1
+	switch {
+	case point > 0 && point <= 16:
+		if len(digits) <= point {
+			return sign + digits + strings.Repeat("0", point-len(digits)) + ".0"
+		}
+		return sign + digits[:point] + "." + digits[point:]
+	case point > -4 && point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits
+	}
+	fraction := digits[1:]
+	if fraction == "" {
+		fraction = "0"
+	}
+	exponentSign := "+"
+	if exponent < 0 {
+		exponentSign, exponent = "-", -exponent
+	}
+	return fmt.Sprintf("%s%c.%se%s%02d", sign, digits[0], fraction, exponentSign, exponent)
+}
@@ -0,0 +1,127 @@
+package rb
+
+import (
+	"testing"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_Inspect(t *testing.T) {
+	tests := []struct {
+		input    String
+		expected string
+	}{
+		{NewString("abc"), `"abc"`},
+		{NewString("a\"b\\c"), `"a\"b\\c"`},
+		{NewString("\n\r\t\f\v\b\a\x1b"), `"\n\r\t\f\v\b\a\e"`},
+		{NewString("\x00\x7f"), `"\u0000\u007F"`},
+		{NewString("#{x} #$y #@z #a"), `"\#{x} \#$y \#@z #a"`},
+		{NewString("héllo 日本"), `"héllo 日本"`},
+		{NewString("​\U0001F600"), `"​` + "\U0001F600" + `"`},
+		{NewString("\u0378"), `"\u0378"`},
+		{NewString("\x3d\xd8\x00\xde").ForceEncoding(EncodingUTF16LE), `"\u{1F600}"`},
+		{NewString("a\xffb"), `"a\xFFb"`},
+		{NewString("é").B(), `"\xC3\xA9"`},
+		{NewString("a\xe9").ForceEncoding(EncodingUTF16LE), `"\uE961"`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.input.Inspect(), "%q.Inspect()", test.input.Value)
+	}
+}
+
+type inspectPoint struct {
+	X, Y   int
+	hidden string
+}
+
+type inspectNode struct {
+	Value int
+	Next  *inspectNode
+}
+
+func TestInspect(t *testing.T) {
+	var nilSlice []int
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{nilSlice, "nil"},
+		{true, "true"},
+		{-42, "-42"},
+		{uint8(200), "200"},
+		{1.0, "1.0"},
+		{0.1, "0.1"},
+		{1e16, "1.0e+16"},
+		{1234567.0, "1234567.0"},
+		{0.0001, "0.0001"},
+		{0.00001, "1.0e-05"},
+		{-2.5e-20, "-2.5e-20"},
+		{math.Inf(-1), "-Infinity"},
+		{math.NaN(), "NaN"},
+		{complex(1, -2), "(1.0-2.0i)"},
+		{"a\nb", `"a\nb"`},
+		{NewString("x"), `"x"`},
+		{big.NewInt(7), "7"},
+		{big.NewRat(3, 4), "(3/4)"},
+		{[]interface{}{1, "a", nil, []int{2}}, `[1, "a", nil, [2]]`},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"b": 2, "a": 1}, `{"a" => 1, "b" => 2}`},
+		{map[string]int{}, "{}"},
+		{inspectPoint{1, 2, "h"}, "#<struct inspectPoint X=1, Y=2>"},
+		{&inspectPoint{3, 4, ""}, "#<struct inspectPoint X=3, Y=4>"},
+		{struct{}{}, "#<struct>"},
+		{IndexError{"index 9 out of string"}, "#<IndexError: index 9 out of string>"},
+		{EncodingUTF8, "#<Encoding:UTF-8>"},
+		{MustCompileGoRegexp("a/b", RegexpIgnoreCase), `/a\/b/i`},
+		{MustCompileRegexp(`a\/b`), `/a\/b/`},
+		{make(chan int), "#<chan int>"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Inspect(test.input), "Inspect(%#v)", test.input)
+	}
+}
+
+func TestInspect_Recursive(t *testing.T) {
+	node := &inspectNode{Value: 1}
+	node.Next = &inspectNode{Value: 2, Next: node}
+	assert.Equal(t, "#<struct inspectNode Value=1, Next=#<struct inspectNode Value=2, Next=#<struct inspectNode:...>>>", Inspect(node), "recursive struct")
+
+	list := []interface{}{1, nil}
+	list[1] = list
+	assert.Equal(t, "[1, [...]]", Inspect(list), "recursive slice")
+
+	hash := map[string]interface{}{}
+	hash["self"] = hash
+	assert.Equal(t, `{"self" => {...}}`, Inspect(hash), "recursive map")
+
+	shared := &inspectNode{Value: 3}
+	assert.Equal(t, "[#<struct inspectNode Value=3, Next=nil>, #<struct inspectNode Value=3, Next=nil>]", Inspect([]*inspectNode{shared, shared}), "shared values are not recursive")
+}
+
+func TestMatchData_Inspect(t *testing.T) {
+	_, m := NewString("xab").OpMatch(MustCompileRegexp(`(a)(b)(c)?`))
+	assert.Equal(t, `#<MatchData "ab" 1:"a" 2:"b" 3:nil>`, m.Inspect(), "numbered groups")
+	_, m = NewString("xab").OpMatch(MustCompileRegexp(`(a)(?<name>b)`))
+	assert.Equal(t, `#<MatchData "ab" name:"b">`, m.Inspect(), "named groups")
+}
+
+func TestP(t *testing.T) {
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	none := P()
+	one := P("a")
+	many := P(1, []int{2})
+	w.Close()
+	os.Stdout = stdout
+	output, _ := io.ReadAll(r)
+
+	assert.Equal(t, "\"a\"\n1\n[2]\n", string(output), "output")
+	assert.Nil(t, none, "P()")
+	assert.Equal(t, "a", one, "P with one value")
+	assert.Equal(t, []interface{}{1, []int{2}}, many, "P with many values")
+}
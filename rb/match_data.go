@@ -1,7 +1,6 @@
 package rb
 
 import (
-	"regexp"
 	"strconv"
 	"reflect"
 	"bytes"
@@ -9,10 +8,23 @@ import (
 
 type MatchData struct {
 	str    string
-	regexp *regexp.Regexp
+	regexp Pattern
 	index  []int
 }
 
+func NewMatchData(str string, re Pattern, index []int) MatchData {
+	return MatchData{str, re, index}
+}
+
+func (m MatchData) group(n int) *string {
+	begin, end := m.index[n*2], m.index[n*2+1]
+	if begin >= 0 {
+		group := m.str[begin:end]
+		return &group
+	}
+	return nil
+}
+
 func (m MatchData) checkIndex(n int) {
 	if n < 0 || n*2+1 >= len(m.index) {
 		panic("index " + strconv.Itoa(n) + " out of matches")
@@ -28,10 +40,7 @@ func (m MatchData) Captures() []*string {
 	size := m.Size()
 	caps := make([]*string, size)
 	for i := 1; i <= size; i++ {
-		begin, end := m.index[i*2], m.index[i*2+1]
-		if begin >= 0 {
-			caps[i-1] = &m.str[begin:end]
-		}
+		caps[i-1] = m.group(i)
 	}
 	return caps
 }
@@ -43,45 +52,52 @@ func (m MatchData) End(n int) int {
 
 func (m MatchData) Group(n int) *string {
 	m.checkIndex(n)
-	begin, end := m.index[n*2], m.index[n*2+1]
-	if begin >= 0 {
-		return &m.str[begin:end]
-	}
-	return nil
+	return m.group(n)
 }
 
 func (m MatchData) IsEql(rhs MatchData) bool {
-	return m.str == rhs.str && reflect.DeepEqual(m.regexp, rhs.regexp) && reflect.DeepEqual(m.index, rhs.index)
-}
-
-func safeString(str *string) string {
-	if str == nil {
-		return "nil"
-	} else {
-		return "\"" + strconv.Quote(*str) + "\""
-	}
+	return m.str == rhs.str && isPatternEql(m.regexp, rhs.regexp) && reflect.DeepEqual(m.index, rhs.index)
 }
 
 func (m MatchData) Inspect() string {
 	var buf bytes.Buffer
 	buf.WriteString(`#<MatchData `)
-	buf.WriteString(safeString(m.Group(0)))
+	buf.WriteString(Inspect(m.Group(0)))
 
 	names := m.regexp.SubexpNames()
 	for i, size := 1, m.Size(); i <= size; i++ {
 		buf.WriteRune(' ')
-		name := names[i]
-		if name != "" {
+		if name := names[i]; name != "" {
 			buf.WriteString(name)
+		} else {
+			buf.WriteString(strconv.Itoa(i))
 		}
 		buf.WriteRune(':')
-		buf.WriteString(safeString(m.Group(i)))
+		buf.WriteString(Inspect(m.Group(i)))
 	}
 	buf.WriteRune('>')
 
 	return buf.String()
 }
 
+func (m MatchData) PrettyPrint(q *PrettyPrinter) {
+	names := m.regexp.SubexpNames()
+	q.Group(1, "#<MatchData", ">", func() {
+		q.Breakable(" ")
+		q.Seplist(m.Size()+1, func() { q.Breakable(" ") }, func(i int) {
+			if i > 0 {
+				if name := names[i]; name != "" {
+					q.Text(name)
+				} else {
+					q.Text(strconv.Itoa(i))
+				}
+				q.Text(":")
+			}
+			q.PP(m.Group(i))
+		})
+	})
+}
+
 func (m MatchData) Length() int {
 	return m.Size()
 }
@@ -119,10 +135,10 @@ func (m MatchData) PreMatch() string {
 }
 
 func (m MatchData) PostMatch() string {
-	return m.str[m.index[1]+1:]
+	return m.str[m.index[1]:]
 }
 
-func (m MatchData) Regexp() *regexp.Regexp {
+func (m MatchData) Regexp() Pattern {
 	return m.regexp
 }
 
@@ -143,10 +159,7 @@ func (m MatchData) ToA() []*string {
 	size := m.Size() + 1
 	arr := make([]*string, size)
 	for i := 0; i < size; i++ {
-		begin, end := m.index[i*2], m.index[i*2+1]
-		if begin >= 0 {
-			arr[i-1] = &m.str[begin:end]
-		}
+		arr[i] = m.group(i)
 	}
 	return arr
 }
@@ -161,8 +174,14 @@ func (m MatchData) String() string {
 
 func (m MatchData) ValuesAt(index ...int) []*string {
 	arr := make([]*string, len(index))
-	for i := 0; i < len(index); i++ {
-		arr[i] = m.Group(i)
+	size := m.Size() + 1
+	for i, n := range index {
+		if n < 0 {
+			n += size
+		}
+		if n >= 0 && n < size {
+			arr[i] = m.group(n)
+		}
 	}
 	return arr
 }
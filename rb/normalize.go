@@ -0,0 +1,207 @@
+package rb
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+type NormalizationForm int
+
+// The zero NormalizationForm means NFC, Ruby's default.
+const (
+	NormalizationNFC NormalizationForm = iota + 1
+	NormalizationNFD
+	NormalizationNFKC
+	NormalizationNFKD
+)
+
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+var (
+	compositionsOnce sync.Once
+	compositions     map[[2]rune]rune
+)
+
+func loadCompositions() {
+	excluded := make(map[rune]bool, len(compositionExclusions))
+	for _, r := range compositionExclusions {
+		excluded[r] = true
+	}
+	compositions = make(map[[2]rune]rune, len(canonicalDecompositions))
+	for r, decomposition := range canonicalDecompositions {
+		pair := []rune(decomposition)
+		if len(pair) != 2 || excluded[r] || combiningClass(r) != 0 || combiningClass(pair[0]) != 0 {
+			continue
+		}
+		compositions[[2]rune{pair[0], pair[1]}] = r
+	}
+}
+
+func combiningClass(r rune) uint8 {
+	i := sort.Search(len(combiningClasses), func(i int) bool {
+		return combiningClasses[i].hi >= r
+	})
+	if i < len(combiningClasses) && combiningClasses[i].lo <= r {
+		return combiningClasses[i].class
+	}
+	return 0
+}
+
+func decomposeRune(buf []rune, r rune, compat bool) []rune {
+	if r >= hangulSBase && r < hangulSBase+hangulSCount {
+		s := r - hangulSBase
+		buf = append(buf, hangulLBase+s/hangulNCount, hangulVBase+s%hangulNCount/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			buf = append(buf, hangulTBase+t)
+		}
+		return buf
+	}
+	decomposition, ok := canonicalDecompositions[r]
+	if !ok && compat {
+		decomposition, ok = compatibilityDecompositions[r]
+	}
+	if !ok {
+		return append(buf, r)
+	}
+	for _, c := range decomposition {
+		buf = decomposeRune(buf, c, compat)
+	}
+	return buf
+}
+
+// decompose fully decomposes s and puts combining marks in canonical order.
+func decompose(s string, compat bool) []rune {
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		runes = decomposeRune(runes, r, compat)
+	}
+	for i := 1; i < len(runes); i++ {
+		class := combiningClass(runes[i])
+		if class == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			prev := combiningClass(runes[j-1])
+			if prev <= class {
+				break
+			}
+			runes[j-1], runes[j] = runes[j], runes[j-1]
+		}
+	}
+	return runes
+}
+
+func composePair(a, b rune) (rune, bool) {
+	switch {
+	case a >= hangulLBase && a < hangulLBase+hangulLCount && b >= hangulVBase && b < hangulVBase+hangulVCount:
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+b-hangulVBase)*hangulTCount, true
+	case a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount:
+		return a + b - hangulTBase, true
+	}
+	compositionsOnce.Do(loadCompositions)
+	r, ok := compositions[[2]rune{a, b}]
+	return r, ok
+}
+
+// compose recombines decomposed runes in place: a mark joins the last
+// starter unless a character in between has a class as high or a starter.
+func compose(runes []rune) []rune {
+	if len(runes) == 0 {
+		return runes
+	}
+	starter, last := 0, 0
+	if combiningClass(runes[0]) != 0 {
+		last = 256
+	}
+	n := 1
+	for _, r := range runes[1:] {
+		class := int(combiningClass(r))
+		if composite, ok := composePair(runes[starter], r); ok && (last < class || last == 0) {
+			runes[starter] = composite
+			continue
+		}
+		if class == 0 {
+			starter = n
+		}
+		last = class
+		runes[n] = r
+		n++
+	}
+	return runes[:n]
+}
+
+func normalize(s string, form NormalizationForm) string {
+	runes := decompose(s, form == NormalizationNFKC || form == NormalizationNFKD)
+	if form != NormalizationNFD && form != NormalizationNFKD {
+		runes = compose(runes)
+	}
+	return string(runes)
+}
+
+// UnicodeNormalize converts UTF-8, UTF-16 and UTF-32 strings into the given
+// normalization form; other encodings besides US-ASCII are an error.
+func (str String) UnicodeNormalize(form NormalizationForm) (String, error) {
+	enc := str.Encoding()
+	switch {
+	case enc == EncodingUSASCII:
+		return str.Dup(), nil
+	case !enc.unicode:
+		return String{}, EncodingCompatibilityError{"Unicode Normalization not appropriate for " + enc.name}
+	case enc != EncodingUTF8:
+		converted, err := str.Encode(EncodingUTF8, EncodeOptions{})
+		if err != nil {
+			return String{}, err
+		}
+		if converted, err = converted.UnicodeNormalize(form); err != nil {
+			return String{}, err
+		}
+		return converted.Encode(enc, EncodeOptions{})
+	case !utf8.ValidString(str.Value):
+		return String{}, ArgumentError{"invalid byte sequence in UTF-8"}
+	}
+	return str.withValue(normalize(str.Value, form)), nil
+}
+
+func (str String) IsUnicodeNormalized(form NormalizationForm) (bool, error) {
+	normalized, err := str.UnicodeNormalize(form)
+	if err != nil {
+		return false, err
+	}
+	return normalized.Value == str.Value, nil
+}
+
+// normalizedOrSelf returns str in form, or unchanged when it cannot be
+// normalized.
+func (str String) normalizedOrSelf(form NormalizationForm) String {
+	if normalized, err := str.UnicodeNormalize(form); err == nil {
+		return normalized
+	}
+	return str
+}
+
+// OpSpaceShipNormalized is OpSpaceShip on both strings normalized to form.
+func (str String) OpSpaceShipNormalized(rhs String, form NormalizationForm) int {
+	return str.normalizedOrSelf(form).OpSpaceShip(rhs.normalizedOrSelf(form))
+}
+
+// CasecmpNormalized is Casecmp on both strings normalized to form.
+func (str String) CasecmpNormalized(rhs String, form NormalizationForm) (int, error) {
+	return str.normalizedOrSelf(form).Casecmp(rhs.normalizedOrSelf(form))
+}
+
+func (str String) IsCasecmpNormalized(rhs String, form NormalizationForm) (bool, error) {
+	cmp, err := str.CasecmpNormalized(rhs, form)
+	return err == nil && cmp == 0, err
+}
@@ -0,0 +1,68 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_UnicodeNormalize(t *testing.T) {
+	tests := []struct {
+		input                string
+		nfc, nfd, nfkc, nfkd string
+	}{
+		{"e\u0301", "\u00E9", "e\u0301", "\u00E9", "e\u0301"},
+		{"\u00C5\u212B", "\u00C5\u00C5", "A\u030AA\u030A", "\u00C5\u00C5", "A\u030AA\u030A"},
+		{"a\u0301\u0323", "\u1EA1\u0301", "a\u0323\u0301", "\u1EA1\u0301", "a\u0323\u0301"},
+		{"\uFB01\u2460", "\uFB01\u2460", "\uFB01\u2460", "fi1", "fi1"},
+		{"\uD55C\uAE00", "\uD55C\uAE00", "\u1112\u1161\u11AB\u1100\u1173\u11AF", "\uD55C\uAE00", "\u1112\u1161\u11AB\u1100\u1173\u11AF"},
+		{"\u0958", "\u0915\u093C", "\u0915\u093C", "\u0915\u093C", "\u0915\u093C"},
+		{"\u0301a", "\u0301a", "\u0301a", "\u0301a", "\u0301a"},
+	}
+	for _, test := range tests {
+		for form, expected := range map[NormalizationForm]string{
+			NormalizationNFC: test.nfc, NormalizationNFD: test.nfd, NormalizationNFKC: test.nfkc, NormalizationNFKD: test.nfkd,
+		} {
+			normalized, err := NewString(test.input).UnicodeNormalize(form)
+			assert.Nil(t, err, "%+q form %d", test.input, form)
+			assert.Equal(t, expected, normalized.Value, "%+q form %d", test.input, form)
+		}
+	}
+
+	normalized, _ := NewString("e\u0301").UnicodeNormalize(0)
+	assert.Equal(t, "\u00E9", normalized.Value, "NFC by default")
+
+	utf16 := NewString("\x00e\x03\x01").ForceEncoding(EncodingUTF16BE)
+	normalized, err := utf16.UnicodeNormalize(NormalizationNFC)
+	assert.Nil(t, err, "UTF-16")
+	assert.Equal(t, NewString("\x00\xe9").ForceEncoding(EncodingUTF16BE), normalized, "UTF-16 keeps its encoding")
+
+	_, err = NewString("\xe9").ForceEncoding(EncodingISO8859_1).UnicodeNormalize(NormalizationNFC)
+	assert.Equal(t, EncodingCompatibilityError{"Unicode Normalization not appropriate for ISO-8859-1"}, err, "non-Unicode encoding")
+	_, err = NewString("\xff").UnicodeNormalize(NormalizationNFC)
+	assert.Equal(t, ArgumentError{"invalid byte sequence in UTF-8"}, err, "invalid byte sequence")
+}
+
+func TestString_IsUnicodeNormalized(t *testing.T) {
+	ok, _ := NewString("\u00E9").IsUnicodeNormalized(NormalizationNFC)
+	assert.True(t, ok, "NFC")
+	ok, _ = NewString("\u00E9").IsUnicodeNormalized(NormalizationNFD)
+	assert.False(t, ok, "NFD")
+	ok, _ = NewString("\u2460").IsUnicodeNormalized(NormalizationNFKC)
+	assert.False(t, ok, "NFKC")
+}
+
+func TestString_CompareNormalization(t *testing.T) {
+	composed, decomposed := NewString("caf\u00E9"), NewString("cafe\u0301")
+	assert.NotEqual(t, 0, composed.OpSpaceShip(decomposed), "OpSpaceShip compares bytes")
+	assert.Equal(t, 0, composed.OpSpaceShipNormalized(decomposed, NormalizationNFC), "OpSpaceShipNormalized")
+	assert.Equal(t, 0, NewString("\u2460").OpSpaceShipNormalized(NewString("1"), NormalizationNFKC), "OpSpaceShipNormalized NFKC")
+
+	equal, err := NewString("CAFE\u0301").IsCasecmp(composed)
+	assert.Nil(t, err, "IsCasecmp")
+	assert.False(t, equal, "IsCasecmp compares bytes")
+	equal, err = NewString("CAFE\u0301").IsCasecmpNormalized(composed, NormalizationNFC)
+	assert.Nil(t, err, "IsCasecmpNormalized")
+	assert.True(t, equal, "IsCasecmpNormalized")
+	cmp, _ := NewString("CAFE\u0301").CasecmpNormalized(NewString("cafF"), NormalizationNFD)
+	assert.Equal(t, -1, cmp, "CasecmpNormalized")
+}
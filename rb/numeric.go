@@ -0,0 +1,353 @@
+package rb
+
+import (
+	"math/big"
+	"math/cmplx"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && isAsciiSpace(rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
+// scanDigits reads the digits of base from s[i:], where single underscores
+// may separate digits, and returns them with the end of the run.
+func scanDigits(s string, i, base int) (string, int) {
+	var digits []byte
+	end := i
+	for j := i; j < len(s); j++ {
+		if s[j] == '_' {
+			if j == i || s[j-1] == '_' {
+				break
+			}
+			continue
+		}
+		if digitValue(s[j]) >= base {
+			break
+		}
+		digits = append(digits, s[j])
+		end = j + 1
+	}
+	return string(digits), end
+}
+
+// parseInteger reads an integer the way Ruby does. Base 0 honours 0b, 0o,
+// 0d and 0x prefixes and takes a leading 0 for octal, a negative base
+// honours them too but defaults to -base, and any other base only skips its
+// own prefix. Unless strict, parsing stops at the first invalid character.
+func parseInteger(s string, base int, strict bool) (*big.Int, bool) {
+	anyPrefix := base <= 0
+	base = max(base, -base)
+	i := skipSpace(s, 0)
+	negative := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		negative = s[i] == '-'
+		i++
+	}
+	if i+1 < len(s) && s[i] == '0' {
+		prefixed := 0
+		switch s[i+1] | 0x20 {
+		case 'b':
+			prefixed = 2
+		case 'o':
+			prefixed = 8
+		case 'd':
+			prefixed = 10
+		case 'x':
+			prefixed = 16
+		}
+		if prefixed != 0 && (anyPrefix || base == prefixed) {
+			base = prefixed
+			i += 2
+		} else if base == 0 {
+			base = 8
+		}
+	}
+	if base == 0 {
+		base = 10
+	}
+	digits, end := scanDigits(s, i, base)
+	if strict && (digits == "" || skipSpace(s, end) != len(s)) {
+		return nil, false
+	}
+	n := new(big.Int)
+	if digits != "" {
+		n.SetString(digits, base)
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n, true
+}
+
+// scanFloat reads a decimal float literal from s[i:] and returns it without
+// underscores, or "" when there is none.
+func scanFloat(s string, i int) (string, int) {
+	var literal strings.Builder
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		literal.WriteByte(s[i])
+		i++
+	}
+	digits, end := scanDigits(s, i, 10)
+	literal.WriteString(digits)
+	if end+1 < len(s) && s[end] == '.' && digitValue(s[end+1]) < 10 {
+		fraction, fractionEnd := scanDigits(s, end+1, 10)
+		literal.WriteString("." + fraction)
+		digits, end = digits+fraction, fractionEnd
+	}
+	if digits == "" {
+		return "", i
+	}
+	if end < len(s) && s[end]|0x20 == 'e' {
+		j := end + 1
+		sign := ""
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			sign = s[j : j+1]
+			j++
+		}
+		if exponent, exponentEnd := scanDigits(s, j, 10); exponent != "" {
+			literal.WriteString("e" + sign + exponent)
+			end = exponentEnd
+		}
+	}
+	return literal.String(), end
+}
+
+// scanRational reads a float literal from s[i:] with an optional integer
+// denominator, or returns nil when there is none. A zero denominator is
+// left unread and reported as a ZeroDivisionError.
+func scanRational(s string, i int) (*big.Rat, int, error) {
+	literal, end := scanFloat(s, i)
+	if literal == "" {
+		return nil, i, nil
+	}
+	r, _ := new(big.Rat).SetString(literal)
+	if end+1 < len(s) && s[end] == '/' {
+		if digits, denominatorEnd := scanDigits(s, end+1, 10); digits != "" {
+			d, _ := new(big.Int).SetString(digits, 10)
+			if d.Sign() == 0 {
+				return r, end, ZeroDivisionError{"divided by 0"}
+			}
+			r.Quo(r, new(big.Rat).SetInt(d))
+			end = denominatorEnd
+		}
+	}
+	return r, end, nil
+}
+
+func parseFloat(s string, strict bool) (float64, bool) {
+	i := skipSpace(s, 0)
+	j := i
+	if j < len(s) && (s[j] == '+' || s[j] == '-') {
+		j++
+	}
+	if strict && j+1 < len(s) && s[j] == '0' && s[j+1]|0x20 == 'x' {
+		n, ok := parseInteger(s, 16, true)
+		if !ok {
+			return 0, false
+		}
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	}
+	literal, end := scanFloat(s, i)
+	if strict && (literal == "" || skipSpace(s, end) != len(s)) {
+		return 0, false
+	}
+	if literal == "" {
+		return 0, true
+	}
+	f, _ := strconv.ParseFloat(literal, 64)
+	return f, true
+}
+
+// ToI reads a leading integer in base, 0 or 2 to 36, and returns 0 when
+// there is none.
+func (str String) ToI(base int) *big.Int {
+	if base == 1 || base < 0 || base > 36 {
+		panic("invalid radix " + strconv.Itoa(base))
+	}
+	n, _ := parseInteger(str.Value, base, false)
+	return n
+}
+
+// Hex reads a leading hexadecimal integer.
+func (str String) Hex() *big.Int {
+	return str.ToI(16)
+}
+
+// Oct reads a leading octal integer, or one in the base its prefix names.
+func (str String) Oct() *big.Int {
+	n, _ := parseInteger(str.Value, -8, false)
+	return n
+}
+
+// ToF reads a leading decimal float and returns 0 when there is none.
+func (str String) ToF() float64 {
+	f, _ := parseFloat(str.Value, false)
+	return f
+}
+
+// ToR reads a leading rational such as "-1.5", "3/4" or "1e3/7". A zero
+// denominator is a ZeroDivisionError.
+func (str String) ToR() (*big.Rat, error) {
+	r, _, err := scanRational(str.Value, skipSpace(str.Value, 0))
+	switch {
+	case err != nil:
+		return nil, err
+	case r == nil:
+		return new(big.Rat), nil
+	}
+	return r, nil
+}
+
+func isImaginaryUnit(c byte) bool {
+	return c|0x20 == 'i' || c|0x20 == 'j'
+}
+
+// ToC reads a leading complex number in rectangular form, such as "1-2i",
+// "3.5" or "-i", or in polar form, such as "1@0.5".
+func (str String) ToC() complex128 {
+	s := str.Value
+	i := skipSpace(s, 0)
+	real, end, _ := scanRational(s, i)
+	if real == nil {
+		j := i
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isImaginaryUnit(s[j]) {
+			return complex(0, unitSign(s[i]))
+		}
+		return 0
+	}
+	x, _ := real.Float64()
+	if end >= len(s) {
+		return complex(x, 0)
+	}
+	switch c := s[end]; {
+	case isImaginaryUnit(c):
+		return complex(0, x)
+	case c == '@':
+		if theta, _, _ := scanRational(s, end+1); theta != nil {
+			t, _ := theta.Float64()
+			return cmplx.Rect(x, t)
+		}
+	case c == '+' || c == '-':
+		imag, imagEnd, _ := scanRational(s, end)
+		if imag != nil && imagEnd < len(s) && isImaginaryUnit(s[imagEnd]) {
+			y, _ := imag.Float64()
+			return complex(x, y)
+		}
+		if imag == nil && end+1 < len(s) && isImaginaryUnit(s[end+1]) {
+			return complex(x, unitSign(c))
+		}
+	}
+	return complex(x, 0)
+}
+
+func unitSign(c byte) float64 {
+	if c == '-' {
+		return -1
+	}
+	return 1
+}
+
+// Ord returns the code point of the first character.
+func (str String) Ord() (rune, error) {
+	if str.Value == "" {
+		return 0, ArgumentError{"empty string"}
+	}
+	enc := str.Encoding()
+	r, _, state := enc.decodeChar(str.Value)
+	if state == charInvalid {
+		return 0, ArgumentError{"invalid byte sequence in " + enc.name}
+	}
+	return r, nil
+}
+
+// Sum adds up the bytes of str modulo 2**bits; bits of 0 or less means no
+// modulo.
+func (str String) Sum(bits int) int {
+	sum := 0
+	for i := 0; i < len(str.Value); i++ {
+		sum += int(str.Value[i])
+	}
+	if bits > 0 && bits < strconv.IntSize-1 {
+		sum &= 1<<bits - 1
+	}
+	return sum
+}
+
+// Integer converts value as Kernel#Integer does. A string must hold nothing
+// but an integer in base, where base 0 honours 0b, 0o, 0d and 0x prefixes
+// and takes a leading 0 for octal.
+func Integer(value interface{}, base int) (*big.Int, error) {
+	switch v := value.(type) {
+	case String:
+		return Integer(v.Value, base)
+	case string:
+		if base < 0 || base == 1 || base > 36 {
+			return nil, ArgumentError{"invalid radix " + strconv.Itoa(base)}
+		}
+		n, ok := parseInteger(v, base, true)
+		if !ok {
+			return nil, ArgumentError{"invalid value for Integer(): " + NewString(v).Inspect()}
+		}
+		return n, nil
+	}
+	if base != 0 {
+		return nil, ArgumentError{"base specified for non string value"}
+	}
+	if n, ok, err := integerValue(value); ok {
+		return n, err
+	}
+	return nil, TypeError{"can't convert " + typeName(value) + " into Integer"}
+}
+
+// Float converts value as Kernel#Float does. A string must hold nothing but
+// a decimal float or a 0x-prefixed hexadecimal integer.
+func Float(value interface{}) (float64, error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	switch v := value.(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f, nil
+	case String:
+		return Float(v.Value)
+	case string:
+		f, ok := parseFloat(v, true)
+		if !ok {
+			return 0, ArgumentError{"invalid value for Float(): " + NewString(v).Inspect()}
+		}
+		return f, nil
+	}
+	return 0, TypeError{"can't convert " + typeName(value) + " into Float"}
+}
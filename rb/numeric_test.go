@@ -0,0 +1,210 @@
+package rb
+
+import (
+	"testing"
+	"math/big"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_ToI(t *testing.T) {
+	tests := []struct {
+		input    string
+		base     int
+		expected int64
+	}{
+		{"12abc", 10, 12},
+		{" 12abc", 10, 12},
+		{"1_000", 10, 1000},
+		{"1__2", 10, 1},
+		{"_12", 10, 0},
+		{"12_", 10, 12},
+		{"-42", 10, -42},
+		{"+-1", 10, 0},
+		{"abc", 10, 0},
+		{"0b101", 0, 5},
+		{"0b101", 10, 0},
+		{"0b101", 2, 5},
+		{"0x1A", 16, 26},
+		{"-0x1A", 16, -26},
+		{"0b1", 16, 0xb1},
+		{"0o17", 0, 15},
+		{"017", 0, 15},
+		{"017", 10, 17},
+		{"0d19", 0, 19},
+		{"z", 36, 35},
+		{"0x", 16, 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, big.NewInt(test.expected), NewString(test.input).ToI(test.base), "%q.ToI(%d)", test.input, test.base)
+	}
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	assert.Equal(t, huge, NewString("123456789012345678901234567890").ToI(10), "big integer")
+	assert.Panics(t, func() { NewString("1").ToI(37) }, "invalid radix")
+}
+
+func TestString_HexOct(t *testing.T) {
+	assert.Equal(t, big.NewInt(-31), NewString("-0x1f").Hex(), "Hex")
+	assert.Equal(t, big.NewInt(0), NewString("zz").Hex(), "Hex without digits")
+	assert.Equal(t, big.NewInt(511), NewString("777").Oct(), "Oct")
+	assert.Equal(t, big.NewInt(7), NewString("789").Oct(), "Oct stops at 8")
+	assert.Equal(t, big.NewInt(-15), NewString("-17").Oct(), "Oct negative")
+	assert.Equal(t, big.NewInt(26), NewString("0x1A").Oct(), "Oct with 0x")
+	assert.Equal(t, big.NewInt(3), NewString("0b11").Oct(), "Oct with 0b")
+}
+
+func TestString_ToF(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1_000.5", 1000.5},
+		{" 3.25abc", 3.25},
+		{"1e3", 1000},
+		{"-1.5e-2", -0.015},
+		{"1.", 1},
+		{"1e", 1},
+		{".5", 0.5},
+		{"abc", 0},
+		{"0x1A", 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).ToF(), "%q.ToF()", test.input)
+	}
+}
+
+func TestString_ToR(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *big.Rat
+	}{
+		{"0.75", big.NewRat(3, 4)},
+		{" 2 ", big.NewRat(2, 1)},
+		{"300/2", big.NewRat(150, 1)},
+		{"-9.2", big.NewRat(-46, 5)},
+		{"21/06/09", big.NewRat(7, 2)},
+		{"1_000/3", big.NewRat(1000, 3)},
+		{"1e2", big.NewRat(100, 1)},
+		{"BWV 1079", big.NewRat(0, 1)},
+	}
+	for _, test := range tests {
+		r, err := NewString(test.input).ToR()
+		assert.Nil(t, err, "%q.ToR()", test.input)
+		assert.Equal(t, test.expected.String(), r.String(), "%q.ToR()", test.input)
+	}
+
+	for _, input := range []string{"1/0", "-2.5/00", "3/0_0"} {
+		_, err := NewString(input).ToR()
+		assert.Equal(t, ZeroDivisionError{"divided by 0"}, err, "%q.ToR()", input)
+	}
+	r, _ := NewString("1/").ToR()
+	assert.Equal(t, "1/1", r.String(), `"1/".ToR()`)
+}
+
+func TestString_ToC(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected complex128
+	}{
+		{"1+2i", complex(1, 2)},
+		{"-i", complex(0, -1)},
+		{"1-i", complex(1, -1)},
+		{"3.5", complex(3.5, 0)},
+		{"2i", complex(0, 2)},
+		{"1/2+3/4j", complex(0.5, 0.75)},
+		{"1@0", complex(1, 0)},
+		{"1+2", complex(1, 0)},
+		{"abc", 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).ToC(), "%q.ToC()", test.input)
+	}
+}
+
+func TestString_Ord(t *testing.T) {
+	r, err := NewString("é").Ord()
+	assert.Nil(t, err, "Ord")
+	assert.Equal(t, 'é', r, "Ord")
+	r, _ = NewString("\xff").B().Ord()
+	assert.Equal(t, rune(0xff), r, "Ord of binary")
+	_, err = NewString("").Ord()
+	assert.Equal(t, ArgumentError{"empty string"}, err, "Ord of empty string")
+	_, err = NewString("\xff").Ord()
+	assert.Equal(t, ArgumentError{"invalid byte sequence in UTF-8"}, err, "Ord of invalid byte")
+}
+
+func TestString_Sum(t *testing.T) {
+	assert.Equal(t, 532, NewString("hello").Sum(16), "Sum")
+	assert.Equal(t, 20, NewString("hello").Sum(8), "Sum modulo 2**8")
+	assert.Equal(t, 532, NewString("hello").Sum(0), "Sum without modulo")
+}
+
+func TestInteger(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		base     int
+		expected int64
+	}{
+		{"0b101", 0, 5},
+		{NewString("1_000"), 0, 1000},
+		{" 12\n", 0, 12},
+		{"-0b11", 0, -3},
+		{"0x1A", 16, 26},
+		{"1A", 16, 26},
+		{"017", 0, 15},
+		{"017", 10, 17},
+		{3.9, 0, 3},
+		{int8(-4), 0, -4},
+	}
+	for _, test := range tests {
+		n, err := Integer(test.input, test.base)
+		assert.Nil(t, err, "Integer(%#v, %d)", test.input, test.base)
+		assert.Equal(t, big.NewInt(test.expected), n, "Integer(%#v, %d)", test.input, test.base)
+	}
+
+	errors := []struct {
+		input    interface{}
+		base     int
+		expected error
+	}{
+		{"12abc", 0, ArgumentError{`invalid value for Integer(): "12abc"`}},
+		{"08", 0, ArgumentError{`invalid value for Integer(): "08"`}},
+		{"1__0", 0, ArgumentError{`invalid value for Integer(): "1__0"`}},
+		{"12_", 0, ArgumentError{`invalid value for Integer(): "12_"`}},
+		{"0x", 0, ArgumentError{`invalid value for Integer(): "0x"`}},
+		{"", 0, ArgumentError{`invalid value for Integer(): ""`}},
+		{"1", 1, ArgumentError{"invalid radix 1"}},
+		{12, 8, ArgumentError{"base specified for non string value"}},
+		{nil, 0, TypeError{"can't convert nil into Integer"}},
+	}
+	for _, test := range errors {
+		_, err := Integer(test.input, test.base)
+		assert.Equal(t, test.expected, err, "Integer(%#v, %d)", test.input, test.base)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected float64
+	}{
+		{"1_000.5", 1000.5},
+		{" 1e3 ", 1000},
+		{"-.5", -0.5},
+		{"0x1A", 26},
+		{NewString("2.5"), 2.5},
+		{3, 3},
+		{big.NewRat(1, 4), 0.25},
+	}
+	for _, test := range tests {
+		f, err := Float(test.input)
+		assert.Nil(t, err, "Float(%#v)", test.input)
+		assert.Equal(t, test.expected, f, "Float(%#v)", test.input)
+	}
+
+	for _, input := range []string{"1.", "1e", "abc", "", "1.5x", "1__0.5"} {
+		_, err := Float(input)
+		assert.Equal(t, ArgumentError{"invalid value for Float(): " + NewString(input).Inspect()}, err, "Float(%q)", input)
+	}
+	_, err := Float(nil)
+	assert.Equal(t, TypeError{"can't convert nil into Float"}, err, "Float(nil)")
+}
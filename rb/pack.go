@@ -0,0 +1,915 @@
+package rb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type packDirective struct {
+	kind     byte
+	count    int
+	hasCount bool
+	star     bool
+	native   bool
+	endian   byte
+}
+
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+func parsePackTemplate(template string, unpack bool) ([]packDirective, error) {
+	directives := make([]packDirective, 0, len(template))
+	for i := 0; i < len(template); {
+		c := template[i]
+		i++
+		if c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r' || c == 0 {
+			continue
+		}
+		if c == '#' {
+			for i < len(template) && template[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		if !strings.ContainsRune("CcSsLlQqJjIinNvVaAZHhBbUwmMuxX@DdFfEeGg", rune(c)) {
+			verb := "pack"
+			if unpack {
+				verb = "unpack"
+			}
+			return nil, ArgumentError{"unknown " + verb + " directive '" + string(c) + "' in '" + template + "'"}
+		}
+		d := packDirective{kind: c}
+	MODIFIERS:
+		for i < len(template) {
+			switch m := template[i]; m {
+			case '_', '!':
+				if !strings.ContainsRune("sSiIlLqQjJ", rune(c)) {
+					return nil, ArgumentError{"'" + string(m) + "' allowed only after types sSiIlLqQjJ"}
+				}
+				d.native = true
+			case '<', '>':
+				if !strings.ContainsRune("sSiIlLqQjJ", rune(c)) {
+					return nil, ArgumentError{"'" + string(m) + "' allowed only after types sSiIlLqQjJ"}
+				}
+				if d.endian != 0 && d.endian != m {
+					return nil, RangeError{"Can't use both '<' and '>'"}
+				}
+				d.endian = m
+			default:
+				break MODIFIERS
+			}
+			i++
+		}
+		if i < len(template) && template[i] == '*' {
+			d.star = true
+			i++
+		} else if i < len(template) && template[i] >= '0' && template[i] <= '9' {
+			n, next, err := parseNumber(template, i)
+			if err != nil {
+				return nil, RangeError{"pack length too big"}
+			}
+			d.count, d.hasCount = n, true
+			i = next
+		} else if c == '@' && unpack {
+			d.count = 0
+		} else {
+			d.count = 1
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// integerLayout reports the byte size, signedness and byte order of an integer directive.
+func (d packDirective) integerLayout() (size int, signed bool, littleEndian bool, ok bool) {
+	littleEndian = nativeLittleEndian
+	switch d.kind {
+	case 'C', 'c':
+		size = 1
+	case 'S', 's':
+		size = 2
+	case 'L', 'l':
+		size = 4
+		if d.native {
+			size = strconv.IntSize / 8
+		}
+	case 'I', 'i':
+		size = 4
+	case 'Q', 'q':
+		size = 8
+	case 'J', 'j':
+		size = strconv.IntSize / 8
+	case 'n':
+		size, littleEndian = 2, false
+	case 'N':
+		size, littleEndian = 4, false
+	case 'v':
+		size, littleEndian = 2, true
+	case 'V':
+		size, littleEndian = 4, true
+	default:
+		return
+	}
+	switch d.endian {
+	case '<':
+		littleEndian = true
+	case '>':
+		littleEndian = false
+	}
+	signed = d.kind >= 'a' && d.kind <= 'z' && !strings.ContainsRune("nv", rune(d.kind))
+	return size, signed, littleEndian, true
+}
+
+// floatLayout reports the byte size and byte order of a float directive.
+func (d packDirective) floatLayout() (size int, littleEndian bool, ok bool) {
+	switch d.kind {
+	case 'F', 'f':
+		return 4, nativeLittleEndian, true
+	case 'e':
+		return 4, true, true
+	case 'g':
+		return 4, false, true
+	case 'D', 'd':
+		return 8, nativeLittleEndian, true
+	case 'E':
+		return 8, true, true
+	case 'G':
+		return 8, false, true
+	}
+	return
+}
+
+const hexDigits = "0123456789abcdef"
+
+const uuTable = "`!\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_"
+
+const b64Table = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func b64Value(c byte) int {
+	if i := strings.IndexByte(b64Table, c); i >= 0 {
+		return i
+	}
+	return -1
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+func (str String) Unpack(template String) ([]interface{}, error) {
+	return str.unpack(template.Value, false)
+}
+
+func (str String) Unpack1(template String) (interface{}, error) {
+	values, err := str.unpack(template.Value, true)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+func (str String) unpack(template string, single bool) ([]interface{}, error) {
+	directives, err := parsePackTemplate(template, true)
+	if err != nil {
+		return nil, err
+	}
+	data := str.Value
+	values := make([]interface{}, 0, len(directives))
+	s := 0
+	for _, d := range directives {
+		if single && len(values) > 0 {
+			break
+		}
+		count := d.count
+		if d.star {
+			count = len(data) - s
+		}
+		rest := len(data) - s
+
+		if size, signed, littleEndian, ok := d.integerLayout(); ok {
+			missing := 0
+			if count > rest/size {
+				if !d.star {
+					missing = count - rest/size
+				}
+				count = rest / size
+			}
+			for ; count > 0; count-- {
+				var u uint64
+				for i := 0; i < size; i++ {
+					b := data[s+i]
+					if littleEndian {
+						u |= uint64(b) << (8 * uint(i))
+					} else {
+						u = u<<8 | uint64(b)
+					}
+				}
+				s += size
+				if signed {
+					shift := uint(64 - 8*size)
+					values = append(values, int64(u<<shift)>>shift)
+				} else {
+					values = append(values, u)
+				}
+			}
+			for ; missing > 0; missing-- {
+				values = append(values, nil)
+			}
+			continue
+		}
+
+		if size, littleEndian, ok := d.floatLayout(); ok {
+			missing := 0
+			if count > rest/size {
+				if !d.star {
+					missing = count - rest/size
+				}
+				count = rest / size
+			}
+			order := binary.ByteOrder(binary.BigEndian)
+			if littleEndian {
+				order = binary.LittleEndian
+			}
+			for ; count > 0; count-- {
+				if size == 4 {
+					values = append(values, float64(math.Float32frombits(order.Uint32([]byte(data[s:s+4])))))
+				} else {
+					values = append(values, math.Float64frombits(order.Uint64([]byte(data[s:s+8]))))
+				}
+				s += size
+			}
+			for ; missing > 0; missing-- {
+				values = append(values, nil)
+			}
+			continue
+		}
+
+		switch d.kind {
+		case 'a', 'A', 'Z':
+			if count > rest {
+				count = rest
+			}
+			field := data[s : s+count]
+			switch d.kind {
+			case 'A':
+				field = strings.TrimRight(field, " \x00")
+				s += count
+			case 'Z':
+				t := strings.IndexByte(field, 0)
+				if t < 0 {
+					t = len(field)
+				}
+				field = field[:t]
+				if d.star {
+					s += t
+					if s < len(data) {
+						s++
+					}
+				} else {
+					s += count
+				}
+			default:
+				s += count
+			}
+			values = append(values, NewString(field))
+		case 'b', 'B':
+			if d.star || count > rest*8 {
+				count = rest * 8
+			}
+			buf := make([]byte, count)
+			var bits byte
+			for i := 0; i < count; i++ {
+				if i&7 != 0 {
+					if d.kind == 'b' {
+						bits >>= 1
+					} else {
+						bits <<= 1
+					}
+				} else {
+					bits = data[s]
+					s++
+				}
+				mask := byte(1)
+				if d.kind == 'B' {
+					mask = 128
+				}
+				if bits&mask != 0 {
+					buf[i] = '1'
+				} else {
+					buf[i] = '0'
+				}
+			}
+			values = append(values, NewString(string(buf)))
+		case 'h', 'H':
+			if d.star || count > rest*2 {
+				count = rest * 2
+			}
+			buf := make([]byte, count)
+			var bits byte
+			for i := 0; i < count; i++ {
+				if i&1 != 0 {
+					if d.kind == 'h' {
+						bits >>= 4
+					} else {
+						bits <<= 4
+					}
+				} else {
+					bits = data[s]
+					s++
+				}
+				if d.kind == 'h' {
+					buf[i] = hexDigits[bits&15]
+				} else {
+					buf[i] = hexDigits[(bits>>4)&15]
+				}
+			}
+			values = append(values, NewString(string(buf)))
+		case 'U':
+			if count > rest {
+				count = rest
+			}
+			for ; count > 0 && s < len(data); count-- {
+				r, width := utf8.DecodeRuneInString(data[s:])
+				if r == utf8.RuneError && width <= 1 {
+					return nil, ArgumentError{"malformed UTF-8 character"}
+				}
+				values = append(values, uint64(r))
+				s += width
+			}
+		case 'w':
+			start := s
+			for ; count > 0 && s < len(data); s++ {
+				if data[s]&0x80 != 0 {
+					continue
+				}
+				n := new(big.Int)
+				for _, b := range []byte(data[start : s+1]) {
+					n.Lsh(n, 7)
+					n.Or(n, big.NewInt(int64(b&0x7F)))
+				}
+				if n.IsUint64() {
+					values = append(values, n.Uint64())
+				} else {
+					values = append(values, n)
+				}
+				count--
+				start = s + 1
+			}
+		case 'm':
+			if d.hasCount && d.count == 0 {
+				// the decoder skips line breaks even when strict
+				decoded, err := base64.StdEncoding.Strict().DecodeString(data[s:])
+				if err != nil || strings.ContainsAny(data[s:], "\r\n") {
+					return nil, ArgumentError{"invalid base64"}
+				}
+				values = append(values, NewString(string(decoded)))
+			} else {
+				values = append(values, NewString(decodeBase64(data[s:])))
+			}
+			s = len(data)
+		case 'M':
+			var decoded string
+			decoded, s = decodeQuotedPrintable(data, s)
+			values = append(values, NewString(decoded))
+		case 'u':
+			var decoded string
+			decoded, s = decodeUU(data, s)
+			values = append(values, NewString(decoded))
+		case 'x':
+			if count > rest {
+				return nil, ArgumentError{"x outside of string"}
+			}
+			s += count
+		case 'X':
+			if count > s {
+				return nil, ArgumentError{"X outside of string"}
+			}
+			s -= count
+		case '@':
+			if count > len(data) {
+				return nil, ArgumentError{"@ outside of string"}
+			}
+			s = count
+		}
+	}
+	return values, nil
+}
+
+func decodeBase64(data string) string {
+	var buf bytes.Buffer
+	at := func(i int) byte {
+		if i < len(data) {
+			return data[i]
+		}
+		return 0
+	}
+	a, b, c, d := -1, -1, -1, -1
+	s := 0
+	for s < len(data) {
+		a, b, c, d = -1, -1, -1, -1
+		for ; s < len(data); s++ {
+			if a = b64Value(data[s]); a >= 0 {
+				break
+			}
+		}
+		if s >= len(data) {
+			break
+		}
+		s++
+		for ; s < len(data); s++ {
+			if b = b64Value(data[s]); b >= 0 {
+				break
+			}
+		}
+		if s >= len(data) {
+			break
+		}
+		s++
+		for ; s < len(data) && data[s] != '='; s++ {
+			if c = b64Value(data[s]); c >= 0 {
+				break
+			}
+		}
+		if s >= len(data) || at(s) == '=' {
+			break
+		}
+		s++
+		for ; s < len(data) && data[s] != '='; s++ {
+			if d = b64Value(data[s]); d >= 0 {
+				break
+			}
+		}
+		if s >= len(data) || at(s) == '=' {
+			break
+		}
+		s++
+		buf.WriteByte(byte(a<<2 | b>>4))
+		buf.WriteByte(byte(b<<4 | c>>2))
+		buf.WriteByte(byte(c<<6 | d))
+		a = -1
+	}
+	if a >= 0 && b >= 0 {
+		buf.WriteByte(byte(a<<2 | b>>4))
+		if c >= 0 {
+			buf.WriteByte(byte(b<<4 | c>>2))
+		}
+	}
+	return buf.String()
+}
+
+func decodeQuotedPrintable(data string, s int) (string, int) {
+	var buf bytes.Buffer
+	ss := s
+	for s < len(data) {
+		if data[s] == '=' {
+			if s++; s == len(data) {
+				break
+			}
+			if s+1 < len(data) && data[s] == '\r' && data[s+1] == '\n' {
+				s++
+			}
+			if data[s] != '\n' {
+				c1 := hexValue(data[s])
+				if c1 < 0 {
+					break
+				}
+				if s++; s == len(data) {
+					break
+				}
+				c2 := hexValue(data[s])
+				if c2 < 0 {
+					break
+				}
+				buf.WriteByte(byte(c1<<4 | c2))
+			}
+		} else {
+			buf.WriteByte(data[s])
+		}
+		s++
+		ss = s
+	}
+	buf.WriteString(data[ss:])
+	return buf.String(), len(data)
+}
+
+func decodeUU(data string, s int) (string, int) {
+	var buf bytes.Buffer
+	next := func() int {
+		if s < len(data) && data[s] >= ' ' && data[s] < 'a' {
+			c := int(data[s]-' ') & 077
+			s++
+			return c
+		}
+		return 0
+	}
+	limit := (len(data) - s) * 3 / 4
+	for s < len(data) && data[s] > ' ' && data[s] < 'a' {
+		length := int(data[s]-' ') & 077
+		s++
+		if buf.Len()+length > limit {
+			length = limit - buf.Len()
+		}
+		for length > 0 {
+			a, b, c, d := next(), next(), next(), next()
+			hunk := []byte{byte(a<<2 | b>>4), byte(b<<4 | c>>2), byte(c<<6 | d)}
+			n := min(length, 3)
+			buf.Write(hunk[:n])
+			length -= n
+		}
+		if s < len(data) && data[s] != '\r' && data[s] != '\n' {
+			// possible checksum byte
+			s++
+		}
+		if s < len(data) && data[s] == '\r' {
+			s++
+		}
+		if s < len(data) && data[s] == '\n' {
+			s++
+		}
+	}
+	return buf.String(), s
+}
+
+func packString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case String:
+		return v.Value, nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", TypeError{"no implicit conversion of " + typeName(value) + " into String"}
+}
+
+func packInteger(value interface{}) (*big.Int, error) {
+	n, ok, err := integerValue(value)
+	if !ok {
+		return nil, TypeError{"no implicit conversion of " + typeName(value) + " into Integer"}
+	}
+	return n, err
+}
+
+// extendedUTF8 encodes n as Ruby's rb_uv_to_utf8 does: surrogates are
+// written as they are, and values past U+10FFFF in the original UTF-8 forms
+// of up to six bytes.
+func extendedUTF8(n int64) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	size := 2
+	for limit := int64(0x800); size < 6 && n >= limit; limit <<= 5 {
+		size++
+	}
+	b := make([]byte, size)
+	for i := size - 1; i > 0; i-- {
+		b[i] = 0x80 | byte(n&0x3F)
+		n >>= 6
+	}
+	b[0] = byte(0xFF<<(8-size)) | byte(n)
+	return b
+}
+
+func encodeUU(buf *bytes.Buffer, s string, table string, padding byte, tail bool) {
+	if table == uuTable {
+		buf.WriteByte(byte(len(s)) + ' ')
+	}
+	for ; len(s) >= 3; s = s[3:] {
+		buf.WriteByte(table[077&(s[0]>>2)])
+		buf.WriteByte(table[077&((s[0]<<4)&060|(s[1]>>4)&017)])
+		buf.WriteByte(table[077&((s[1]<<2)&074|(s[2]>>6)&03)])
+		buf.WriteByte(table[077&s[2]])
+	}
+	if len(s) == 2 {
+		buf.WriteByte(table[077&(s[0]>>2)])
+		buf.WriteByte(table[077&((s[0]<<4)&060|(s[1]>>4)&017)])
+		buf.WriteByte(table[077&((s[1]<<2)&074)])
+		buf.WriteByte(padding)
+	} else if len(s) == 1 {
+		buf.WriteByte(table[077&(s[0]>>2)])
+		buf.WriteByte(table[077&((s[0]<<4)&060)])
+		buf.WriteByte(padding)
+		buf.WriteByte(padding)
+	}
+	if tail {
+		buf.WriteByte('\n')
+	}
+}
+
+func encodeQuotedPrintable(buf *bytes.Buffer, s string, lineLen int) {
+	const upperHex = "0123456789ABCDEF"
+	n := 0
+	prev := -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c > 126 || (c < 32 && c != '\n' && c != '\t') || c == '=' {
+			buf.WriteByte('=')
+			buf.WriteByte(upperHex[c>>4])
+			buf.WriteByte(upperHex[c&15])
+			n += 3
+			prev = -1
+		} else if c == '\n' {
+			if prev == ' ' || prev == '\t' {
+				buf.WriteByte('=')
+				buf.WriteByte(c)
+			}
+			buf.WriteByte(c)
+			n = 0
+			prev = int(c)
+		} else {
+			buf.WriteByte(c)
+			n++
+			prev = int(c)
+		}
+		if n > lineLen {
+			buf.WriteString("=\n")
+			n = 0
+			prev = '\n'
+		}
+	}
+	if n > 0 {
+		buf.WriteString("=\n")
+	}
+}
+
+func Pack(template string, values ...interface{}) (String, error) {
+	directives, err := parsePackTemplate(template, false)
+	if err != nil {
+		return NewString(""), err
+	}
+	var buf bytes.Buffer
+	index := 0
+	next := func() (interface{}, error) {
+		if index >= len(values) {
+			return nil, ArgumentError{"too few arguments"}
+		}
+		index++
+		return values[index-1], nil
+	}
+
+	for _, d := range directives {
+		count := d.count
+		if d.star {
+			switch d.kind {
+			case '@', 'X', 'x', 'u':
+				count = 0
+			case 'M', 'm':
+				count = 1
+			default:
+				count = len(values) - index
+			}
+		}
+
+		if size, _, littleEndian, ok := d.integerLayout(); ok {
+			for ; count > 0; count-- {
+				value, err := next()
+				if err != nil {
+					return NewString(""), err
+				}
+				n, err := packInteger(value)
+				if err != nil {
+					return NewString(""), err
+				}
+				u := new(big.Int).And(n, new(big.Int).SetUint64(math.MaxUint64)).Uint64()
+				for i := 0; i < size; i++ {
+					shift := uint(8 * i)
+					if !littleEndian {
+						shift = uint(8 * (size - 1 - i))
+					}
+					buf.WriteByte(byte(u >> shift))
+				}
+			}
+			continue
+		}
+
+		if size, littleEndian, ok := d.floatLayout(); ok {
+			order := binary.ByteOrder(binary.BigEndian)
+			if littleEndian {
+				order = binary.LittleEndian
+			}
+			for ; count > 0; count-- {
+				value, err := next()
+				if err != nil {
+					return NewString(""), err
+				}
+				if _, isString := TryConvert(value); isString || value == nil {
+					return NewString(""), TypeError{"can't convert " + typeName(value) + " into Float"}
+				}
+				f, err := Float(value)
+				if err != nil {
+					return NewString(""), err
+				}
+				raw := make([]byte, size)
+				if size == 4 {
+					order.PutUint32(raw, math.Float32bits(float32(f)))
+				} else {
+					order.PutUint64(raw, math.Float64bits(f))
+				}
+				buf.Write(raw)
+			}
+			continue
+		}
+
+		switch d.kind {
+		case 'a', 'A', 'Z', 'b', 'B', 'h', 'H':
+			value, err := next()
+			if err != nil {
+				return NewString(""), err
+			}
+			s, err := packString(value)
+			if err != nil {
+				return NewString(""), err
+			}
+			if d.star {
+				count = len(s)
+			}
+			switch d.kind {
+			case 'a', 'A', 'Z':
+				if len(s) >= count {
+					buf.WriteString(s[:count])
+					if d.star && d.kind == 'Z' {
+						buf.WriteByte(0)
+					}
+				} else {
+					buf.WriteString(s)
+					fill := "\x00"
+					if d.kind == 'A' {
+						fill = " "
+					}
+					buf.WriteString(strings.Repeat(fill, count-len(s)))
+				}
+			case 'b', 'B':
+				grow := 0
+				if count > len(s) {
+					grow = (count+7)/8 - (len(s)+7)/8
+					count = len(s)
+				}
+				var bits byte
+				for i := 1; i <= count; i++ {
+					if d.kind == 'b' {
+						if s[i-1]&1 != 0 {
+							bits |= 128
+						}
+						if i&7 != 0 {
+							bits >>= 1
+							continue
+						}
+					} else {
+						bits |= s[i-1] & 1
+						if i&7 != 0 {
+							bits <<= 1
+							continue
+						}
+					}
+					buf.WriteByte(bits)
+					bits = 0
+				}
+				if count&7 != 0 {
+					if d.kind == 'b' {
+						bits >>= uint(7 - count&7)
+					} else {
+						bits <<= uint(7 - count&7)
+					}
+					buf.WriteByte(bits)
+				}
+				buf.Write(make([]byte, grow))
+			case 'h', 'H':
+				grow := 0
+				if count > len(s) {
+					grow = (count+1)/2 - (len(s)+1)/2
+					count = len(s)
+				}
+				var bits byte
+				for i := 1; i <= count; i++ {
+					c := s[i-1]
+					nibble := c & 15
+					if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+						nibble = ((c & 15) + 9) & 15
+					}
+					if d.kind == 'h' {
+						bits |= nibble << 4
+						if i&1 != 0 {
+							bits >>= 4
+							continue
+						}
+					} else {
+						bits |= nibble
+						if i&1 != 0 {
+							bits <<= 4
+							continue
+						}
+					}
+					buf.WriteByte(bits)
+					bits = 0
+				}
+				if count&1 != 0 {
+					buf.WriteByte(bits)
+				}
+				buf.Write(make([]byte, grow))
+			}
+		case 'U':
+			for ; count > 0; count-- {
+				value, err := next()
+				if err != nil {
+					return NewString(""), err
+				}
+				n, err := packInteger(value)
+				if err != nil {
+					return NewString(""), err
+				}
+				if n.Sign() < 0 || !n.IsInt64() || n.Int64() > 0x7FFFFFFF {
+					return NewString(""), RangeError{"pack(U): value out of range"}
+				}
+				buf.Write(extendedUTF8(n.Int64()))
+			}
+		case 'w':
+			for ; count > 0; count-- {
+				value, err := next()
+				if err != nil {
+					return NewString(""), err
+				}
+				n, err := packInteger(value)
+				if err != nil {
+					return NewString(""), err
+				}
+				if n.Sign() < 0 {
+					return NewString(""), ArgumentError{"can't compress negative numbers"}
+				}
+				groups := []byte{byte(n.Int64() & 0x7F)}
+				for rest := new(big.Int).Rsh(n, 7); rest.Sign() > 0; rest.Rsh(rest, 7) {
+					groups = append(groups, byte(new(big.Int).And(rest, big.NewInt(0x7F)).Int64())|0x80)
+				}
+				for i := len(groups) - 1; i >= 0; i-- {
+					buf.WriteByte(groups[i])
+				}
+			}
+		case 'm', 'u':
+			value, err := next()
+			if err != nil {
+				return NewString(""), err
+			}
+			s, err := packString(value)
+			if err != nil || value == nil {
+				return NewString(""), TypeError{"no implicit conversion of " + typeName(value) + " into String"}
+			}
+			table, padding := b64Table, byte('=')
+			if d.kind == 'u' {
+				table, padding = uuTable, '`'
+			}
+			if count == 0 && d.kind == 'm' {
+				encodeUU(&buf, s, table, padding, false)
+				break
+			}
+			if count <= 2 {
+				count = 45
+			} else if count > 63 && d.kind == 'u' {
+				count = 63
+			} else {
+				count = count / 3 * 3
+			}
+			for len(s) > 0 {
+				todo := min(len(s), count)
+				encodeUU(&buf, s[:todo], table, padding, true)
+				s = s[todo:]
+			}
+		case 'M':
+			value, err := next()
+			if err != nil {
+				return NewString(""), err
+			}
+			if count <= 1 {
+				count = 72
+			}
+			encodeQuotedPrintable(&buf, formatToS(value), count)
+		case 'x':
+			buf.Write(make([]byte, count))
+		case 'X':
+			if count > buf.Len() {
+				return NewString(""), ArgumentError{"X outside of string"}
+			}
+			buf.Truncate(buf.Len() - count)
+		case '@':
+			if count > buf.Len() {
+				buf.Write(make([]byte, count-buf.Len()))
+			} else {
+				buf.Truncate(count)
+			}
+		}
+	}
+	return NewString(buf.String()), nil
+}
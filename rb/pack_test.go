@@ -0,0 +1,125 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertPack(t *testing.T, expected string, template string, values ...interface{}) {
+	ret, err := Pack(template, values...)
+	assert.Nil(t, err, template)
+	assert.Equal(t, expected, ret.Value, template)
+}
+
+func assertUnpack(t *testing.T, expected []interface{}, str string, template string) {
+	ret, err := NewString(str).Unpack(NewString(template))
+	assert.Nil(t, err, template)
+	assert.Equal(t, expected, ret, template)
+}
+
+func TestPack(t *testing.T) {
+	assertPack(t, "\x01\x02", "C*", 1, 2)
+	assertPack(t, "\xFF", "c", -1)
+	assertPack(t, "\x00\x01", "s>", 1)
+	assertPack(t, "\x01\x00", "s<", 1)
+	assertPack(t, "\x01\x02", "n", 258)
+	assertPack(t, "\x01\x00\x00\x00", "V", 1)
+	assertPack(t, "\x00\x00\x00\x01", "N", 1)
+	assertPack(t, "\xFF\xFF\xFF\xFF\xFF\xFF\xFF\xFF", "Q>", -1)
+	assertPack(t, "abc\x00\x00", "a5", "abc")
+	assertPack(t, "abc  ", "A5", NewString("abc"))
+	assertPack(t, "abc\x00", "Z*", "abc")
+	assertPack(t, "ab", "a2", "abc")
+	assertPack(t, "abc", "H*", "616263")
+	assertPack(t, "\x16", "h2", "61")
+	assertPack(t, "a", "B*", "01100001")
+	assertPack(t, "a", "b*", "10000110")
+	assertPack(t, "€", "U", 0x20AC)
+	assertPack(t, "\xED\xA0\x80", "U", 0xD800)
+	assertPack(t, "\xF4\x90\x80\x80", "U", 0x110000)
+	assertPack(t, "\xFD\xBF\xBF\xBF\xBF\xBF", "U", 0x7FFFFFFF)
+	assertPack(t, "\x82\x2C", "w", 300)
+	assertPack(t, "YWJj\n", "m", "abc")
+	assertPack(t, "YWI=", "m0", "ab")
+	assertPack(t, "a=3Db=\n", "M", "a=b")
+	assertPack(t, "#86)C\n", "u", "abc")
+	assertPack(t, "a\x00\x00b", "ax2a", "a", "b")
+	assertPack(t, "a\x00b", "a3Xa", "a", "b")
+	assertPack(t, "a\x00\x00\x00b", "a@4a", "a", "b")
+	assertPack(t, "\x01\x00\x02\x00", "v # comment\n v", 1, 2)
+}
+
+func TestPack_Errors(t *testing.T) {
+	_, err := Pack("C2", 1)
+	assert.Equal(t, ArgumentError{"too few arguments"}, err, "too few arguments")
+
+	_, err = Pack("y", 1)
+	assert.Equal(t, ArgumentError{"unknown pack directive 'y' in 'y'"}, err, "unknown directive")
+
+	_, err = Pack("C", "1")
+	assert.Equal(t, TypeError{"no implicit conversion of String into Integer"}, err, "string as integer")
+
+	_, err = Pack("w", -1)
+	assert.Equal(t, ArgumentError{"can't compress negative numbers"}, err, "negative BER")
+
+	_, err = Pack("a_", "a")
+	assert.Equal(t, ArgumentError{"'_' allowed only after types sSiIlLqQjJ"}, err, "invalid modifier")
+}
+
+func TestString_Unpack(t *testing.T) {
+	assertUnpack(t, []interface{}{uint64(1), uint64(2), nil}, "\x01\x02", "C3")
+	assertUnpack(t, []interface{}{int64(-1)}, "\xFF", "c")
+	assertUnpack(t, []interface{}{int64(-2)}, "\xFF\xFE", "s>")
+	assertUnpack(t, []interface{}{uint64(258), uint64(513)}, "\x01\x02\x01\x02", "nv")
+	assertUnpack(t, []interface{}{uint64(1)}, "\x00\x00\x00\x01", "L>")
+	assertUnpack(t, []interface{}{NewString("abc ")}, "abc ", "a*")
+	assertUnpack(t, []interface{}{NewString("abc")}, "abc \x00", "A*")
+	assertUnpack(t, []interface{}{NewString("ab"), NewString("c")}, "ab\x00c", "Z*Z*")
+	assertUnpack(t, []interface{}{NewString("616263")}, "abc", "H*")
+	assertUnpack(t, []interface{}{NewString("162636")}, "abc", "h*")
+	assertUnpack(t, []interface{}{NewString("01100001")}, "a", "B*")
+	assertUnpack(t, []interface{}{NewString("100")}, "a", "b3")
+	assertUnpack(t, []interface{}{uint64(0x20AC), uint64('a')}, "€a", "U*")
+	assertUnpack(t, []interface{}{uint64(300), uint64(1)}, "\x82\x2C\x01", "w*")
+	assertUnpack(t, []interface{}{NewString("abc")}, "YWJj\n", "m")
+	assertUnpack(t, []interface{}{NewString("ab")}, "YW\nI=", "m")
+	assertUnpack(t, []interface{}{NewString("a=b")}, "a=3Db=\n", "M")
+	assertUnpack(t, []interface{}{NewString("abc")}, "#86)C\n", "u")
+	assertUnpack(t, []interface{}{NewString("cd")}, "abcdef", "x2a2")
+	assertUnpack(t, []interface{}{NewString("ab"), NewString("b")}, "abc", "a2Xa")
+	assertUnpack(t, []interface{}{NewString("d")}, "abcdef", "@3a")
+	assertUnpack(t, []interface{}{1.5}, "\x00\x00\xC0\x3F", "e")
+}
+
+func TestString_UnpackErrors(t *testing.T) {
+	_, err := NewString("abc").Unpack(NewString("x4"))
+	assert.Equal(t, ArgumentError{"x outside of string"}, err, "x outside of string")
+
+	_, err = NewString("YWJ").Unpack(NewString("m0"))
+	assert.Equal(t, ArgumentError{"invalid base64"}, err, "strict base64")
+	_, err = NewString("aGVs\nbG8=").Unpack(NewString("m0"))
+	assert.Equal(t, ArgumentError{"invalid base64"}, err, "strict base64 rejects line breaks")
+	_, err = NewString("aGVsbG8=\r").Unpack(NewString("m0"))
+	assert.Equal(t, ArgumentError{"invalid base64"}, err, "strict base64 rejects carriage returns")
+
+	_, err = NewString("\xFF").Unpack(NewString("U"))
+	assert.Equal(t, ArgumentError{"malformed UTF-8 character"}, err, "malformed UTF-8")
+}
+
+func TestString_Unpack1(t *testing.T) {
+	ret, err := NewString("\x01\x02").Unpack1(NewString("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(258), ret, "first value")
+}
+
+func TestPack_RoundTrip(t *testing.T) {
+	template := "C s> L< q> a4 Z* H4 B8 U w m"
+	values := []interface{}{uint64(200), int64(-300), uint64(70000), int64(-5), NewString("ab\x00\x00"),
+		NewString("zed"), NewString("beef"), NewString("10100101"), uint64(0x1F600), uint64(1 << 40),
+		NewString("binary\xFF\x00")}
+	packed, err := Pack(template, values...)
+	assert.Nil(t, err)
+	unpacked, err := packed.Unpack(NewString(template))
+	assert.Nil(t, err)
+	assert.Equal(t, values, unpacked, "round trip")
+}
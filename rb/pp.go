@@ -0,0 +1,311 @@
+package rb
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrettyPrintable is implemented by values that lay themselves out on a
+// PrettyPrinter, as Ruby objects do in pretty_print.
+type PrettyPrintable interface {
+	PrettyPrint(q *PrettyPrinter)
+}
+
+type ppKind int
+
+const (
+	ppText ppKind = iota
+	ppBreakable
+	ppGroup
+	ppNest
+)
+
+type ppDoc struct {
+	kind   ppKind
+	text   string
+	indent int
+	docs   []*ppDoc
+}
+
+// PrettyPrinter collects text, breakables, groups and nests, and lays them
+// out in Wadler's fashion: a group whose content does not fit on the rest
+// of the line has all of its own breakables turned into line breaks.
+type PrettyPrinter struct {
+	width   int
+	root    *ppDoc
+	current *ppDoc
+	in      inspector
+}
+
+func NewPrettyPrinter(width int) *PrettyPrinter {
+	root := &ppDoc{kind: ppGroup}
+	return &PrettyPrinter{width, root, root, inspector{map[visit]bool{}}}
+}
+
+func (q *PrettyPrinter) add(doc *ppDoc) {
+	q.current.docs = append(q.current.docs, doc)
+}
+
+func (q *PrettyPrinter) within(doc *ppDoc, body func()) {
+	q.add(doc)
+	outer := q.current
+	q.current = doc
+	defer func() { q.current = outer }()
+	body()
+}
+
+func (q *PrettyPrinter) Text(s string) {
+	q.add(&ppDoc{kind: ppText, text: s})
+}
+
+// Breakable is sep when its group fits on the line, and a line break
+// followed by the current indentation otherwise.
+func (q *PrettyPrinter) Breakable(sep string) {
+	q.add(&ppDoc{kind: ppBreakable, text: sep})
+}
+
+func (q *PrettyPrinter) CommaBreakable() {
+	q.Text(",")
+	q.Breakable(" ")
+}
+
+// Group writes open, then body as one group indented by indent, then close.
+func (q *PrettyPrinter) Group(indent int, open, close string, body func()) {
+	q.Text(open)
+	q.within(&ppDoc{kind: ppGroup}, func() {
+		q.Nest(indent, body)
+	})
+	q.Text(close)
+}
+
+// Nest indents the line breaks in body by indent more columns.
+func (q *PrettyPrinter) Nest(indent int, body func()) {
+	q.within(&ppDoc{kind: ppNest, indent: indent}, body)
+}
+
+// Seplist calls each for 0 to n-1, calling sep between them; a nil sep is
+// CommaBreakable.
+func (q *PrettyPrinter) Seplist(n int, sep func(), each func(i int)) {
+	if sep == nil {
+		sep = q.CommaBreakable
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sep()
+		}
+		each(i)
+	}
+}
+
+// PP lays value out as Ruby's pp does. Slices, arrays, maps and structs are
+// broken across lines when they do not fit, values implementing
+// PrettyPrintable lay themselves out and everything else is written as
+// Inspect writes it.
+func (q *PrettyPrinter) PP(value interface{}) {
+	q.pp(reflect.ValueOf(value))
+}
+
+func (q *PrettyPrinter) pp(v reflect.Value) {
+	if v.IsValid() && v.CanInterface() {
+		if value, ok := v.Interface().(PrettyPrintable); ok && !isNilValue(v) {
+			value.PrettyPrint(q)
+			return
+		}
+	}
+	if s, ok := inspectAtom(v); ok {
+		q.Text(s)
+		return
+	}
+	visiting := q.in.visiting
+	switch v.Kind() {
+	case reflect.Interface:
+		q.pp(v.Elem())
+	case reflect.Ptr:
+		key := visit{v.Pointer(), v.Type(), 0}
+		if visiting[key] {
+			q.Text(q.in.inspect(v))
+			return
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		q.pp(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			key := visit{v.Pointer(), v.Type(), v.Len()}
+			if visiting[key] {
+				q.Text("[...]")
+				return
+			}
+			visiting[key] = true
+			defer delete(visiting, key)
+		}
+		q.Group(1, "[", "]", func() {
+			q.Seplist(v.Len(), nil, func(i int) {
+				q.pp(v.Index(i))
+			})
+		})
+	case reflect.Map:
+		key := visit{v.Pointer(), v.Type(), 0}
+		if visiting[key] {
+			q.Text("{...}")
+			return
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return q.in.inspect(keys[i]) < q.in.inspect(keys[j]) })
+		q.Group(1, "{", "}", func() {
+			q.Seplist(len(keys), nil, func(i int) {
+				q.pp(keys[i])
+				q.Text(" =>")
+				q.Group(1, "", "", func() {
+					q.Breakable(" ")
+					q.pp(v.MapIndex(keys[i]))
+				})
+			})
+		})
+	case reflect.Struct:
+		open := "#<struct"
+		if name := v.Type().Name(); name != "" {
+			open += " " + name
+		}
+		var fields []int
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fields = append(fields, i)
+			}
+		}
+		q.Group(1, open, ">", func() {
+			q.Seplist(len(fields), func() { q.Text(",") }, func(i int) {
+				q.Breakable(" ")
+				q.Text(v.Type().Field(fields[i]).Name + "=")
+				q.Group(1, "", "", func() {
+					q.Breakable("")
+					q.pp(v.Field(fields[i]))
+				})
+			})
+		})
+	default:
+		q.Text(q.in.inspect(v))
+	}
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+type ppCommand struct {
+	indent int
+	flat   bool
+	doc    *ppDoc
+}
+
+// ppPush queues the contents of doc in reverse, so that they pop in order.
+func ppPush(commands []ppCommand, indent int, flat bool, doc *ppDoc) []ppCommand {
+	if doc.kind == ppNest {
+		indent += doc.indent
+	}
+	for i := len(doc.docs) - 1; i >= 0; i-- {
+		commands = append(commands, ppCommand{indent, flat, doc.docs[i]})
+	}
+	return commands
+}
+
+// ppFits reports whether c, laid out flat, and then the commands, with the
+// last popped first, reach a line break before running out of width. The
+// commands are only read; groups on the way are expanded on a stack of
+// their own.
+func ppFits(width int, c ppCommand, commands []ppCommand) bool {
+	stack := []ppCommand{c}
+	rest := len(commands)
+	for width >= 0 {
+		if len(stack) > 0 {
+			c = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		} else if rest > 0 {
+			rest--
+			c = commands[rest]
+		} else {
+			return true
+		}
+		switch c.doc.kind {
+		case ppText:
+			width -= utf8.RuneCountInString(c.doc.text)
+		case ppBreakable:
+			if !c.flat {
+				return true
+			}
+			width -= utf8.RuneCountInString(c.doc.text)
+		case ppGroup:
+			stack = ppPush(stack, c.indent, true, c.doc)
+		case ppNest:
+			stack = ppPush(stack, c.indent, c.flat, c.doc)
+		}
+	}
+	return false
+}
+
+// String lays out what has been written so far.
+func (q *PrettyPrinter) String() string {
+	var buf strings.Builder
+	column := 0
+	commands := []ppCommand{{0, false, q.root}}
+	for len(commands) > 0 {
+		c := commands[len(commands)-1]
+		commands = commands[:len(commands)-1]
+		switch c.doc.kind {
+		case ppText:
+			buf.WriteString(c.doc.text)
+			column += utf8.RuneCountInString(c.doc.text)
+		case ppBreakable:
+			if c.flat {
+				buf.WriteString(c.doc.text)
+				column += utf8.RuneCountInString(c.doc.text)
+			} else {
+				buf.WriteString("\n" + strings.Repeat(" ", c.indent))
+				column = c.indent
+			}
+		case ppGroup:
+			flat := c.flat || ppFits(q.width-column, ppCommand{c.indent, true, c.doc}, commands)
+			commands = ppPush(commands, c.indent, flat, c.doc)
+		case ppNest:
+			commands = ppPush(commands, c.indent, c.flat, c.doc)
+		}
+	}
+	return buf.String()
+}
+
+// PrettyInspect lays value out as PP does, in lines of width columns.
+func PrettyInspect(value interface{}, width int) string {
+	q := NewPrettyPrinter(width)
+	q.PP(value)
+	return q.String()
+}
+
+// PP prints each value as Ruby's pp does, breaking it across lines of 79
+// columns, and returns nil, the only value or all of them.
+func PP(values ...interface{}) interface{} {
+	return PPWidth(79, values...)
+}
+
+// PPWidth is PP with lines of width columns.
+func PPWidth(width int, values ...interface{}) interface{} {
+	for _, value := range values {
+		fmt.Fprintln(os.Stdout, PrettyInspect(value, width))
+	}
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	}
+	return values
+}
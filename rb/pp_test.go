@@ -0,0 +1,128 @@
+package rb
+
+import (
+	"testing"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+type ppPoint struct {
+	X, Y int
+}
+
+type ppTree struct {
+	Name     string
+	Children []*ppTree
+	Parent   *ppTree
+}
+
+type ppCustom struct {
+	items []string
+}
+
+func (c ppCustom) PrettyPrint(q *PrettyPrinter) {
+	q.Group(2, "<custom", ">", func() {
+		for _, item := range c.items {
+			q.Breakable(" ")
+			q.Text(item)
+		}
+	})
+}
+
+func TestPrettyInspect(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		width    int
+		expected string
+	}{
+		{[]int{1, 2, 3}, 79, "[1, 2, 3]"},
+		{[]int{1, 2, 3}, 8, "[1,\n 2,\n 3]"},
+		{[][]int{{1, 2}, {3, 4}}, 10, "[[1, 2],\n [3, 4]]"},
+		{[][]int{{1, 2}, {3, 4}}, 7, "[[1,\n  2],\n [3,\n  4]]"},
+		{map[string]int{"b": 2, "a": 1}, 79, `{"a" => 1, "b" => 2}`},
+		{map[string]int{"b": 2, "a": 1}, 12, "{\"a\" => 1,\n \"b\" => 2}"},
+		{map[string][]int{"key": {1, 2, 3}}, 12, "{\"key\" =>\n  [1, 2, 3]}"},
+		{map[string]int{}, 79, "{}"},
+		{ppPoint{1, 2}, 79, "#<struct ppPoint X=1, Y=2>"},
+		{ppPoint{1, 2}, 12, "#<struct ppPoint\n X=1,\n Y=2>"},
+		{struct{ A []string }{[]string{"xxxx", "yyyy"}}, 12, "#<struct\n A=\n  [\"xxxx\",\n   \"yyyy\"]>"},
+		{NewRange(1, 10), 79, "1..10"},
+		{NewStringRangeExclusive(NewString("a"), NewString("z")), 79, `"a"..."z"`},
+		{[]interface{}{NewStringRange(NewString("aaaa"), NewString("zzzz"))}, 10, "[\"aaaa\"\n ..\n \"zzzz\"]"},
+		{ppCustom{[]string{"a", "b"}}, 79, "<custom a b>"},
+		{ppCustom{[]string{"aaa", "bbb"}}, 8, "<custom\n  aaa\n  bbb>"},
+		{"日本語", 3, `"日本語"`},
+		{nil, 79, "nil"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, PrettyInspect(test.input, test.width), "PrettyInspect(%#v, %d)", test.input, test.width)
+	}
+}
+
+func TestPrettyInspect_MatchData(t *testing.T) {
+	_, m := NewString("foo bar").OpMatch(MustCompileRegexp(`(?<first>\w+) (?<second>\w+)`))
+	assert.Equal(t, `#<MatchData "foo bar" first:"foo" second:"bar">`, PrettyInspect(m, 79), "fits")
+	assert.Equal(t, "#<MatchData\n \"foo bar\"\n first:\"foo\"\n second:\"bar\">", PrettyInspect(m, 20), "broken")
+}
+
+func TestPrettyInspect_Recursive(t *testing.T) {
+	root := &ppTree{Name: "root"}
+	root.Children = []*ppTree{{Name: "leaf", Parent: root}}
+	expected := strings.Join([]string{
+		`#<struct ppTree`,
+		` Name="root",`,
+		` Children=`,
+		`  [#<struct ppTree`,
+		`    Name="leaf",`,
+		`    Children=nil,`,
+		`    Parent=#<struct ppTree:...>>],`,
+		` Parent=nil>`,
+	}, "\n")
+	assert.Equal(t, expected, PrettyInspect(root, 40), "recursive struct")
+
+	list := []interface{}{1, nil}
+	list[1] = list
+	assert.Equal(t, "[1, [...]]", PrettyInspect(list, 79), "recursive slice")
+}
+
+func TestPrettyInspect_Long(t *testing.T) {
+	values := make([]map[string]int, 5000)
+	for i := range values {
+		values[i] = map[string]int{"a": i}
+	}
+	start := time.Now()
+	lines := strings.Split(PrettyInspect(values, 79), "\n")
+	assert.Less(t, time.Since(start), time.Second, "groups are measured without copying the rest")
+	assert.Equal(t, 5000, len(lines), "one element per line")
+	assert.Equal(t, ` {"a" => 4999}]`, lines[4999], "last element")
+}
+
+func TestPrettyPrinter(t *testing.T) {
+	q := NewPrettyPrinter(10)
+	q.Text("call(")
+	q.Nest(2, func() {
+		q.Seplist(3, nil, func(i int) {
+			q.Text(strings.Repeat("x", i+1))
+		})
+	})
+	q.Text(")")
+	assert.Equal(t, "call(x,\n  xx,\n  xxx)", q.String(), "top level breakables break when the line is full")
+}
+
+func TestPP(t *testing.T) {
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	value := PPWidth(5, []int{1, 2})
+	PP([]int{1, 2})
+	PP()
+	w.Close()
+	os.Stdout = stdout
+	output, _ := io.ReadAll(r)
+
+	assert.Equal(t, "[1,\n 2]\n[1, 2]\n", string(output), "output")
+	assert.Equal(t, []int{1, 2}, value, "PPWidth returns its value")
+}
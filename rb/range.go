@@ -1,173 +1,533 @@
 package rb
 
 import (
-	"bytes"
-	"strconv"
-	"fmt"
+	"cmp"
+	"math"
+	"math/big"
+	"reflect"
 )
 
-type Range struct {
-	first, last int
+// Comparable is the comparison protocol of Range endpoints other than int,
+// int64, uint64, float64, *big.Int and String. time.Time satisfies it.
+type Comparable[T any] interface {
+	Compare(other T) int
+}
+
+// Successor lets a Range iterate over endpoints other than int, int64,
+// uint64 and *big.Int. String satisfies it.
+type Successor[T any] interface {
+	Succ() T
+}
+
+// Range is a Ruby range between two endpoints of the same type. Endpoints
+// are compared as Ruby's <=> compares them, and a range is only iterable
+// when its endpoint type has a successor.
+type Range[T any] struct {
+	first, last T
 	excludeEnd  bool
 }
 
-func NewRange(begin, end int) Range {
-	return Range{begin, end, false}
+// NewRange panics when begin and end cannot be compared, as for a NaN.
+func NewRange[T any](begin, end T) Range[T] {
+	if _, ok := compareValues(begin, end); !ok {
+		panic("bad value for range")
+	}
+	return Range[T]{begin, end, false}
+}
+
+func NewRangeExclusive[T any](begin, end T) Range[T] {
+	r := NewRange(begin, end)
+	r.excludeEnd = true
+	return r
+}
+
+// compareValues compares a with b, reporting false when they cannot be
+// compared.
+func compareValues[T any](a, b T) (int, bool) {
+	switch x := any(a).(type) {
+	case int:
+		return cmp.Compare(x, any(b).(int)), true
+	case int64:
+		return cmp.Compare(x, any(b).(int64)), true
+	case uint64:
+		return cmp.Compare(x, any(b).(uint64)), true
+	case float64:
+		y := any(b).(float64)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return 0, false
+		}
+		return cmp.Compare(x, y), true
+	case *big.Int:
+		y := any(b).(*big.Int)
+		if x == nil || y == nil {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case String:
+		return x.OpSpaceShip(any(b).(String)), true
+	case Comparable[T]:
+		return x.Compare(b), true
+	}
+	return 0, false
+}
+
+func equalValues[T any](a, b T) bool {
+	if x, ok := any(a).(String); ok {
+		return x.IsEql(any(b).(String))
+	}
+	c, ok := compareValues(a, b)
+	return ok && c == 0
+}
+
+func successor[T any](value T) (T, bool) {
+	var next interface{}
+	switch x := any(value).(type) {
+	case int:
+		next = x + 1
+	case int64:
+		next = x + 1
+	case uint64:
+		next = x + 1
+	case *big.Int:
+		next = new(big.Int).Add(x, big.NewInt(1))
+	case Successor[T]:
+		return x.Succ(), true
+	default:
+		return value, false
+	}
+	return next.(T), true
+}
+
+// integerEndpoint copies an integer endpoint into a *big.Int.
+func integerEndpoint(value interface{}) (*big.Int, bool) {
+	switch x := value.(type) {
+	case int:
+		return big.NewInt(int64(x)), true
+	case int64:
+		return big.NewInt(x), true
+	case uint64:
+		return new(big.Int).SetUint64(x), true
+	case *big.Int:
+		return new(big.Int).Set(x), true
+	}
+	return nil, false
 }
 
-func NewRangeExclusive(begin, end int) Range {
-	return Range{begin, end, true}
+func fromInteger[T any](n *big.Int) T {
+	var value interface{}
+	var zero T
+	switch any(zero).(type) {
+	case int:
+		value = int(n.Int64())
+	case int64:
+		value = n.Int64()
+	case uint64:
+		value = n.Uint64()
+	default:
+		value = new(big.Int).Set(n)
+	}
+	return value.(T)
+}
+
+// numericValue converts any Go number or *big.Int to an exact *big.Float,
+// so that numbers of different types compare as they do in Ruby.
+func numericValue(value interface{}) (*big.Float, bool) {
+	if n, ok := value.(*big.Int); ok {
+		if n == nil {
+			return nil, false
+		}
+		return new(big.Float).SetInt(n), true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Float).SetUint64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) {
+			return nil, false
+		}
+		return big.NewFloat(v.Float()), true
+	}
+	return nil, false
 }
 
-func (r Range) OpEquals(obj interface{}) bool {
+// rangeValue converts obj to an endpoint of type T; strings convert to
+// String.
+func rangeValue[T any](obj interface{}) (T, bool) {
+	if value, ok := obj.(T); ok {
+		return value, true
+	}
+	var zero T
+	if _, ok := any(zero).(String); ok {
+		if str, ok := TryConvert(obj); ok {
+			return any(str).(T), true
+		}
+	}
+	return zero, false
+}
+
+func (r Range[T]) isNumeric() bool {
+	switch any(r.first).(type) {
+	case int, int64, uint64, float64, *big.Int:
+		return true
+	}
+	return false
+}
+
+func (r Range[T]) OpEquals(obj interface{}) bool {
 	return r.IsEql(obj)
 }
 
-func (r Range) OpCaseEquals(obj interface{}) bool {
+func (r Range[T]) OpCaseEquals(obj interface{}) bool {
 	return r.IsCover(obj)
 }
 
-func (r Range) actualEnd() int {
-	if r.excludeEnd {
-		return r.last - 1
+// Bsearch finds the smallest value for which pred is true, given that pred
+// is false up to some value and true from there on. It works on integer
+// and float ranges.
+func (r Range[T]) Bsearch(pred func(T) bool) (T, bool) {
+	return r.bsearch(func(value T) (int, bool) {
+		if pred(value) {
+			return -1, true
+		}
+		return 1, false
+	})
+}
+
+// BsearchAny finds any value for which pred returns 0, given that pred is
+// positive below those values and negative above them.
+func (r Range[T]) BsearchAny(pred func(T) int) (T, bool) {
+	return r.bsearch(func(value T) (int, bool) {
+		c := pred(value)
+		return c, c == 0
+	})
+}
+
+// floatKey maps floats to integers of the same order.
+func floatKey(f float64) *big.Int {
+	k := int64(math.Float64bits(f))
+	if k < 0 {
+		k = math.MinInt64 - k
 	}
-	return r.last
+	return big.NewInt(k)
 }
 
-func (r Range) Bsearch(pred func(int) bool) (ret int, found bool) {
-	begin, end := r.first, r.actualEnd()
-	if begin > end {
-		return
+func keyFloat(key *big.Int) float64 {
+	k := key.Int64()
+	if k < 0 {
+		k = math.MinInt64 - k
 	}
-	if pred(begin) {
-		ret = begin
-		found = true
-		return
+	return math.Float64frombits(uint64(k))
+}
+
+// bsearch searches the values of the range, where probe tells whether a
+// value is a hit and which way to go on from it, 0 meaning stop.
+func (r Range[T]) bsearch(probe func(T) (int, bool)) (found T, ok bool) {
+	var lo, hi *big.Int
+	var valueAt func(*big.Int) T
+	if first, isFloat := any(r.first).(float64); isFloat {
+		lo, hi = floatKey(first), floatKey(any(r.last).(float64))
+		valueAt = func(key *big.Int) T { return any(keyFloat(key)).(T) }
+	} else if begin, isInteger := integerEndpoint(r.first); isInteger {
+		lo = begin
+		hi, _ = integerEndpoint(r.last)
+		valueAt = fromInteger[T]
+	} else {
+		panic("can't do binary search for " + typeName(r.first))
 	}
-	if !pred(end) {
-		return
+	if r.excludeEnd {
+		hi.Sub(hi, big.NewInt(1))
 	}
-	for begin < end {
-		mid := begin + (end-begin)/2
-		if pred(mid) {
-			end = mid
+	for lo.Cmp(hi) <= 0 {
+		mid := new(big.Int).Add(lo, hi)
+		mid.Rsh(mid, 1)
+		value := valueAt(mid)
+		direction, hit := probe(value)
+		if hit {
+			found, ok = value, true
+		}
+		if direction == 0 {
+			break
+		}
+		if direction < 0 {
+			hi = mid.Sub(mid, big.NewInt(1))
 		} else {
-			begin = mid + 1
+			lo = mid.Add(mid, big.NewInt(1))
 		}
 	}
-	return begin, true
+	return
 }
 
-func (r Range) BsearchAny(pred func(int) int) (int, bool) {
-	return r.Bsearch(func(i int) bool {
-		return pred(i) == 0
-	})
+// IsCover reports whether obj lies between the endpoints. Numbers of any
+// type are compared with numeric ranges, and strings with String ranges.
+func (r Range[T]) IsCover(obj interface{}) bool {
+	if r.isNumeric() {
+		value, ok := numericValue(obj)
+		if !ok {
+			return false
+		}
+		first, _ := numericValue(r.first)
+		last, _ := numericValue(r.last)
+		c := value.Cmp(last)
+		return first.Cmp(value) <= 0 && (c < 0 || c == 0 && !r.excludeEnd)
+	}
+	value, ok := rangeValue[T](obj)
+	return ok && r.covers(value)
 }
 
-func (r Range) IsCover(obj interface{}) bool {
-	if rhs, ok := obj.(int); ok {
-		return rhs >= r.first && (rhs < r.last || (rhs == r.last && !r.excludeEnd))
+func (r Range[T]) covers(value T) bool {
+	lower, ok := compareValues(r.first, value)
+	if !ok || lower > 0 {
+		return false
 	}
-	return false
+	upper, ok := compareValues(value, r.last)
+	return ok && (upper < 0 || upper == 0 && !r.excludeEnd)
 }
 
-func (r Range) IsEmpty() bool {
-	return r.Size() == 0
+func (r Range[T]) IsEmpty() bool {
+	c, _ := compareValues(r.first, r.last)
+	return c > 0 || c == 0 && r.excludeEnd
 }
 
-func (r Range) Each(action func(int)) {
-	defer RecoverBreak("")
-	for i, end := r.first, r.actualEnd(); i <= end; i++ {
-		action(i)
+func (r Range[T]) each(action func(T)) {
+	if first, ok := any(r.first).(String); ok {
+		stringUpto(first, any(r.last).(String), r.excludeEnd, func(s String) {
+			action(any(s).(T))
+		})
+		return
 	}
+	if _, ok := successor(r.first); !ok {
+		panic("can't iterate from " + typeName(r.first))
+	}
+	for current := r.first; ; current, _ = successor(current) {
+		c, _ := compareValues(current, r.last)
+		if c > 0 || c == 0 && r.excludeEnd {
+			return
+		}
+		action(current)
+		if c == 0 {
+			return
+		}
+	}
+}
+
+// Each panics when the endpoint type has no successor.
+func (r Range[T]) Each(action func(T)) {
+	defer RecoverBreak("")
+	r.each(action)
 }
 
-func (r Range) IsEql(obj interface{}) bool {
-	if rhs, ok := obj.(Range); ok {
-		return r == rhs
+func (r Range[T]) IsEql(obj interface{}) bool {
+	if rhs, ok := obj.(Range[T]); ok {
+		return equalValues(r.first, rhs.first) && equalValues(r.last, rhs.last) && r.excludeEnd == rhs.excludeEnd
 	}
 	return false
 }
 
-func (r Range) ExcludeEnd() bool {
+func (r Range[T]) ExcludeEnd() bool {
 	return r.excludeEnd
 }
 
-func (r Range) First() int {
+func (r Range[T]) First() T {
 	return r.first
 }
 
-func (r Range) FirstSlice(limit int) []int {
-	ret := make([]int, 0, limit)
-	for count, i, end := 0, r.first, r.actualEnd(); count < limit && i <= end; i++ {
-		ret = append(ret, i)
-		count++
+func (r Range[T]) FirstSlice(limit int) []T {
+	ret := make([]T, 0, max(min(limit, 16), 0))
+	if limit <= 0 {
+		return ret
 	}
+	Label("first", func() {
+		r.each(func(value T) {
+			ret = append(ret, value)
+			if len(ret) == limit {
+				BreakLabel("first")
+			}
+		})
+	})
 	return ret
 }
 
-func (r Range) IsInclude(obj interface{}) bool {
-	return r.IsCover(obj)
+// IsInclude is IsCover for numeric ranges and ranges that cannot be
+// iterated, such as time ranges, and otherwise looks for obj among the
+// values of the range.
+func (r Range[T]) IsInclude(obj interface{}) bool {
+	if r.isNumeric() {
+		return r.IsCover(obj)
+	}
+	value, ok := rangeValue[T](obj)
+	if !ok {
+		return false
+	}
+	if _, ok := successor(r.first); !ok {
+		return r.covers(value)
+	}
+	if first, ok := any(r.first).(String); ok && isAsciiChar(first) && isAsciiChar(any(r.last).(String)) {
+		return isAsciiChar(any(value).(String)) && r.covers(value)
+	}
+	found := false
+	Label("include", func() {
+		r.each(func(v T) {
+			if equalValues(v, value) {
+				found = true
+				BreakLabel("include")
+			}
+		})
+	})
+	return found
 }
 
-func (r Range) Inspect() string {
+func (r Range[T]) Inspect() string {
 	if r.excludeEnd {
-		return fmt.Sprintf("%d...%d", r.first, r.last)
+		return Inspect(r.first) + "..." + Inspect(r.last)
+	}
+	return Inspect(r.first) + ".." + Inspect(r.last)
+}
+
+func (r Range[T]) PrettyPrint(q *PrettyPrinter) {
+	q.PP(r.first)
+	q.Breakable("")
+	if r.excludeEnd {
+		q.Text("...")
 	} else {
-		return fmt.Sprintf("%d..%d", r.first, r.last)
+		q.Text("..")
 	}
+	q.Breakable("")
+	q.PP(r.last)
 }
 
-func (r Range) Last() int {
+func (r Range[T]) Last() T {
 	return r.last
 }
 
-func (r Range) Max() (max int, ok bool) {
-	last := r.actualEnd()
-	return last, r.First() <= last
+// extreme returns the greatest value of the range for a positive sign and
+// the least for a negative one.
+func (r Range[T]) extreme(sign int) (value T, ok bool) {
+	r.each(func(v T) {
+		if c, _ := compareValues(v, value); !ok || c*sign > 0 {
+			value, ok = v, true
+		}
+	})
+	return
 }
 
-func (r Range) IsMember(obj interface{}) bool {
-	return r.IsCover(obj)
+// Max is the end of the range, or the value before it when the end is
+// excluded, which only integer ranges and iterable ranges have.
+func (r Range[T]) Max() (max T, ok bool) {
+	if r.excludeEnd && !r.isNumeric() {
+		return r.extreme(1)
+	}
+	c, _ := compareValues(r.first, r.last)
+	if c > 0 {
+		return
+	}
+	if !r.excludeEnd {
+		return r.last, true
+	}
+	end, isInteger := integerEndpoint(r.last)
+	if !isInteger {
+		panic("cannot exclude non Integer end value")
+	}
+	if c == 0 {
+		return
+	}
+	return fromInteger[T](end.Sub(end, big.NewInt(1))), true
 }
 
-func (r Range) Min() (min int, ok bool) {
-	min = r.first
-	ok = r.first <= r.actualEnd()
-	return
+func (r Range[T]) IsMember(obj interface{}) bool {
+	return r.IsInclude(obj)
 }
 
-func (r Range) Size() int {
-	size := r.actualEnd() - r.first + 1
-	if size < 0 {
-		size = 0
+func (r Range[T]) Min() (min T, ok bool) {
+	if r.excludeEnd && !r.isNumeric() {
+		return r.extreme(-1)
+	}
+	if r.IsEmpty() {
+		return
 	}
-	return size
+	return r.first, true
 }
 
-func (r Range) Step(step int, action func(int)) {
+// Size counts the values of an integer range. It is unknown for non-numeric
+// ranges, and a float range panics as it cannot be iterated.
+func (r Range[T]) Size() (*big.Int, bool) {
+	if _, ok := any(r.first).(float64); ok {
+		panic("can't iterate from float64")
+	}
+	begin, ok := integerEndpoint(r.first)
+	if !ok {
+		return nil, false
+	}
+	size, _ := integerEndpoint(r.last)
+	size.Sub(size, begin)
+	if !r.excludeEnd {
+		size.Add(size, big.NewInt(1))
+	}
+	if size.Sign() < 0 {
+		size.SetInt64(0)
+	}
+	return size, true
+}
+
+// Step yields every step-th value. Float ranges add multiples of step to
+// the beginning; other ranges panic unless they are iterable.
+func (r Range[T]) Step(step int, action func(T)) {
+	if step < 0 {
+		panic("Step can't be negative")
+	} else if step == 0 {
+		panic("Step can't be 0")
+	}
 	defer RecoverBreak("")
-	for i, end := r.first, r.actualEnd(); i < end; i += step {
-		action(i)
+	if first, ok := any(r.first).(float64); ok {
+		last := any(r.last).(float64)
+		for i := 0; ; i++ {
+			value := first + float64(i)*float64(step)
+			if value > last || value == last && r.excludeEnd {
+				return
+			}
+			action(any(value).(T))
+		}
+	}
+	if begin, ok := integerEndpoint(r.first); ok {
+		end, _ := integerEndpoint(r.last)
+		for n := begin; ; n.Add(n, big.NewInt(int64(step))) {
+			if c := n.Cmp(end); c > 0 || c == 0 && r.excludeEnd {
+				return
+			}
+			action(fromInteger[T](n))
+		}
 	}
+	i := 0
+	r.each(func(value T) {
+		if i%step == 0 {
+			action(value)
+		}
+		i++
+	})
+}
+
+func (r Range[T]) ToA() []T {
+	ret := make([]T, 0, 4)
+	r.each(func(value T) {
+		ret = append(ret, value)
+	})
+	return ret
 }
 
-func (r Range) ToS() string {
+func (r Range[T]) ToS() string {
 	return r.String()
 }
 
-func (r Range) String() string {
-	var buf bytes.Buffer
-	buf.WriteRune('[')
-	end := r.actualEnd()
-	if r.first <= end {
-		buf.WriteString(strconv.Itoa(r.first))
-		for i := r.first + 1; i <= end; i++ {
-			buf.WriteRune(',')
-			buf.WriteRune(' ')
-			buf.WriteString(strconv.Itoa(i))
+// String lists the values of the range, as Ruby's to_a.to_s does. A range
+// that cannot be iterated is written as its endpoints, as in "1.0..2.5".
+func (r Range[T]) String() string {
+	if _, ok := successor(r.first); !ok {
+		if r.excludeEnd {
+			return formatToS(r.first) + "..." + formatToS(r.last)
 		}
+		return formatToS(r.first) + ".." + formatToS(r.last)
 	}
-	buf.WriteRune(']')
-	return buf.String()
+	return Inspect(r.ToA())
 }
@@ -2,6 +2,9 @@ package rb
 
 import (
 	"testing"
+	"math"
+	"math/big"
+	"time"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,3 +31,165 @@ func TestRange_ToS(t *testing.T) {
 	assert.Equal(t, "[1, 2]", NewRange(1, 2).ToS(), "Two elements range")
 	assert.Equal(t, "[1, 2]", NewRangeExclusive(1, 3).ToS(), "Exclude end range")
 }
+
+type rangeDay struct {
+	n int
+}
+
+func (d rangeDay) Compare(other rangeDay) int {
+	return d.n - other.n
+}
+
+func (d rangeDay) Succ() rangeDay {
+	return rangeDay{d.n + 1}
+}
+
+func TestRange_IsCover(t *testing.T) {
+	r := NewRange(1, 10)
+	assert.True(t, r.IsCover(5), "(1..10).IsCover(5)")
+	assert.True(t, r.IsCover(5.5), "(1..10).IsCover(5.5)")
+	assert.True(t, r.IsCover(int64(10)), "(1..10).IsCover(10)")
+	assert.True(t, r.IsCover(big.NewInt(1)), "(1..10).IsCover(1)")
+	assert.False(t, r.IsCover(10.5), "(1..10).IsCover(10.5)")
+	assert.False(t, r.IsCover("5"), `(1..10).IsCover("5")`)
+	assert.False(t, r.IsCover(math.NaN()), "(1..10).IsCover(NaN)")
+	assert.False(t, NewRangeExclusive(1, 10).IsCover(10), "(1...10).IsCover(10)")
+	assert.True(t, NewRange(0.5, 1.5).OpCaseEquals(1), "(0.5..1.5) === 1")
+	assert.True(t, NewRange(uint64(0), math.MaxUint64).IsCover(uint64(math.MaxUint64)), "uint64 range")
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	march := NewRangeExclusive(day, day.AddDate(0, 1, 0))
+	assert.True(t, march.IsCover(day.AddDate(0, 0, 30)), "time range covers the 31st")
+	assert.False(t, march.IsCover(day.AddDate(0, 1, 0)), "time range excludes its end")
+	assert.False(t, march.IsCover(1), "time range does not cover numbers")
+
+	assert.Panics(t, func() { NewRange(math.NaN(), 1.0) }, "bad value for range")
+}
+
+func TestRange_Overflow(t *testing.T) {
+	assert.Equal(t, []int{math.MaxInt - 1, math.MaxInt}, NewRange(math.MaxInt-1, math.MaxInt).ToA(), "up to MaxInt")
+	empty := NewRangeExclusive(math.MinInt, math.MinInt)
+	assert.Equal(t, []int{}, empty.ToA(), "empty range at MinInt")
+	_, ok := empty.Max()
+	assert.False(t, ok, "Max of an empty range at MinInt")
+	size, _ := empty.Size()
+	assert.Equal(t, "0", size.String(), "Size of an empty range at MinInt")
+	_, ok = NewRangeExclusive(uint64(0), uint64(0)).Max()
+	assert.False(t, ok, "Max of an empty uint64 range")
+	size, _ = NewRange(uint64(0), math.MaxUint64).Size()
+	assert.Equal(t, "18446744073709551616", size.String(), "Size of the whole uint64 range")
+	sub, _ := NewString("abc").OpSubscript(NewRange(1, math.MaxInt))
+	assert.Equal(t, "bc", sub.Value, `"abc"[1..MaxInt]`)
+}
+
+func TestRange_MinMax(t *testing.T) {
+	tests := []struct {
+		r interface {
+			Min() (int, bool)
+			Max() (int, bool)
+		}
+		min, max int
+		ok       bool
+	}{
+		{NewRange(1, 3), 1, 3, true},
+		{NewRangeExclusive(1, 3), 1, 2, true},
+		{NewRangeExclusive(1, 1), 0, 0, false},
+		{NewRange(3, 1), 0, 0, false},
+	}
+	for _, test := range tests {
+		min, ok := test.r.Min()
+		assert.Equal(t, test.ok, ok, "Min")
+		assert.Equal(t, test.min, min, "Min")
+		max, _ := test.r.Max()
+		assert.Equal(t, test.max, max, "Max")
+	}
+
+	max, _ := NewRange(1.5, 2.5).Max()
+	assert.Equal(t, 2.5, max, "Max of a float range")
+	min, _ := NewRangeExclusive(1.5, 2.5).Min()
+	assert.Equal(t, 1.5, min, "Min of an exclusive float range")
+	assert.Panics(t, func() { NewRangeExclusive(1.5, 2.5).Max() }, "Max of an exclusive float range")
+
+	last, _ := NewRangeExclusive(NewString("a"), NewString("c")).Max()
+	assert.Equal(t, NewString("b"), last, `("a"..."c").Max()`)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end, _ := NewRange(day, day.Add(time.Hour)).Max()
+	assert.Equal(t, day.Add(time.Hour), end, "Max of a time range")
+	assert.Panics(t, func() { NewRangeExclusive(day, day.Add(time.Hour)).Max() }, "Max of an exclusive time range")
+}
+
+func TestRange_Size(t *testing.T) {
+	size, ok := NewRange(1, 10).Size()
+	assert.Equal(t, big.NewInt(10), size, "(1..10).Size()")
+	assert.True(t, ok, "(1..10).Size()")
+	size, _ = NewRangeExclusive(1, 10).Size()
+	assert.Equal(t, big.NewInt(9), size, "(1...10).Size()")
+	size, _ = NewRange(5, 1).Size()
+	assert.Equal(t, "0", size.String(), "(5..1).Size()")
+	size, _ = NewRange(big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), 100)).Size()
+	assert.Equal(t, "1267650600228229401496703205377", size.String(), "Size of a big range")
+	_, ok = NewRange(NewString("a"), NewString("z")).Size()
+	assert.False(t, ok, "Size of a String range")
+	assert.Panics(t, func() { NewRange(1.0, 2.0).Size() }, "Size of a float range")
+}
+
+func TestRange_Iteration(t *testing.T) {
+	assert.Equal(t, []int64{1, 2, 3}, NewRange(int64(1), 3).ToA(), "int64 range")
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(2)}, NewRangeExclusive(big.NewInt(1), big.NewInt(3)).ToA(), "big range")
+	assert.Equal(t, []rangeDay{{1}, {2}, {3}}, NewRange(rangeDay{1}, rangeDay{3}).ToA(), "Successor range")
+	assert.True(t, NewRange(rangeDay{1}, rangeDay{3}).IsInclude(rangeDay{2}), "IsInclude on a Successor range")
+	assert.Equal(t, "[1, 2, 3]", NewRange(1, 3).ToS(), "ToS")
+
+	var steps []int
+	NewRange(1, 5).Step(2, func(i int) { steps = append(steps, i) })
+	assert.Equal(t, []int{1, 3, 5}, steps, "(1..5).Step(2)")
+	var floats []float64
+	NewRangeExclusive(1.0, 3.0).Step(1, func(f float64) { floats = append(floats, f) })
+	assert.Equal(t, []float64{1, 2}, floats, "(1.0...3.0).Step(1)")
+	var bigs []*big.Int
+	NewRange(big.NewInt(0), big.NewInt(10)).Step(5, func(n *big.Int) { bigs = append(bigs, n) })
+	assert.Equal(t, []*big.Int{big.NewInt(0), big.NewInt(5), big.NewInt(10)}, bigs, "big range Step")
+
+	assert.PanicsWithValue(t, "can't iterate from float64", func() { NewRange(1.0, 2.0).Each(func(float64) {}) }, "float range Each")
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.PanicsWithValue(t, "can't iterate from time.Time", func() { NewRange(day, day).ToA() }, "time range ToA")
+	assert.True(t, NewRange(day, day.Add(time.Hour)).IsInclude(day.Add(time.Minute)), "IsInclude on a time range")
+	assert.False(t, NewRangeExclusive(day, day.Add(time.Hour)).IsInclude(day.Add(time.Hour)), "IsInclude excludes the end of a time range")
+	assert.Equal(t, "1.0...2.5", NewRangeExclusive(1.0, 2.5).ToS(), "ToS of a float range")
+	assert.Equal(t, "2024-03-01 00:00:00 +0000 UTC..2024-03-01 00:00:00 +0000 UTC", NewRange(day, day).ToS(), "ToS of a time range")
+}
+
+func TestRange_Bsearch(t *testing.T) {
+	n, ok := NewRange(0, 100).Bsearch(func(i int) bool { return i >= 42 })
+	assert.Equal(t, 42, n, "Bsearch")
+	assert.True(t, ok, "Bsearch")
+	_, ok = NewRangeExclusive(0, 42).Bsearch(func(i int) bool { return i >= 42 })
+	assert.False(t, ok, "Bsearch excludes the end")
+	n, _ = NewRange(math.MinInt, math.MaxInt).Bsearch(func(i int) bool { return i >= -7 })
+	assert.Equal(t, -7, n, "Bsearch over all ints")
+	n, _ = NewRange(0, 100).BsearchAny(func(i int) int { return 42 - i })
+	assert.Equal(t, 42, n, "BsearchAny")
+
+	u, _ := NewRange(uint64(0), math.MaxUint64).Bsearch(func(i uint64) bool { return i >= 1<<63 })
+	assert.Equal(t, uint64(1<<63), u, "Bsearch over uint64")
+	f, _ := NewRange(0.0, 2.0).Bsearch(func(x float64) bool { return x*x >= 2 })
+	assert.InDelta(t, math.Sqrt2, f, 1e-15, "Bsearch over floats")
+	f, _ = NewRange(-10.0, 10.0).Bsearch(func(x float64) bool { return x >= -2.5 })
+	assert.Equal(t, -2.5, f, "Bsearch over negative floats")
+	huge := new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+	root, _ := NewRange(big.NewInt(0), huge).Bsearch(func(n *big.Int) bool {
+		return new(big.Int).Mul(n, n).Cmp(huge) >= 0
+	})
+	assert.Equal(t, "1000000000000000", root.String(), "Bsearch over big integers")
+
+	assert.Panics(t, func() {
+		NewRange(NewString("a"), NewString("z")).Bsearch(func(String) bool { return true })
+	}, "Bsearch over a String range")
+}
+
+func TestRange_IsEql(t *testing.T) {
+	assert.True(t, NewRange(1, 2).IsEql(NewRange(1, 2)), "same range")
+	assert.False(t, NewRange(1, 2).IsEql(NewRangeExclusive(1, 2)), "exclusive range")
+	assert.False(t, NewRange(1, 2).IsEql(NewRange(int64(1), 2)), "range of another type")
+	assert.Equal(t, "1.0...2.5", NewRangeExclusive(1.0, 2.5).Inspect(), "Inspect")
+}
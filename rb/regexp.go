@@ -0,0 +1,231 @@
+package rb
+
+import (
+	"reflect"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// Pattern is what String and MatchData need from a regular expression.
+// *regexp.Regexp, *Regexp and *GoRegexp all satisfy it.
+type Pattern interface {
+	FindStringSubmatchIndex(s string) []int
+	FindAllStringSubmatchIndex(s string, n int) [][]int
+	MatchString(s string) bool
+	NumSubexp() int
+	SubexpNames() []string
+	SubexpIndex(name string) int
+	String() string
+}
+
+// patternFrom is implemented by patterns that can start a search in the
+// middle of a string while still seeing the text before it.
+type patternFrom interface {
+	matchFrom(s string, pos int) []int
+}
+
+// patternAt is implemented by patterns that can match anchored at a position.
+type patternAt interface {
+	matchAt(s string, pos int) []int
+}
+
+// matchFrom finds the first match of re in s at or after byte pos.
+func matchFrom(re Pattern, s string, pos int) []int {
+	switch p := re.(type) {
+	case patternFrom:
+		return p.matchFrom(s, pos)
+	case *regexp.Regexp:
+		return goMatchFrom(p, s, pos)
+	}
+	index := re.FindStringSubmatchIndex(s[pos:])
+	for i := range index {
+		if index[i] >= 0 {
+			index[i] += pos
+		}
+	}
+	return index
+}
+
+// findAll finds up to n matches of re in s, all of them when n is negative,
+// advancing as Ruby's scan does whatever kind of Pattern re is.
+func findAll(re Pattern, s string, n int) [][]int {
+	var matches [][]int
+	for pos := 0; pos <= len(s) && (n < 0 || len(matches) < n); {
+		index := matchFrom(re, s, pos)
+		if index == nil {
+			break
+		}
+		matches = append(matches, index)
+		if index[1] > index[0] {
+			pos = index[1]
+		} else if index[1] < len(s) {
+			_, width := utf8.DecodeRuneInString(s[index[1]:])
+			pos = index[1] + width
+		} else {
+			break
+		}
+	}
+	return matches
+}
+
+// matchesFrom reports whether re matches s at or after byte pos without
+// building the match.
+func matchesFrom(re Pattern, s string, pos int) bool {
+	switch p := re.(type) {
+	case *Regexp:
+		return p.matchesFrom(s, pos)
+	case *regexp.Regexp:
+		return goMatchesFrom(p, s, pos)
+	case *GoRegexp:
+		return goMatchesFrom(p.Regexp, s, pos)
+	}
+	if pos == 0 {
+		return re.MatchString(s)
+	}
+	return matchFrom(re, s, pos) != nil
+}
+
+// matchAt matches re in s anchored at byte pos.
+func matchAt(re Pattern, s string, pos int) []int {
+	switch p := re.(type) {
+	case patternAt:
+		return p.matchAt(s, pos)
+	case *regexp.Regexp:
+		return goMatchAt(p, s, pos)
+	}
+	if index := matchFrom(re, s, pos); index != nil && index[0] == pos {
+		return index
+	}
+	return nil
+}
+
+func isPatternEql(a, b Pattern) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && a.String() == b.String()
+}
+
+// RegexpTimeout limits every match of a Regexp without its own timeout.
+// Zero means no limit.
+var RegexpTimeout time.Duration
+
+// Regexp is a backtracking engine for Ruby (Onigmo) syntax: lookaround,
+// backreferences, atomic groups, possessive quantifiers, subexpression calls,
+// conditionals and the absent operator. Positions are byte offsets, as with
+// the regexp package.
+type Regexp struct {
+	expr    string
+	prog    []reInst
+	numCap  int
+	names   []string
+	nslots  int
+	nsplit  int
+	memo    bool
+	timeout time.Duration
+}
+
+func CompileRegexp(expr string) (*Regexp, error) {
+	return compileRegexp(expr)
+}
+
+func MustCompileRegexp(expr string) *Regexp {
+	re, err := CompileRegexp(expr)
+	if err != nil {
+		panic(err.Error())
+	}
+	return re
+}
+
+// WithTimeout returns a copy of re whose matches fail with a
+// RegexpTimeoutError once they run longer than timeout.
+func (re *Regexp) WithTimeout(timeout time.Duration) *Regexp {
+	dup := *re
+	dup.timeout = timeout
+	return &dup
+}
+
+func (re *Regexp) Timeout() time.Duration {
+	if re.timeout > 0 {
+		return re.timeout
+	}
+	return RegexpTimeout
+}
+
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+func (re *Regexp) Inspect() string {
+	return inspectRegexpSource(re.expr)
+}
+
+func (re *Regexp) NumSubexp() int {
+	return re.numCap
+}
+
+func (re *Regexp) SubexpNames() []string {
+	return re.names
+}
+
+func (re *Regexp) SubexpIndex(name string) int {
+	if name != "" {
+		for i := len(re.names) - 1; i > 0; i-- {
+			if re.names[i] == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Search finds the leftmost match starting at or after byte offset pos. Text
+// before pos is still visible to lookbehind and anchors.
+func (re *Regexp) Search(s string, pos int) ([]int, error) {
+	return re.search(s, pos, false)
+}
+
+// MatchAt reports the match that begins exactly at byte offset pos.
+func (re *Regexp) MatchAt(s string, pos int) ([]int, error) {
+	return re.search(s, pos, true)
+}
+
+// The methods below satisfy Pattern, which has no way to report an error, so
+// they panic with a RegexpTimeoutError when a match times out.
+
+func (re *Regexp) matchFrom(s string, pos int) []int {
+	index, err := re.Search(s, pos)
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+func (re *Regexp) matchAt(s string, pos int) []int {
+	index, err := re.MatchAt(s, pos)
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+func (re *Regexp) matchesFrom(s string, pos int) bool {
+	matched, err := re.matches(s, pos)
+	if err != nil {
+		panic(err)
+	}
+	return matched
+}
+
+func (re *Regexp) MatchString(s string) bool {
+	return re.matchesFrom(s, 0)
+}
+
+func (re *Regexp) FindStringSubmatchIndex(s string) []int {
+	return re.matchFrom(s, 0)
+}
+
+// FindAllStringSubmatchIndex follows Ruby's scan: after an empty match the
+// search resumes one character later, and an empty match may directly follow
+// a non-empty one.
+func (re *Regexp) FindAllStringSubmatchIndex(s string, n int) [][]int {
+	return findAll(re, s, n)
+}
@@ -0,0 +1,533 @@
+package rb
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	reMaxCallDepth = 10000
+	reMaxMemoBits  = 1 << 26
+	// memos up to this many words are kept with a pooled machine
+	rePooledMemoWords = 1 << 10
+	reTimeoutPeriod   = 1024
+)
+
+const (
+	frameBranch = iota
+	frameSlot
+	frameAbsent
+)
+
+type reCallFrame struct {
+	ret   int
+	depth int
+	next  *reCallFrame
+}
+
+// reFrame is an entry on the backtracking stack: a branch to resume, a slot
+// value to restore, or the remaining shorter ends of an absent operator.
+type reFrame struct {
+	kind  int
+	pc    int
+	pos   int
+	slot  int
+	floor int
+	calls *reCallFrame
+}
+
+type reMachine struct {
+	re          *Regexp
+	input       string
+	searchStart int
+	steps       int
+	deadline    time.Time
+	err         error
+	memo        []uint64
+	// the memo, slots and the spare stacks and slot copies are kept with
+	// the machine between runs and searches
+	slots  []int
+	stacks [][]reFrame
+	saves  [][]int
+}
+
+// reMachines pools machines so that a search that builds no match allocates
+// nothing.
+var reMachines = sync.Pool{New: func() interface{} { return new(reMachine) }}
+
+// memoBit returns the memo bit of a split at pos, or -1 when the state is
+// not memoized. The memo is allocated once the search has taken as many
+// steps as the memo has words, so searches that end quickly never pay for
+// it, and it only covers the positions from the start of the search.
+func (m *reMachine) memoBit(inst *reInst, pos int, slots []int) int {
+	for _, slot := range inst.groups {
+		if slots[slot] == pos {
+			// an iteration that has matched nothing yet may only end its
+			// loop, unlike the same state in a later iteration
+			return -1
+		}
+	}
+	width := len(m.input) - m.searchStart + 1
+	if len(m.memo) == 0 {
+		words := (m.re.nsplit*width + 63) / 64
+		if !m.re.memo || m.re.nsplit*width > reMaxMemoBits || m.steps < words {
+			return -1
+		}
+		if cap(m.memo) < words {
+			m.memo = make([]uint64, words)
+		} else {
+			m.memo = m.memo[:words]
+			clear(m.memo)
+		}
+	}
+	return inst.n*width + pos - m.searchStart
+}
+
+func (re *Regexp) search(s string, start int, anchored bool) ([]int, error) {
+	var index []int
+	err := re.exec(s, start, anchored, func(slots []int) {
+		index = append([]int(nil), slots[:2*(re.numCap+1)]...)
+	})
+	return index, err
+}
+
+// matches reports whether re matches at or after start without building the
+// match.
+func (re *Regexp) matches(s string, start int) (bool, error) {
+	matched := false
+	err := re.exec(s, start, false, func([]int) { matched = true })
+	return matched, err
+}
+
+// exec runs the search and hands the slots of a match to found.
+func (re *Regexp) exec(s string, start int, anchored bool, found func(slots []int)) error {
+	if start < 0 || start > len(s) {
+		return nil
+	}
+	m := reMachines.Get().(*reMachine)
+	*m = reMachine{re: re, input: s, searchStart: start, memo: m.memo[:0], slots: m.slots, stacks: m.stacks, saves: m.saves}
+	defer func() {
+		m.re, m.input = nil, ""
+		if cap(m.memo) > rePooledMemoWords {
+			m.memo = nil
+		}
+		reMachines.Put(m)
+	}()
+	if timeout := re.Timeout(); timeout > 0 {
+		m.deadline = time.Now().Add(timeout)
+	}
+
+	if cap(m.slots) < re.nslots {
+		m.slots = make([]int, re.nslots)
+	}
+	slots := m.slots[:re.nslots]
+	for i := range slots {
+		slots[i] = -1
+	}
+	first := re.prog[1]
+	for pos := start; pos <= len(s); {
+		if first.op == iAssert && reAssertKind(first.n) == assertBeginText && pos > 0 {
+			break
+		}
+		if first.op == iRune && !first.fold && !anchored {
+			// skip ahead to the first place the leading literal occurs
+			i := strings.IndexRune(s[pos:], first.r)
+			if i < 0 {
+				break
+			}
+			pos += i
+		}
+		if _, ok := m.run(0, pos, slots, -1, true); ok {
+			found(slots)
+			return nil
+		}
+		if m.err != nil {
+			return m.err
+		}
+		if anchored || pos == len(s) {
+			break
+		}
+		_, width := utf8.DecodeRuneInString(s[pos:])
+		pos += width
+	}
+	return nil
+}
+
+func (m *reMachine) tick() bool {
+	m.steps++
+	if m.steps%reTimeoutPeriod == 0 && !m.deadline.IsZero() && time.Now().After(m.deadline) {
+		m.err = RegexpTimeoutError{"regexp match timeout"}
+	}
+	return m.err == nil
+}
+
+func isWordAt(s string, pos int, unicodeMode bool, before bool) bool {
+	var r rune
+	if before {
+		if pos == 0 {
+			return false
+		}
+		r, _ = utf8.DecodeLastRuneInString(s[:pos])
+	} else {
+		if pos >= len(s) {
+			return false
+		}
+		r, _ = utf8.DecodeRuneInString(s[pos:])
+	}
+	if unicodeMode {
+		return isUnicodeWord(r)
+	}
+	return isAsciiWord(r)
+}
+
+func (m *reMachine) assert(kind reAssertKind, pos int) bool {
+	s := m.input
+	switch kind {
+	case assertBeginLine:
+		return pos == 0 || s[pos-1] == '\n'
+	case assertEndLine:
+		return pos == len(s) || s[pos] == '\n'
+	case assertBeginText:
+		return pos == 0
+	case assertEndText:
+		return pos == len(s)
+	case assertEndTextNewline:
+		return pos == len(s) || pos == len(s)-1 && s[pos] == '\n'
+	case assertWordBoundary, assertWordBoundaryUnicode:
+		unicodeMode := kind == assertWordBoundaryUnicode
+		return isWordAt(s, pos, unicodeMode, true) != isWordAt(s, pos, unicodeMode, false)
+	case assertNotWordBoundary, assertNotWordBoundaryUnicode:
+		unicodeMode := kind == assertNotWordBoundaryUnicode
+		return isWordAt(s, pos, unicodeMode, true) == isWordAt(s, pos, unicodeMode, false)
+	case assertSearchStart:
+		return pos == m.searchStart
+	}
+	return false
+}
+
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(b); f != b; f = unicode.SimpleFold(f) {
+		if f == a {
+			return true
+		}
+	}
+	return false
+}
+
+// backref returns where the text of one of groups, tried from the last,
+// ends when matched again at pos.
+func (m *reMachine) backref(inst *reInst, pos int, slots []int) (int, bool) {
+	for i := len(inst.groups) - 1; i >= 0; i-- {
+		g := inst.groups[i]
+		begin, end := slots[2*g], slots[2*g+1]
+		if begin < 0 || end < begin {
+			continue
+		}
+		text := m.input[begin:end]
+		if !inst.fold {
+			if strings.HasPrefix(m.input[pos:], text) {
+				return pos + len(text), true
+			}
+			continue
+		}
+		at := pos
+		matched := true
+		for _, r := range text {
+			c, width := utf8.DecodeRuneInString(m.input[at:])
+			if width == 0 || !equalFold(c, r) {
+				matched = false
+				break
+			}
+			at += width
+		}
+		if matched {
+			return at, true
+		}
+	}
+	return 0, false
+}
+
+// look evaluates a lookaround at pos. A lookbehind tries starts from the
+// nearest one, within the lengths its body can match, and requires the body
+// to end exactly at pos.
+func (m *reMachine) look(inst *reInst, pos int, slots []int) bool {
+	if !inst.behind {
+		_, ok := m.run(inst.x, pos, slots, -1, false)
+		return ok
+	}
+	start, count := pos, 0
+	for ; count < inst.min; count++ {
+		if start == 0 {
+			return false
+		}
+		_, width := utf8.DecodeLastRuneInString(m.input[:start])
+		start -= width
+	}
+	for {
+		if _, ok := m.run(inst.x, start, slots, pos, false); ok || m.err != nil {
+			return ok
+		}
+		if start == 0 || inst.max >= 0 && count >= inst.max {
+			return false
+		}
+		_, width := utf8.DecodeLastRuneInString(m.input[:start])
+		start -= width
+		count++
+	}
+}
+
+// saveSlots copies slots into a spare buffer, which releaseSlots gives back.
+func (m *reMachine) saveSlots(slots []int) []int {
+	var saved []int
+	if n := len(m.saves); n > 0 {
+		saved, m.saves = m.saves[n-1], m.saves[:n-1]
+	}
+	return append(saved[:0], slots...)
+}
+
+func (m *reMachine) releaseSlots(saved []int) {
+	m.saves = append(m.saves, saved)
+}
+
+// absentLimit returns the furthest end for (?~absent) starting at pos: the
+// longest text that contains no match of the absent pattern.
+func (m *reMachine) absentLimit(inst *reInst, pos int, slots []int) int {
+	saved := m.saveSlots(slots)
+	defer m.releaseSlots(saved)
+	limit := -1
+	for end := pos; ; {
+		found := false
+		for start := end; ; {
+			if _, ok := m.run(inst.x, start, slots, end, false); ok {
+				copy(slots, saved)
+				found = true
+				break
+			}
+			if m.err != nil {
+				return -1
+			}
+			if start == pos {
+				break
+			}
+			_, width := utf8.DecodeLastRuneInString(m.input[:start])
+			start -= width
+		}
+		if found {
+			break
+		}
+		limit = end
+		if end == len(m.input) {
+			break
+		}
+		_, width := utf8.DecodeRuneInString(m.input[end:])
+		end += width
+	}
+	return limit
+}
+
+// run executes the program from pc at pos until an iSucceed, which must be
+// reached at wantEnd unless that is negative. On success slots hold the
+// captures; on failure they are left as they were.
+func (m *reMachine) run(pc, pos int, slots []int, wantEnd int, memo bool) (int, bool) {
+	prog := m.re.prog
+	input := m.input
+	var stack []reFrame
+	if n := len(m.stacks); n > 0 {
+		stack, m.stacks = m.stacks[n-1][:0], m.stacks[:n-1]
+	}
+	defer func() { m.stacks = append(m.stacks, stack[:0]) }()
+	var calls *reCallFrame
+
+	setSlot := func(n, value int) {
+		stack = append(stack, reFrame{kind: frameSlot, slot: n, pos: slots[n]})
+		slots[n] = value
+	}
+	// keep records the slots a nested run changed so they can be undone
+	keep := func(saved []int) {
+		for i, v := range saved {
+			if slots[i] != v {
+				stack = append(stack, reFrame{kind: frameSlot, slot: i, pos: v})
+			}
+		}
+	}
+
+	for {
+		ok := m.tick()
+		if ok {
+			inst := &prog[pc]
+			switch inst.op {
+			case iRune:
+				ok = false
+				if pos < len(input) {
+					r, width := utf8.DecodeRuneInString(input[pos:])
+					if r == inst.r || inst.fold && equalFold(r, inst.r) {
+						pos += width
+						pc++
+						ok = true
+					}
+				}
+			case iAny:
+				ok = false
+				if pos < len(input) {
+					r, width := utf8.DecodeRuneInString(input[pos:])
+					if inst.dotAll || r != '\n' {
+						pos += width
+						pc++
+						ok = true
+					}
+				}
+			case iClass:
+				ok = false
+				if pos < len(input) {
+					r, width := utf8.DecodeRuneInString(input[pos:])
+					if inst.match(r) {
+						pos += width
+						pc++
+						ok = true
+					}
+				}
+			case iSplit:
+				if memo {
+					if bit := m.memoBit(inst, pos, slots); bit >= 0 {
+						if m.memo[bit/64]&(1<<(bit%64)) != 0 {
+							// this state was explored before and led nowhere
+							ok = false
+							break
+						}
+						m.memo[bit/64] |= 1 << (bit % 64)
+					}
+				}
+				stack = append(stack, reFrame{kind: frameBranch, pc: inst.y, pos: pos, calls: calls})
+				pc = inst.x
+			case iJmp:
+				pc = inst.x
+			case iSave:
+				setSlot(inst.n, pos)
+				pc++
+			case iNullCheck:
+				if slots[inst.n] != pos {
+					pc = inst.x
+				} else {
+					pc++
+				}
+			case iAssert:
+				if ok = m.assert(reAssertKind(inst.n), pos); ok {
+					pc++
+				}
+			case iBackref:
+				var end int
+				if end, ok = m.backref(inst, pos, slots); ok {
+					pos = end
+					pc++
+				}
+			case iLook:
+				saved := m.saveSlots(slots)
+				matched := m.look(inst, pos, slots)
+				if m.err != nil {
+					return -1, false
+				}
+				if inst.negate {
+					copy(slots, saved)
+					ok = !matched
+				} else if ok = matched; ok {
+					keep(saved)
+				}
+				m.releaseSlots(saved)
+				if ok {
+					pc = inst.y
+				}
+			case iAtomic:
+				saved := m.saveSlots(slots)
+				var end int
+				end, ok = m.run(inst.x, pos, slots, -1, false)
+				if m.err != nil {
+					return -1, false
+				}
+				if ok {
+					keep(saved)
+					pos = end
+					pc = inst.y
+				}
+				m.releaseSlots(saved)
+			case iAbsent:
+				limit := m.absentLimit(inst, pos, slots)
+				if m.err != nil {
+					return -1, false
+				}
+				if ok = limit >= 0; ok {
+					if limit > pos {
+						stack = append(stack, reFrame{kind: frameAbsent, pc: inst.y, pos: limit, floor: pos, calls: calls})
+					}
+					pos = limit
+					pc = inst.y
+				}
+			case iCond:
+				pc = inst.y
+				for _, g := range inst.groups {
+					if slots[2*g] >= 0 && slots[2*g+1] >= slots[2*g] {
+						pc = inst.x
+						break
+					}
+				}
+			case iCall:
+				depth := 0
+				if calls != nil {
+					depth = calls.depth + 1
+				}
+				if ok = depth < reMaxCallDepth; ok {
+					calls = &reCallFrame{ret: pc + 1, depth: depth, next: calls}
+					pc = inst.x
+				}
+			case iReturn:
+				pc = calls.ret
+				calls = calls.next
+			case iSucceed:
+				if wantEnd < 0 || pos == wantEnd {
+					return pos, true
+				}
+				ok = false
+			}
+		}
+		if ok {
+			continue
+		}
+
+		if m.err != nil {
+			// unwind so the caller sees the slots it passed in
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].kind == frameSlot {
+					slots[stack[i].slot] = stack[i].pos
+				}
+			}
+			return -1, false
+		}
+		for resumed := false; !resumed; {
+			if len(stack) == 0 {
+				return -1, false
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch f.kind {
+			case frameSlot:
+				slots[f.slot] = f.pos
+			case frameBranch:
+				pc, pos, calls = f.pc, f.pos, f.calls
+				resumed = true
+			case frameAbsent:
+				// give back one more character
+				_, width := utf8.DecodeLastRuneInString(input[:f.pos])
+				pc, pos, calls = f.pc, f.pos-width, f.calls
+				if pos > f.floor {
+					stack = append(stack, reFrame{kind: frameAbsent, pc: f.pc, pos: pos, floor: f.floor, calls: f.calls})
+				}
+				resumed = true
+			}
+		}
+	}
+}
@@ -0,0 +1,1384 @@
+package rb
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type reFlags uint8
+
+const (
+	reFoldCase reFlags = 1 << iota
+	reDotAll
+	reExtended
+	reUnicode
+)
+
+type reOp uint8
+
+const (
+	reEmpty reOp = iota
+	reLiteral
+	reAnyChar
+	reCharClass
+	reConcat
+	reAlternate
+	reRepeat
+	reGroup
+	reCapture
+	reLook
+	reAtomic
+	reBackref
+	reCall
+	reCond
+	reAbsent
+	reAssert
+	reKeep
+)
+
+type reAssertKind int
+
+const (
+	assertBeginLine reAssertKind = iota
+	assertEndLine
+	assertBeginText
+	assertEndText
+	assertEndTextNewline
+	assertWordBoundary
+	assertNotWordBoundary
+	assertWordBoundaryUnicode
+	assertNotWordBoundaryUnicode
+	assertSearchStart
+)
+
+const (
+	reMaxRepeat  = 100000
+	reMaxProgram = 1 << 20
+)
+
+type reNode struct {
+	op         reOp
+	r          rune
+	fold       bool
+	dotAll     bool
+	match      func(rune) bool
+	subs       []*reNode
+	min, max   int
+	greedy     bool
+	possessive bool
+	group      int
+	name       string
+	groups     []int
+	behind     bool
+	negate     bool
+	assert     reAssertKind
+}
+
+// lengths returns the minimum and maximum number of characters n can match;
+// a maximum of -1 means unbounded.
+func (n *reNode) lengths() (min, max int) {
+	switch n.op {
+	case reLiteral, reAnyChar, reCharClass:
+		return 1, 1
+	case reConcat:
+		for _, sub := range n.subs {
+			lo, hi := sub.lengths()
+			min += lo
+			if max >= 0 {
+				if hi < 0 {
+					max = -1
+				} else {
+					max += hi
+				}
+			}
+		}
+		return
+	case reAlternate, reCond:
+		if len(n.subs) == 1 {
+			// a conditional without "no" branch may match nothing
+			_, max = n.subs[0].lengths()
+			return 0, max
+		}
+		min = -1
+		for _, sub := range n.subs {
+			lo, hi := sub.lengths()
+			if min < 0 || lo < min {
+				min = lo
+			}
+			if max >= 0 && (hi < 0 || hi > max) {
+				max = hi
+			}
+		}
+		return
+	case reRepeat:
+		lo, hi := n.subs[0].lengths()
+		min = lo * n.min
+		if hi < 0 || n.max < 0 && hi > 0 {
+			return min, -1
+		}
+		if n.max < 0 {
+			return min, 0
+		}
+		return min, hi * n.max
+	case reGroup, reCapture, reAtomic:
+		return n.subs[0].lengths()
+	case reBackref, reCall, reAbsent:
+		return 0, -1
+	}
+	return 0, 0
+}
+
+type reSyntaxError struct {
+	message string
+}
+
+type reParser struct {
+	src      string
+	pos      int
+	flags    reFlags
+	captures []*reNode
+	refs     []*reNode
+	named    bool
+	numbered bool
+}
+
+func (p *reParser) fail(message string) {
+	panic(reSyntaxError{message})
+}
+
+func (p *reParser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *reParser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
+
+func (p *reParser) next() rune {
+	r, width := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += width
+	return r
+}
+
+func (p *reParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.src[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *reParser) skipExtended() {
+	if p.flags&reExtended == 0 {
+		return
+	}
+	for p.more() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r', '\f', '\v':
+			p.pos++
+		case '#':
+			for p.more() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *reParser) parseAlternation() *reNode {
+	alts := []*reNode{p.parseConcat()}
+	for p.more() && p.peek() == '|' {
+		p.pos++
+		alts = append(alts, p.parseConcat())
+	}
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return &reNode{op: reAlternate, subs: alts}
+}
+
+func (p *reParser) parseConcat() *reNode {
+	var items []*reNode
+	for {
+		p.skipExtended()
+		if !p.more() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+		atom, isolated := p.parseAtom()
+		if isolated {
+			// (?imx) applies to the rest of the enclosing group, alternatives included
+			items = append(items, p.parseAlternation())
+			break
+		}
+		if atom != nil {
+			items = append(items, p.parseQuantifiers(atom))
+		}
+	}
+	switch len(items) {
+	case 0:
+		return &reNode{op: reEmpty}
+	case 1:
+		return items[0]
+	}
+	return &reNode{op: reConcat, subs: items}
+}
+
+func parseInterval(s string) (min, max, size int) {
+	if len(s) < 3 || s[0] != '{' {
+		return
+	}
+	i := 1
+	digits := func() (int, bool) {
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return 0, false
+		}
+		n, err := strconv.Atoi(s[start:i])
+		if err != nil {
+			n = reMaxRepeat + 1
+		}
+		return n, true
+	}
+	min, hasMin := digits()
+	max = min
+	if i < len(s) && s[i] == ',' {
+		i++
+		var hasMax bool
+		if max, hasMax = digits(); !hasMax {
+			if !hasMin {
+				return 0, 0, 0
+			}
+			max = -1
+		}
+	} else if !hasMin {
+		return 0, 0, 0
+	}
+	if i >= len(s) || s[i] != '}' {
+		return 0, 0, 0
+	}
+	return min, max, i + 1
+}
+
+func (p *reParser) parseQuantifiers(atom *reNode) *reNode {
+	for {
+		p.skipExtended()
+		if !p.more() {
+			return atom
+		}
+		min, max, interval := 0, -1, false
+		switch p.src[p.pos] {
+		case '*':
+			p.pos++
+		case '+':
+			min = 1
+			p.pos++
+		case '?':
+			max = 1
+			p.pos++
+		case '{':
+			var size int
+			if min, max, size = parseInterval(p.src[p.pos:]); size == 0 {
+				return atom
+			}
+			if min > reMaxRepeat || max > reMaxRepeat {
+				p.fail("too big number for repeat range")
+			}
+			if max >= 0 && max < min {
+				p.fail("upper bound must be greater than lower bound")
+			}
+			p.pos += size
+			interval = true
+		default:
+			return atom
+		}
+		if atom.op == reAssert || atom.op == reLook {
+			p.fail("target of repeat operator is invalid")
+		}
+		node := &reNode{op: reRepeat, subs: []*reNode{atom}, min: min, max: max, greedy: true}
+		if p.consume("?") {
+			node.greedy = false
+		} else if !interval && p.consume("+") {
+			node.possessive = true
+		}
+		atom = node
+	}
+}
+
+func (p *reParser) literal(r rune) *reNode {
+	return &reNode{op: reLiteral, r: r, fold: p.flags&reFoldCase != 0 && unicode.SimpleFold(r) != r}
+}
+
+func (p *reParser) class(match func(rune) bool) *reNode {
+	return &reNode{op: reCharClass, match: match}
+}
+
+func (p *reParser) parseAtom() (node *reNode, isolated bool) {
+	c := p.next()
+	switch c {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.class(p.parseClass()), false
+	case '.':
+		return &reNode{op: reAnyChar, dotAll: p.flags&reDotAll != 0}, false
+	case '^':
+		return &reNode{op: reAssert, assert: assertBeginLine}, false
+	case '$':
+		return &reNode{op: reAssert, assert: assertEndLine}, false
+	case '\\':
+		return p.parseEscape(), false
+	case '*', '+', '?':
+		p.fail("target of repeat operator is not specified")
+	case '{':
+		if _, _, size := parseInterval(p.src[p.pos-1:]); size > 0 {
+			p.fail("target of repeat operator is not specified")
+		}
+	}
+	return p.literal(c), false
+}
+
+func (p *reParser) parseGroupBody() *reNode {
+	saved := p.flags
+	node := p.parseAlternation()
+	p.flags = saved
+	if !p.consume(")") {
+		p.fail("end pattern with unmatched parenthesis")
+	}
+	return node
+}
+
+func (p *reParser) capture(name string) *reNode {
+	node := &reNode{op: reCapture, name: name}
+	p.captures = append(p.captures, node)
+	node.group = len(p.captures)
+	node.subs = []*reNode{p.parseGroupBody()}
+	return node
+}
+
+func (p *reParser) wrap(op reOp) *reNode {
+	return &reNode{op: op, subs: []*reNode{p.parseGroupBody()}}
+}
+
+func isGroupName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *reParser) groupName(close byte) string {
+	end := strings.IndexByte(p.src[p.pos:], close)
+	if end < 0 {
+		p.fail("invalid group name <" + p.src[p.pos:] + ">")
+	}
+	name := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return name
+}
+
+func (p *reParser) parseGroup() (*reNode, bool) {
+	if !p.consume("?") {
+		return p.capture(""), false
+	}
+	if !p.more() {
+		p.fail("end pattern in group")
+	}
+	switch c := p.next(); c {
+	case '#':
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			p.fail("end pattern in group")
+		}
+		p.pos += end + 1
+		return nil, false
+	case ':':
+		return p.wrap(reGroup), false
+	case '=', '!':
+		node := p.wrap(reLook)
+		node.negate = c == '!'
+		return node, false
+	case '>':
+		return p.wrap(reAtomic), false
+	case '~':
+		return p.wrap(reAbsent), false
+	case '(':
+		return p.parseCond(), false
+	case '<', '\'':
+		if c == '<' && p.more() && (p.peek() == '=' || p.peek() == '!') {
+			negate := p.next() == '!'
+			node := p.wrap(reLook)
+			node.behind, node.negate = true, negate
+			return node, false
+		}
+		close := byte('>')
+		if c == '\'' {
+			close = '\''
+		}
+		name := p.groupName(close)
+		if !isGroupName(name) {
+			p.fail("invalid group name <" + name + ">")
+		}
+		p.named = true
+		return p.capture(name), false
+	default:
+		p.pos -= utf8.RuneLen(c)
+		return p.parseOptions()
+	}
+}
+
+func (p *reParser) parseOptions() (*reNode, bool) {
+	flags, on := p.flags, true
+	set := func(flag reFlags) {
+		if on {
+			flags |= flag
+		} else {
+			flags &^= flag
+		}
+	}
+	for p.more() {
+		switch p.next() {
+		case 'i':
+			set(reFoldCase)
+		case 'm':
+			set(reDotAll)
+		case 'x':
+			set(reExtended)
+		case 'u':
+			flags |= reUnicode
+		case 'a', 'd':
+			flags &^= reUnicode
+		case '-':
+			if !on {
+				p.fail("undefined group option")
+			}
+			on = false
+		case ':':
+			saved := p.flags
+			p.flags = flags
+			node := p.parseGroupBody()
+			p.flags = saved
+			return &reNode{op: reGroup, subs: []*reNode{node}}, false
+		case ')':
+			p.flags = flags
+			return nil, true
+		default:
+			p.fail("undefined group option")
+		}
+	}
+	p.fail("end pattern in group")
+	return nil, false
+}
+
+func (p *reParser) parseCond() *reNode {
+	end := strings.IndexByte(p.src[p.pos:], ')')
+	if end < 0 {
+		p.fail("invalid conditional pattern")
+	}
+	ref := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	node := &reNode{op: reCond}
+	if len(ref) > 2 && (ref[0] == '<' && ref[len(ref)-1] == '>' || ref[0] == '\'' && ref[len(ref)-1] == '\'') {
+		ref = ref[1 : len(ref)-1]
+	}
+	p.reference(node, ref, false)
+
+	saved := p.flags
+	yes := p.parseConcat()
+	node.subs = []*reNode{yes}
+	if p.consume("|") {
+		node.subs = append(node.subs, p.parseConcat())
+		if p.more() && p.peek() == '|' {
+			p.fail("invalid conditional pattern")
+		}
+	}
+	p.flags = saved
+	if !p.consume(")") {
+		p.fail("end pattern with unmatched parenthesis")
+	}
+	return node
+}
+
+// reference resolves a group reference written as a name, a number or a
+// relative number; names are looked up once the whole pattern is parsed.
+func (p *reParser) reference(node *reNode, ref string, allowForward bool) {
+	node.group = -1
+	p.refs = append(p.refs, node)
+	digits := ref
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	n, err := strconv.Atoi(digits)
+	if digits == "" || err != nil || strings.TrimLeft(digits, "0123456789") != "" {
+		if !isGroupName(ref) {
+			p.fail("invalid group name <" + ref + ">")
+		}
+		node.name = ref
+		return
+	}
+	switch ref[0] {
+	case '-':
+		n = len(p.captures) + 1 - n
+	case '+':
+		if !allowForward {
+			p.fail("invalid backref number/name")
+		}
+		n += len(p.captures)
+	}
+	if n != 0 || node.op != reCall {
+		p.numbered = true
+	}
+	node.group = n
+}
+
+func (p *reParser) parseReference(op reOp) *reNode {
+	close := byte('>')
+	if p.consume("'") {
+		close = '\''
+	} else if !p.consume("<") {
+		p.fail("invalid backref number/name")
+	}
+	node := &reNode{op: op, fold: p.flags&reFoldCase != 0}
+	p.reference(node, p.groupName(close), op == reCall)
+	return node
+}
+
+func (p *reParser) sub(src string) *reNode {
+	sub := &reParser{src: src}
+	return sub.parseAlternation()
+}
+
+func (p *reParser) parseEscape() *reNode {
+	if !p.more() {
+		p.fail("end pattern at escape")
+	}
+	c := p.next()
+	switch c {
+	case 'w', 'W', 'd', 'D', 's', 'S', 'h', 'H':
+		return p.class(p.shorthand(c))
+	case 'p', 'P':
+		return p.class(p.parseProperty(c == 'P'))
+	case 'A':
+		return &reNode{op: reAssert, assert: assertBeginText}
+	case 'z':
+		return &reNode{op: reAssert, assert: assertEndText}
+	case 'Z':
+		return &reNode{op: reAssert, assert: assertEndTextNewline}
+	case 'b':
+		if p.flags&reUnicode != 0 {
+			return &reNode{op: reAssert, assert: assertWordBoundaryUnicode}
+		}
+		return &reNode{op: reAssert, assert: assertWordBoundary}
+	case 'B':
+		if p.flags&reUnicode != 0 {
+			return &reNode{op: reAssert, assert: assertNotWordBoundaryUnicode}
+		}
+		return &reNode{op: reAssert, assert: assertNotWordBoundary}
+	case 'G':
+		return &reNode{op: reAssert, assert: assertSearchStart}
+	case 'K':
+		return &reNode{op: reKeep}
+	case 'R':
+		return p.sub(`(?>\x0D\x0A|[\x0A-\x0D\x{85}\x{2028}\x{2029}])`)
+	case 'X':
+		return p.sub(`(?>\x0D\x0A|\P{M}\p{M}*|\p{M}+)`)
+	case 'k':
+		return p.parseReference(reBackref)
+	case 'g':
+		return p.parseReference(reCall)
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		start := p.pos - 1
+		end := start
+		for end < len(p.src) && p.src[end] >= '0' && p.src[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(p.src[start:end])
+		if n <= 9 || n <= len(p.captures) {
+			p.pos = end
+			node := &reNode{op: reBackref, group: n, fold: p.flags&reFoldCase != 0}
+			p.refs = append(p.refs, node)
+			p.numbered = true
+			return node
+		}
+		if c >= '8' {
+			p.fail("invalid backref number/name")
+		}
+		p.pos = start
+		return p.literal(p.octal(3))
+	}
+	runes := p.parseCharEscape(c, false)
+	if len(runes) == 1 {
+		return p.literal(runes[0])
+	}
+	node := &reNode{op: reConcat}
+	for _, r := range runes {
+		node.subs = append(node.subs, p.literal(r))
+	}
+	return node
+}
+
+func (p *reParser) octal(maxDigits int) rune {
+	var r rune
+	for i := 0; i < maxDigits && p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '7'; i++ {
+		r = r*8 + rune(p.src[p.pos]-'0')
+		p.pos++
+	}
+	return r
+}
+
+func (p *reParser) hex(maxDigits int) (rune, int) {
+	var r rune
+	n := 0
+	for ; n < maxDigits && p.more(); n++ {
+		v := hexValue(p.src[p.pos])
+		if v < 0 {
+			break
+		}
+		r = r*16 + rune(v)
+		p.pos++
+	}
+	return r, n
+}
+
+// hexBytes reads \xHH escapes that together form one UTF-8 encoded character.
+func (p *reParser) hexBytes(lead rune) rune {
+	buf := []byte{byte(lead)}
+	need := 0
+	switch {
+	case lead >= 0xC2 && lead <= 0xDF:
+		need = 2
+	case lead >= 0xE0 && lead <= 0xEF:
+		need = 3
+	case lead >= 0xF0 && lead <= 0xF4:
+		need = 4
+	default:
+		p.fail("invalid multibyte escape")
+	}
+	for len(buf) < need {
+		if !p.consume(`\x`) {
+			p.fail("too short multibyte code string")
+		}
+		b, n := p.hex(2)
+		if n == 0 {
+			p.fail("invalid hex escape")
+		}
+		buf = append(buf, byte(b))
+	}
+	r, _ := utf8.DecodeRune(buf)
+	if r == utf8.RuneError {
+		p.fail("invalid multibyte escape")
+	}
+	return r
+}
+
+func (p *reParser) parseCharEscape(c rune, inClass bool) []rune {
+	switch c {
+	case 't':
+		return []rune{'\t'}
+	case 'n':
+		return []rune{'\n'}
+	case 'r':
+		return []rune{'\r'}
+	case 'f':
+		return []rune{'\f'}
+	case 'v':
+		return []rune{'\v'}
+	case 'a':
+		return []rune{'\a'}
+	case 'e':
+		return []rune{0x1b}
+	case 'b':
+		if inClass {
+			return []rune{'\b'}
+		}
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		p.pos--
+		return []rune{p.octal(3)}
+	case 'x':
+		if p.consume("{") {
+			r, n := p.hex(8)
+			if n == 0 || !p.consume("}") {
+				p.fail("invalid code point value")
+			}
+			return []rune{r}
+		}
+		r, n := p.hex(2)
+		if n == 0 {
+			p.fail("invalid hex escape")
+		}
+		if r >= 0x80 {
+			r = p.hexBytes(r)
+		}
+		return []rune{r}
+	case 'u':
+		if p.consume("{") {
+			var runes []rune
+			for {
+				for p.consume(" ") {
+				}
+				if p.consume("}") {
+					break
+				}
+				r, n := p.hex(6)
+				if n == 0 || r > unicode.MaxRune {
+					p.fail("invalid Unicode list")
+				}
+				runes = append(runes, r)
+			}
+			if len(runes) == 0 {
+				p.fail("invalid Unicode list")
+			}
+			return runes
+		}
+		r, n := p.hex(4)
+		if n != 4 {
+			p.fail("invalid Unicode escape")
+		}
+		return []rune{r}
+	case 'c', 'C':
+		if c == 'C' && !p.consume("-") {
+			p.fail("invalid control-code syntax")
+		}
+		if !p.more() {
+			p.fail("end pattern at control")
+		}
+		r := p.next()
+		if r == '?' {
+			return []rune{0x7f}
+		}
+		return []rune{r & 0x1f}
+	case 'M':
+		p.fail("invalid meta-code syntax")
+	}
+	return []rune{c}
+}
+
+func isAsciiWord(r rune) bool {
+	return r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+}
+
+func isUnicodeWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || unicode.Is(unicode.Pc, r)
+}
+
+func isAsciiSpace(r rune) bool {
+	return r == ' ' || r >= '\t' && r <= '\r'
+}
+
+func isHexDigit(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+func negateRunes(match func(rune) bool) func(rune) bool {
+	return func(r rune) bool {
+		return !match(r)
+	}
+}
+
+// shorthand returns \w, \d, \s, \h or their negations. Like Ruby they are
+// ASCII-only unless the (?u) option is on.
+func (p *reParser) shorthand(c rune) func(rune) bool {
+	unicodeMode := p.flags&reUnicode != 0
+	var match func(rune) bool
+	switch unicode.ToLower(c) {
+	case 'w':
+		match = isAsciiWord
+		if unicodeMode {
+			match = isUnicodeWord
+		}
+	case 'd':
+		match = func(r rune) bool {
+			return r >= '0' && r <= '9'
+		}
+		if unicodeMode {
+			match = unicode.IsDigit
+		}
+	case 's':
+		match = isAsciiSpace
+		if unicodeMode {
+			match = func(r rune) bool {
+				return unicode.IsSpace(r) || r == 0x85
+			}
+		}
+	case 'h':
+		match = isHexDigit
+	}
+	if unicode.IsUpper(c) {
+		return negateRunes(match)
+	}
+	return match
+}
+
+var (
+	propertiesOnce sync.Once
+	properties     map[string]func(rune) bool
+)
+
+func normalizePropertyName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+}
+
+func isAssigned(r rune) bool {
+	return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Z, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs)
+}
+
+func isAlphabetic(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Nl, r) || unicode.Is(unicode.Other_Alphabetic, r)
+}
+
+func isGraph(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.Is(unicode.Cc, r) && !unicode.Is(unicode.Cs, r) && isAssigned(r)
+}
+
+func isPrint(r rune) bool {
+	return isGraph(r) || unicode.Is(unicode.Zs, r)
+}
+
+var posixClasses = map[string]func(rune) bool{
+	"alnum": func(r rune) bool {
+		return isAlphabetic(r) || unicode.IsDigit(r)
+	},
+	"alpha": isAlphabetic,
+	"ascii": func(r rune) bool {
+		return r < 0x80
+	},
+	"blank": func(r rune) bool {
+		return r == '\t' || unicode.Is(unicode.Zs, r)
+	},
+	"cntrl": func(r rune) bool {
+		return unicode.Is(unicode.Cc, r)
+	},
+	"digit": unicode.IsDigit,
+	"graph": isGraph,
+	"lower": func(r rune) bool {
+		return unicode.IsLower(r) || unicode.Is(unicode.Other_Lowercase, r)
+	},
+	"print": isPrint,
+	"punct": func(r rune) bool {
+		return unicode.IsPunct(r) || r < 0x80 && unicode.IsSymbol(r)
+	},
+	"space": func(r rune) bool {
+		return unicode.IsSpace(r) || r == 0x85
+	},
+	"upper": func(r rune) bool {
+		return unicode.IsUpper(r) || unicode.Is(unicode.Other_Uppercase, r)
+	},
+	"xdigit": isHexDigit,
+	"word":   isUnicodeWord,
+}
+
+var categoryNames = map[string]string{
+	"Letter": "L", "Uppercase_Letter": "Lu", "Lowercase_Letter": "Ll", "Titlecase_Letter": "Lt",
+	"Modifier_Letter": "Lm", "Other_Letter": "Lo", "Mark": "M", "Combining_Mark": "M",
+	"Nonspacing_Mark": "Mn", "Spacing_Mark": "Mc", "Enclosing_Mark": "Me", "Number": "N",
+	"Decimal_Number": "Nd", "Letter_Number": "Nl", "Other_Number": "No", "Punctuation": "P",
+	"Connector_Punctuation": "Pc", "Dash_Punctuation": "Pd", "Open_Punctuation": "Ps",
+	"Close_Punctuation": "Pe", "Initial_Punctuation": "Pi", "Final_Punctuation": "Pf",
+	"Other_Punctuation": "Po", "Symbol": "S", "Math_Symbol": "Sm", "Currency_Symbol": "Sc",
+	"Modifier_Symbol": "Sk", "Other_Symbol": "So", "Separator": "Z", "Space_Separator": "Zs",
+	"Line_Separator": "Zl", "Paragraph_Separator": "Zp", "Control": "Cc", "Format": "Cf",
+	"Surrogate": "Cs", "Private_Use": "Co",
+}
+
+func loadProperties() {
+	properties = make(map[string]func(rune) bool)
+	add := func(name string, table *unicode.RangeTable) {
+		properties[normalizePropertyName(name)] = func(r rune) bool {
+			return unicode.Is(table, r)
+		}
+	}
+	for name, table := range unicode.Scripts {
+		add(name, table)
+	}
+	for name, table := range unicode.Properties {
+		add(name, table)
+	}
+	for name, table := range unicode.Categories {
+		add(name, table)
+	}
+	for long, short := range categoryNames {
+		add(long, unicode.Categories[short])
+	}
+	for name, match := range posixClasses {
+		properties[name] = match
+	}
+	properties["any"] = func(rune) bool {
+		return true
+	}
+	properties["assigned"] = isAssigned
+	properties["cn"] = negateRunes(isAssigned)
+	properties["unassigned"] = properties["cn"]
+	properties["c"] = func(r rune) bool {
+		return unicode.Is(unicode.C, r) || !isAssigned(r)
+	}
+	properties["other"] = properties["c"]
+	properties["lc"] = func(r rune) bool {
+		return unicode.In(r, unicode.Lu, unicode.Ll, unicode.Lt)
+	}
+	properties["casedletter"] = properties["lc"]
+}
+
+func (p *reParser) parseProperty(negate bool) func(rune) bool {
+	if !p.consume("{") {
+		p.fail("invalid character property name {" + string(p.peek()) + "}")
+	}
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end < 0 {
+		p.fail("invalid character property name {" + p.src[p.pos:] + "}")
+	}
+	name := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	if strings.HasPrefix(name, "^") {
+		negate = !negate
+		name = name[1:]
+	}
+	propertiesOnce.Do(loadProperties)
+	match, ok := properties[normalizePropertyName(name)]
+	if !ok {
+		p.fail("invalid character property name {" + name + "}")
+	}
+	if negate {
+		return negateRunes(match)
+	}
+	return match
+}
+
+func foldRunes(match func(rune) bool) func(rune) bool {
+	return func(r rune) bool {
+		if match(r) {
+			return true
+		}
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if match(f) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseClass parses a bracket expression after its opening '['.
+func (p *reParser) parseClass() func(rune) bool {
+	negate := p.consume("^")
+	match := p.parseClassBody()
+	if p.flags&reFoldCase != 0 {
+		match = foldRunes(match)
+	}
+	if negate {
+		return negateRunes(match)
+	}
+	return match
+}
+
+func (p *reParser) parseClassBody() func(rune) bool {
+	var ranges []rune
+	var items []func(rune) bool
+	union := func() func(rune) bool {
+		return func(r rune) bool {
+			for i := 0; i < len(ranges); i += 2 {
+				if r >= ranges[i] && r <= ranges[i+1] {
+					return true
+				}
+			}
+			for _, item := range items {
+				if item(r) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for first := true; ; first = false {
+		if !p.more() {
+			p.fail("premature end of char-class")
+		}
+		if p.peek() == ']' && !first {
+			p.pos++
+			return union()
+		}
+		if p.consume("&&") {
+			left, right := union(), p.parseClassBody()
+			return func(r rune) bool {
+				return left(r) && right(r)
+			}
+		}
+		if strings.HasPrefix(p.src[p.pos:], "[:") {
+			if end := strings.Index(p.src[p.pos+2:], ":]"); end >= 0 {
+				name := p.src[p.pos+2 : p.pos+2+end]
+				negate := strings.HasPrefix(name, "^")
+				if match, ok := posixClasses[strings.TrimPrefix(name, "^")]; ok {
+					p.pos += end + 4
+					if negate {
+						match = negateRunes(match)
+					}
+					items = append(items, match)
+					continue
+				}
+			}
+		}
+		if p.consume("[") {
+			items = append(items, p.parseClass())
+			continue
+		}
+
+		lo, match := p.parseClassAtom()
+		if match != nil {
+			items = append(items, match)
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], "-") && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+			p.pos++
+			hi, match := p.parseClassAtom()
+			if match != nil {
+				p.fail("char-class value at end of range")
+			}
+			if hi < lo {
+				p.fail("empty range in char class")
+			}
+			ranges = append(ranges, lo, hi)
+		} else {
+			ranges = append(ranges, lo, lo)
+		}
+	}
+}
+
+// parseClassAtom reads one class member: either a single character or a set
+// such as \w or \p{Greek}.
+func (p *reParser) parseClassAtom() (rune, func(rune) bool) {
+	c := p.next()
+	if c != '\\' {
+		return c, nil
+	}
+	if !p.more() {
+		p.fail("end pattern at escape")
+	}
+	c = p.next()
+	switch c {
+	case 'w', 'W', 'd', 'D', 's', 'S', 'h', 'H':
+		return 0, p.shorthand(c)
+	case 'p', 'P':
+		return 0, p.parseProperty(c == 'P')
+	}
+	runes := p.parseCharEscape(c, true)
+	if len(runes) == 1 {
+		return runes[0], nil
+	}
+	return 0, func(r rune) bool {
+		for _, c := range runes {
+			if r == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func compileRegexp(expr string) (re *Regexp, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			syntaxErr, ok := e.(reSyntaxError)
+			if !ok {
+				panic(e)
+			}
+			re, err = nil, RegexpError{syntaxErr.message + ": /" + expr + "/"}
+		}
+	}()
+
+	p := &reParser{src: expr}
+	root := p.parseAlternation()
+	if p.more() {
+		p.fail("unmatched close parenthesis")
+	}
+
+	numCap := len(p.captures)
+	if p.named {
+		if p.numbered {
+			p.fail("numbered backref/call is not allowed. (use name)")
+		}
+		// like Ruby, plain groups stop capturing once a named group is present
+		numCap = 0
+		for _, c := range p.captures {
+			if c.name == "" {
+				c.op = reGroup
+			} else {
+				numCap++
+				c.group = numCap
+			}
+		}
+	}
+	names := make([]string, numCap+1)
+	captures := make([]*reNode, numCap+1)
+	for _, c := range p.captures {
+		if c.op == reCapture {
+			names[c.group] = c.name
+			captures[c.group] = c
+		}
+	}
+	for _, ref := range p.refs {
+		if ref.name != "" {
+			for i, name := range names {
+				if name == ref.name {
+					ref.groups = append(ref.groups, i)
+				}
+			}
+			if len(ref.groups) == 0 {
+				p.fail("undefined name <" + ref.name + "> reference")
+			}
+			if ref.op == reCall && len(ref.groups) > 1 {
+				p.fail("multiplex defined name <" + ref.name + "> call")
+			}
+		} else {
+			if ref.group < 0 || ref.group > numCap || ref.group == 0 && ref.op != reCall {
+				p.fail("invalid backref number/name")
+			}
+			ref.groups = []int{ref.group}
+		}
+	}
+
+	c := &reCompiler{nslots: 2 * (numCap + 1), memo: true}
+	c.emit(reInst{op: iSave, n: 0})
+	c.compile(root)
+	c.emit(reInst{op: iSave, n: 1})
+	c.emit(reInst{op: iSucceed})
+
+	// subexpression calls jump to a copy of the group compiled as a subroutine
+	labels := make(map[int]int)
+	for _, ref := range p.refs {
+		if ref.op != reCall {
+			continue
+		}
+		g := ref.groups[0]
+		if _, ok := labels[g]; ok {
+			continue
+		}
+		labels[g] = len(c.prog)
+		if g == 0 {
+			c.compile(root)
+		} else {
+			c.emit(reInst{op: iSave, n: 2 * g})
+			c.compile(captures[g].subs[0])
+			c.emit(reInst{op: iSave, n: 2*g + 1})
+		}
+		c.emit(reInst{op: iReturn})
+	}
+	for i := range c.prog {
+		if c.prog[i].op == iCall {
+			c.prog[i].x = labels[c.prog[i].n]
+		}
+	}
+
+	return &Regexp{
+		expr:   expr,
+		prog:   c.prog,
+		numCap: numCap,
+		names:  names,
+		nslots: c.nslots,
+		nsplit: c.nsplit,
+		memo:   c.memo,
+	}, nil
+}
+
+type reInstOp uint8
+
+const (
+	iRune reInstOp = iota
+	iAny
+	iClass
+	iSplit
+	iJmp
+	iSave
+	iNullCheck
+	iAssert
+	iBackref
+	iLook
+	iAtomic
+	iAbsent
+	iCond
+	iCall
+	iReturn
+	iSucceed
+)
+
+type reInst struct {
+	op       reInstOp
+	r        rune
+	fold     bool
+	dotAll   bool
+	match    func(rune) bool
+	x, y     int
+	n        int
+	groups   []int
+	min, max int
+	behind   bool
+	negate   bool
+}
+
+// reCompiler turns the syntax tree into a program for the backtracking
+// machine. Memoization stays enabled only while nothing makes the outcome of
+// a state depend on more than its instruction and position.
+type reCompiler struct {
+	prog   []reInst
+	nslots int
+	nsplit int
+	memo   bool
+	// nullSlots are the start slots of the loops with a nullable body being
+	// compiled
+	nullSlots []int
+}
+
+func (c *reCompiler) emit(inst reInst) int {
+	if len(c.prog) >= reMaxProgram {
+		panic(reSyntaxError{"regular expression too big"})
+	}
+	if inst.op == iSplit {
+		inst.n = c.nsplit
+		c.nsplit++
+		// a split inside a nullable loop body depends on whether the
+		// iteration has consumed anything yet, which the machine checks
+		// before memoizing it
+		if len(c.nullSlots) > 0 {
+			inst.groups = append([]int(nil), c.nullSlots...)
+		}
+	}
+	c.prog = append(c.prog, inst)
+	return len(c.prog) - 1
+}
+
+// sub compiles a subpattern run by its own machine, like a lookaround body.
+func (c *reCompiler) sub(inst reInst, node *reNode) {
+	at := c.emit(inst)
+	c.prog[at].x = at + 1
+	c.compile(node)
+	c.emit(reInst{op: iSucceed})
+	c.prog[at].y = len(c.prog)
+}
+
+func (c *reCompiler) compile(node *reNode) {
+	switch node.op {
+	case reLiteral:
+		c.emit(reInst{op: iRune, r: node.r, fold: node.fold})
+	case reAnyChar:
+		c.emit(reInst{op: iAny, dotAll: node.dotAll})
+	case reCharClass:
+		c.emit(reInst{op: iClass, match: node.match})
+	case reConcat:
+		for _, sub := range node.subs {
+			c.compile(sub)
+		}
+	case reAlternate:
+		last := len(node.subs) - 1
+		jumps := make([]int, 0, last)
+		for _, sub := range node.subs[:last] {
+			split := c.emit(reInst{op: iSplit})
+			c.prog[split].x = split + 1
+			c.compile(sub)
+			jumps = append(jumps, c.emit(reInst{op: iJmp}))
+			c.prog[split].y = len(c.prog)
+		}
+		c.compile(node.subs[last])
+		for _, jump := range jumps {
+			c.prog[jump].x = len(c.prog)
+		}
+	case reGroup:
+		c.compile(node.subs[0])
+	case reCapture:
+		c.emit(reInst{op: iSave, n: 2 * node.group})
+		c.compile(node.subs[0])
+		c.emit(reInst{op: iSave, n: 2*node.group + 1})
+	case reRepeat:
+		c.compileRepeat(node)
+	case reLook:
+		min, max := node.subs[0].lengths()
+		c.sub(reInst{op: iLook, behind: node.behind, negate: node.negate, min: min, max: max}, node.subs[0])
+	case reAtomic:
+		c.sub(reInst{op: iAtomic}, node.subs[0])
+	case reAbsent:
+		c.sub(reInst{op: iAbsent}, node.subs[0])
+	case reBackref:
+		c.memo = false
+		c.emit(reInst{op: iBackref, groups: node.groups, fold: node.fold})
+	case reCall:
+		c.memo = false
+		c.emit(reInst{op: iCall, n: node.groups[0]})
+	case reCond:
+		c.memo = false
+		cond := c.emit(reInst{op: iCond, groups: node.groups})
+		c.prog[cond].x = cond + 1
+		c.compile(node.subs[0])
+		jump := c.emit(reInst{op: iJmp})
+		c.prog[cond].y = len(c.prog)
+		if len(node.subs) > 1 {
+			c.compile(node.subs[1])
+		}
+		c.prog[jump].x = len(c.prog)
+	case reAssert:
+		if node.assert == assertSearchStart {
+			c.memo = false
+		}
+		c.emit(reInst{op: iAssert, n: int(node.assert)})
+	case reKeep:
+		c.emit(reInst{op: iSave, n: 0})
+	}
+}
+
+func (c *reCompiler) compileRepeat(node *reNode) {
+	if node.possessive {
+		greedy := *node
+		greedy.possessive = false
+		c.compile(&reNode{op: reAtomic, subs: []*reNode{&greedy}})
+		return
+	}
+	body := node.subs[0]
+	for i := 0; i < node.min; i++ {
+		c.compile(body)
+	}
+	link := func(split, end int) {
+		if node.greedy {
+			c.prog[split].x, c.prog[split].y = split+1, end
+		} else {
+			c.prog[split].x, c.prog[split].y = end, split+1
+		}
+	}
+
+	if node.max < 0 {
+		split := c.emit(reInst{op: iSplit})
+		if min, _ := body.lengths(); min > 0 {
+			c.compile(body)
+			c.emit(reInst{op: iJmp, x: split})
+		} else {
+			// an iteration that matches nothing ends the loop
+			slot := c.nslots
+			c.nslots++
+			c.emit(reInst{op: iSave, n: slot})
+			c.nullSlots = append(c.nullSlots, slot)
+			c.compile(body)
+			c.nullSlots = c.nullSlots[:len(c.nullSlots)-1]
+			c.emit(reInst{op: iNullCheck, n: slot, x: split})
+		}
+		link(split, len(c.prog))
+		return
+	}
+
+	splits := make([]int, 0, node.max-node.min)
+	for i := node.min; i < node.max; i++ {
+		splits = append(splits, c.emit(reInst{op: iSplit}))
+		c.compile(body)
+	}
+	for _, split := range splits {
+		link(split, len(c.prog))
+	}
+}
@@ -0,0 +1,186 @@
+package rb
+
+import (
+	"testing"
+	"time"
+	"strings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexp_Match(t *testing.T) {
+	tests := []struct {
+		pattern, input string
+		expected       []string
+	}{
+		{`a+b`, "xaab", []string{"aab"}},
+		{`(?i)hello`, "say HeLLo", []string{"HeLLo"}},
+		{`(?i:[a-c]+)d`, "xABcd", []string{"ABcd"}},
+		{`foo(?=bar)`, "foobaz foobar", []string{"foo"}},
+		{`foo(?!bar)\w`, "foobar foobaz", []string{"foob"}},
+		{`(?<=\$)\d+`, "cost: $42", []string{"42"}},
+		{`(?<!\$)\b\d+`, "$42 17", []string{"17"}},
+		{`(?<=ab|c)x`, "cx", []string{"x"}},
+		{`(\w)\1`, "abccd", []string{"cc", "c"}},
+		{`(?i)(a)\1`, "aA", []string{"aA", "a"}},
+		{`(?<q>['"]).*?\k<q>`, `say "hi" 'x'`, []string{`"hi"`, `"`}},
+		{`(?>a+)b`, "aaab", []string{"aaab"}},
+		{`(?>a+)ab`, "aaab", nil},
+		{`a++b`, "aaab", []string{"aaab"}},
+		{`a++ab`, "aaab", nil},
+		{`a{2}+`, "aaaaa", []string{"aaaa"}},
+		{`\h+`, "zz1fz", []string{"1f"}},
+		{`(<)?\w+(?(1)>)`, "<tag>", []string{"<tag>", "<"}},
+		{`(<)?\w+(?(1)>|!)`, "tag!", []string{"tag!", ""}},
+		{`/\*(?~\*/)\*/`, "/* a */ b */", []string{"/* a */"}},
+		{`\((?:[^()]|\g<0>)*\)`, "x(a(b)c)d", []string{"(a(b)c)"}},
+		{`(?<n>\d+)-\g<n>`, "12-345", []string{"12-345", "345"}},
+		{`^b`, "a\nb", []string{"b"}},
+		{`a$`, "a\nb", []string{"a"}},
+		{`a.b`, "a\nb", nil},
+		{`(?m)a.b`, "a\nb", []string{"a\nb"}},
+		{`(?x) a \s+ b # trailing comment`, "a   b", []string{"a   b"}},
+		{`[a-z&&[^aeiou]]+`, "aeibcd", []string{"bcd"}},
+		{`[[:alpha:]]+`, "123héllo", []string{"héllo"}},
+		{`\p{Greek}+`, "abc αβγ", []string{"αβγ"}},
+		{`[^\p{L}\s]+`, "ab 12 cd", []string{"12"}},
+		{`\u{48 49}\x21`, "HI!", []string{"HI!"}},
+		{`\xE3\x81\x82`, "あ", []string{"あ"}},
+		{`a{2,3}`, "aaaa", []string{"aaa"}},
+		{`a{2,3}?`, "aaaa", []string{"aa"}},
+		{`a{,2}b`, "aaab", []string{"aab"}},
+		{`x{a}`, "x{a}", []string{"x{a}"}},
+		{`foo\Kbar`, "foobar", []string{"bar"}},
+		{`a\Z`, "a\n", []string{"a"}},
+		{`a\z`, "a\n", nil},
+		{`\Aa`, "ba", nil},
+		{`\w+`, "héllo", []string{"h"}},
+		{`(?u)\w+`, "héllo", []string{"héllo"}},
+		{`\R`, "a\r\nb", []string{"\r\n"}},
+		{`(a*)*b`, "aaac", nil},
+		{`(a|)*c`, "aac", []string{"aac", ""}},
+		{`(?<a>x)(y)`, "xy", []string{"xy", "x"}},
+		{`(?#comment)a`, "a", []string{"a"}},
+	}
+	for _, test := range tests {
+		re, err := CompileRegexp(test.pattern)
+		if !assert.Nil(t, err, "/%s/", test.pattern) {
+			continue
+		}
+		index := re.FindStringSubmatchIndex(test.input)
+		if test.expected == nil {
+			assert.Nil(t, index, "/%s/ =~ %q", test.pattern, test.input)
+			continue
+		}
+		if !assert.NotNil(t, index, "/%s/ =~ %q", test.pattern, test.input) {
+			continue
+		}
+		groups := make([]string, len(index)/2)
+		for i := range groups {
+			if index[2*i] >= 0 {
+				groups[i] = test.input[index[2*i]:index[2*i+1]]
+			}
+		}
+		assert.Equal(t, test.expected, groups, "/%s/ =~ %q", test.pattern, test.input)
+	}
+}
+
+func TestRegexp_Errors(t *testing.T) {
+	tests := []struct {
+		pattern, message string
+	}{
+		{`(a`, "end pattern with unmatched parenthesis: /(a/"},
+		{`a)`, "unmatched close parenthesis: /a)/"},
+		{`*a`, "target of repeat operator is not specified: /*a/"},
+		{`[b-a]`, "empty range in char class: /[b-a]/"},
+		{`[a`, "premature end of char-class: /[a/"},
+		{`(a)\2`, `invalid backref number/name: /(a)\2/`},
+		{`(?<n>a)\1`, `numbered backref/call is not allowed. (use name): /(?<n>a)\1/`},
+		{`\k<x>`, `undefined name <x> reference: /\k<x>/`},
+		{`\p{Foo}`, `invalid character property name {Foo}: /\p{Foo}/`},
+		{`(?z)`, "undefined group option: /(?z)/"},
+		{`a{3,2}`, "upper bound must be greater than lower bound: /a{3,2}/"},
+		{`a{100001}`, "too big number for repeat range: /a{100001}/"},
+		{`a\`, `end pattern at escape: /a\/`},
+	}
+	for _, test := range tests {
+		_, err := CompileRegexp(test.pattern)
+		assert.Equal(t, RegexpError{test.message}, err, "/%s/", test.pattern)
+	}
+}
+
+func TestRegexp_Names(t *testing.T) {
+	re := MustCompileRegexp(`(?<year>\d+)-(?<month>\d+)|(?<year>\d+)`)
+	assert.Equal(t, 3, re.NumSubexp(), "NumSubexp")
+	assert.Equal(t, []string{"", "year", "month", "year"}, re.SubexpNames(), "SubexpNames")
+	assert.Equal(t, 3, re.SubexpIndex("year"), "SubexpIndex of a duplicated name")
+	assert.Equal(t, -1, re.SubexpIndex("day"), "SubexpIndex of an unknown name")
+}
+
+func TestRegexp_FindAll(t *testing.T) {
+	assert.Equal(t, [][]int{{0, 3}, {3, 3}}, MustCompileRegexp(`\w*`).FindAllStringSubmatchIndex("abc", -1), "empty match after a match")
+	assert.Equal(t, [][]int{{0, 1}, {1, 2}}, MustCompileRegexp(`\Ga`).FindAllStringSubmatchIndex("aaba", -1), `\G anchors at the previous match`)
+	assert.Equal(t, [][]int{{0, 1}}, MustCompileRegexp(`a`).FindAllStringSubmatchIndex("aaa", 1), "limit")
+
+	index, err := MustCompileRegexp(`bar`).MatchAt("foobar", 3)
+	assert.Nil(t, err, "MatchAt")
+	assert.Equal(t, []int{3, 6}, index, "MatchAt")
+	index, _ = MustCompileRegexp(`bar`).MatchAt("foobar", 2)
+	assert.Nil(t, index, "MatchAt is anchored")
+}
+
+func TestRegexp_Memoization(t *testing.T) {
+	input := strings.Repeat("a", 5000)
+	start := time.Now()
+	assert.False(t, MustCompileRegexp(`(a|a)*b`).MatchString(input), "(a|a)*b")
+	assert.False(t, MustCompileRegexp(`^(a+)+$`).MatchString(input+"!"), "^(a+)+$")
+	assert.False(t, MustCompileRegexp(`^(\w+\s?)*$`).MatchString(input+"!"), `^(\w+\s?)*$`)
+	assert.False(t, MustCompileRegexp(`^(\w*)*$`).MatchString(input+"!"), `^(\w*)*$`)
+	assert.True(t, MustCompileRegexp(`(\w*)*$`).MatchString(input+"!"), `(\w*)*$`)
+	assert.False(t, MustCompileRegexp(`^(a?)*(a?b?)*$`).MatchString(input+"!"), `^(a?)*(a?b?)*$`)
+	assert.True(t, time.Since(start) < 5*time.Second, "memoized matches run in polynomial time")
+
+	input = strings.Repeat("ab cd ", 100000)
+	start = time.Now()
+	assert.Equal(t, 200000, len(MustCompileRegexp(`(?:a|b|c|d)+`).FindAllStringSubmatchIndex(input, -1)), "FindAll")
+	assert.True(t, time.Since(start) < 5*time.Second, "searches that end quickly allocate no memo")
+
+	index, _ := MustCompileRegexp(`(a|)*b`).Search("aab", 0)
+	assert.Equal(t, []int{0, 3, 2, 2}, index, "an empty iteration ends the loop")
+}
+
+func TestRegexp_Timeout(t *testing.T) {
+	re := MustCompileRegexp(`(a+)+b\1`).WithTimeout(20 * time.Millisecond)
+	_, err := re.Search(strings.Repeat("a", 40), 0)
+	assert.Equal(t, RegexpTimeoutError{"regexp match timeout"}, err, "timeout")
+	assert.Panics(t, func() {
+		NewString(strings.Repeat("a", 40)).Gsub(re, "")
+	}, "timeout through Pattern")
+
+	index, err := re.Search("aaba", 0)
+	assert.Nil(t, err, "fast match within timeout")
+	assert.Equal(t, []int{0, 4, 1, 2}, index, "fast match within timeout")
+}
+
+func TestRegexp_String(t *testing.T) {
+	str := NewString("hello world")
+	assert.Equal(t, "hell0 world", str.Gsub(MustCompileRegexp(`o(?= )`), "0").Value, "Gsub")
+	assert.Equal(t, "hello", str.Sub(MustCompileRegexp(`(?<=o) w\w+`), "").Value, "Sub")
+	assert.Equal(t, "[][o] w[o]rld", str.Gsub(MustCompileRegexp(`^hell|(?<v>o)`), `[\k<v>]`).Value, "Gsub with named reference")
+
+	sub, ok := NewString("price: 42€").OpSubscript(MustCompileRegexp(`\d+(?=€)`))
+	assert.True(t, ok, "OpSubscript OK")
+	assert.Equal(t, "42", sub.Value, "OpSubscript")
+	sub, ok = NewString("key=value").OpSubscript2(MustCompileRegexp(`(\w+)=(\w+)`), 2)
+	assert.True(t, ok, "OpSubscript2 OK")
+	assert.Equal(t, "value", sub.Value, "OpSubscript2")
+
+	pos, m := NewString("红宝石 ruby").OpMatch(MustCompileRegexp(`(?<=\s)(?<lang>\w+)`))
+	assert.Equal(t, 4, pos, "OpMatch position")
+	assert.Equal(t, "ruby", *m.NamedCaptures()["lang"], "OpMatch named captures")
+
+	m, ok = NewString("foobar").Match(MustCompileRegexp(`(?<=foo)bar`), 3)
+	assert.True(t, ok, "Match from position sees preceding text")
+	assert.Equal(t, "foo", m.PreMatch(), "PreMatch")
+
+	assert.Equal(t, []interface{}{NewString("abc"), NewString("")}, NewString("abc").Scan(MustCompileRegexp(`\w*`)), "Scan empty matches")
+}
@@ -0,0 +1,546 @@
+package rb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	flagSpace = 1 << iota
+	flagSharp
+	flagPlus
+	flagMinus
+	flagZero
+	flagWidth
+	flagPrecision
+)
+
+type formatSpec struct {
+	flags     int
+	width     int
+	precision int
+}
+
+const (
+	argsNone = iota
+	argsUnnumbered
+	argsNumbered
+	argsNamed
+)
+
+type formatArgs struct {
+	values []interface{}
+	next   int
+	mode   int
+}
+
+func (a *formatArgs) nth(n int) (interface{}, error) {
+	if n >= len(a.values) {
+		return nil, ArgumentError{"too few arguments"}
+	}
+	return a.values[n], nil
+}
+
+func (a *formatArgs) nextArg() (interface{}, error) {
+	switch a.mode {
+	case argsNumbered:
+		return nil, ArgumentError{"unnumbered(" + strconv.Itoa(a.next+1) + ") mixed with numbered"}
+	case argsNamed:
+		return nil, ArgumentError{"unnumbered(" + strconv.Itoa(a.next+1) + ") mixed with named"}
+	}
+	a.mode = argsUnnumbered
+	a.next++
+	return a.nth(a.next - 1)
+}
+
+func (a *formatArgs) numberedArg(n int) (interface{}, error) {
+	switch a.mode {
+	case argsUnnumbered:
+		return nil, ArgumentError{"numbered(" + strconv.Itoa(n) + ") after unnumbered(" + strconv.Itoa(a.next) + ")"}
+	case argsNamed:
+		return nil, ArgumentError{"numbered(" + strconv.Itoa(n) + ") after named"}
+	}
+	if n < 1 {
+		return nil, ArgumentError{"invalid index - " + strconv.Itoa(n) + "$"}
+	}
+	a.mode = argsNumbered
+	return a.nth(n - 1)
+}
+
+func (a *formatArgs) namedArg(name string, quoted string) (interface{}, error) {
+	switch a.mode {
+	case argsUnnumbered:
+		return nil, ArgumentError{"named" + quoted + " after unnumbered(" + strconv.Itoa(a.next) + ")"}
+	case argsNumbered:
+		return nil, ArgumentError{"named" + quoted + " after numbered"}
+	}
+	a.mode = argsNamed
+	if len(a.values) != 1 {
+		return nil, ArgumentError{"one hash required"}
+	}
+	hash := reflect.ValueOf(a.values[0])
+	if hash.Kind() != reflect.Map || hash.Type().Key().Kind() != reflect.String {
+		return nil, ArgumentError{"one hash required"}
+	}
+	value := hash.MapIndex(reflect.ValueOf(name).Convert(hash.Type().Key()))
+	if !value.IsValid() {
+		return nil, KeyError{"key" + quoted + " not found"}
+	}
+	return value.Interface(), nil
+}
+
+func (a *formatArgs) check() error {
+	if a.mode == argsUnnumbered && a.next < len(a.values) || a.mode == argsNone && len(a.values) > 0 {
+		return ArgumentError{"too many arguments for format string"}
+	}
+	return nil
+}
+
+func formatToS(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Float32, reflect.Float64:
+		return inspectFloat(reflect.ValueOf(value).Float())
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return Inspect(value)
+	}
+	return fmt.Sprint(value)
+}
+
+func integerValue(value interface{}) (n *big.Int, ok bool, err error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, true, RangeError{strconv.FormatFloat(f, 'g', -1, 64) + " out of range of integer"}
+		}
+		n, _ := big.NewFloat(math.Trunc(f)).Int(nil)
+		return n, true, nil
+	}
+	if n, ok := value.(*big.Int); ok {
+		return n, true, nil
+	}
+	return nil, false, nil
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case String, string:
+		return "String"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func (spec formatSpec) pad(buf *bytes.Buffer, s string) {
+	fill := 0
+	if spec.flags&flagWidth != 0 {
+		fill = spec.width - utf8.RuneCountInString(s)
+	}
+	if spec.flags&flagMinus == 0 {
+		buf.WriteString(strings.Repeat(" ", max(fill, 0)))
+	}
+	buf.WriteString(s)
+	if spec.flags&flagMinus != 0 {
+		buf.WriteString(strings.Repeat(" ", max(fill, 0)))
+	}
+}
+
+// padNumber zero-fills between the sign/prefix and the digits when the 0 flag applies.
+func (spec formatSpec) padNumber(buf *bytes.Buffer, prefix, digits string, fill byte) {
+	if spec.flags&(flagZero|flagWidth) == flagZero|flagWidth && spec.flags&flagMinus == 0 {
+		if n := spec.width - len(prefix) - len(digits); n > 0 {
+			digits = strings.Repeat(string(fill), n) + digits
+		}
+	}
+	spec.pad(buf, prefix+digits)
+}
+
+func (spec formatSpec) sign(negative bool) string {
+	if negative {
+		return "-"
+	} else if spec.flags&flagPlus != 0 {
+		return "+"
+	} else if spec.flags&flagSpace != 0 {
+		return " "
+	}
+	return ""
+}
+
+func (spec formatSpec) formatInteger(buf *bytes.Buffer, n *big.Int, verb byte) {
+	base := 10
+	prefix := ""
+	switch verb {
+	case 'o':
+		base, prefix = 8, "0"
+	case 'x':
+		base, prefix = 16, "0x"
+	case 'X':
+		base, prefix = 16, "0X"
+	case 'b':
+		base, prefix = 2, "0b"
+	case 'B':
+		base, prefix = 2, "0B"
+	}
+	if spec.flags&flagSharp == 0 || base == 10 || n.Sign() == 0 {
+		prefix = ""
+	}
+
+	if n.Sign() < 0 && base != 10 && spec.flags&(flagPlus|flagSpace) == 0 {
+		// two's complement notation: ..f01
+		shift := uint(bits.Len(uint(base - 1)))
+		maxDigit := strconv.FormatInt(int64(base-1), base)
+		mask := big.NewInt(int64(base - 1))
+		minusOne := big.NewInt(-1)
+		digits := make([]byte, 0, 8)
+		rest := new(big.Int).Set(n)
+		for rest.Cmp(minusOne) != 0 {
+			digit := new(big.Int).And(rest, mask)
+			digits = append(digits, strconv.FormatInt(digit.Int64(), base)[0])
+			rest.Rsh(rest, shift)
+		}
+		digits = append(digits, maxDigit[0])
+		for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+			digits[i], digits[j] = digits[j], digits[i]
+		}
+		body := string(digits)
+		if verb == 'X' {
+			body = strings.ToUpper(body)
+			maxDigit = strings.ToUpper(maxDigit)
+		}
+		target := 0
+		if spec.flags&flagPrecision != 0 {
+			target = spec.precision
+		} else if spec.flags&(flagZero|flagWidth) == flagZero|flagWidth && spec.flags&flagMinus == 0 {
+			target = spec.width - len(prefix)
+		}
+		if n := target - 2 - len(body); n > 0 {
+			body = strings.Repeat(maxDigit, n) + body
+		}
+		spec.pad(buf, prefix+".."+body)
+		return
+	}
+
+	digits := new(big.Int).Abs(n).Text(base)
+	if verb == 'X' || verb == 'B' {
+		digits = strings.ToUpper(digits)
+	}
+	if spec.flags&flagPrecision != 0 {
+		if spec.precision == 0 && n.Sign() == 0 {
+			digits = ""
+		} else if len(digits) < spec.precision {
+			digits = strings.Repeat("0", spec.precision-len(digits)) + digits
+		}
+		spec.flags &^= flagZero
+	}
+	if verb == 'o' && prefix != "" && strings.HasPrefix(digits, "0") {
+		prefix = ""
+	}
+	spec.padNumber(buf, spec.sign(n.Sign() < 0)+prefix, digits, '0')
+}
+
+func (spec formatSpec) formatFloat(buf *bytes.Buffer, f float64, verb byte) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		body := "Inf"
+		if math.IsNaN(f) {
+			body = "NaN"
+		}
+		spec.pad(buf, spec.sign(math.IsInf(f, -1))+body)
+		return
+	}
+	precision := 6
+	if spec.flags&flagPrecision != 0 {
+		precision = spec.precision
+	}
+	negative := math.Signbit(f)
+	var digits string
+	switch verb {
+	case 'a', 'A':
+		if spec.flags&flagPrecision == 0 {
+			precision = -1
+		}
+		digits = strconv.FormatFloat(math.Abs(f), 'x', precision, 64)
+		// C prints the binary exponent without zero padding: 0x1p+0
+		if i := strings.LastIndexAny(digits, "+-"); i >= 0 && digits[i+1] == '0' && i+2 < len(digits) {
+			digits = digits[:i+1] + digits[i+2:]
+		}
+		if verb == 'A' {
+			digits = strings.ToUpper(digits)
+		}
+		spec.padNumber(buf, spec.sign(negative)+digits[:2], digits[2:], '0')
+		return
+	}
+	flags := ""
+	if spec.flags&flagSharp != 0 {
+		flags = "#"
+	}
+	digits = fmt.Sprintf("%"+flags+"."+strconv.Itoa(precision)+string(verb), math.Abs(f))
+	spec.padNumber(buf, spec.sign(negative), digits, '0')
+}
+
+// parseNumber reads a decimal number at format[i:], returning the index after it.
+func parseNumber(format string, i int) (n int, next int, err error) {
+	for next = i; next < len(format) && format[next] >= '0' && format[next] <= '9'; next++ {
+		n = n*10 + int(format[next]-'0')
+		if n > math.MaxInt32 {
+			return 0, next, ArgumentError{"width too big"}
+		}
+	}
+	return
+}
+
+func (str String) Format(params ...interface{}) (String, error) {
+	format := str.Value
+	args := formatArgs{values: params}
+	var buf bytes.Buffer
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+
+		spec := formatSpec{}
+		var value interface{}
+		hasValue := false
+		start := i
+		i++
+
+	PARSE:
+		for ; i < len(format); i++ {
+			c = format[i]
+			switch c {
+			case ' ':
+				spec.flags |= flagSpace
+			case '#':
+				spec.flags |= flagSharp
+			case '+':
+				spec.flags |= flagPlus
+			case '-':
+				spec.flags |= flagMinus
+			case '0':
+				spec.flags |= flagZero
+			case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				n, next, err := parseNumber(format, i)
+				if err != nil {
+					return str, err
+				}
+				if next < len(format) && format[next] == '$' {
+					if hasValue {
+						return str, ArgumentError{"value given twice - " + strconv.Itoa(n) + "$"}
+					}
+					if value, err = args.numberedArg(n); err != nil {
+						return str, err
+					}
+					hasValue = true
+					i = next
+					continue
+				}
+				if spec.flags&flagWidth != 0 {
+					return str, ArgumentError{"width given twice"}
+				}
+				spec.width = n
+				spec.flags |= flagWidth
+				i = next - 1
+			case '<', '{':
+				term := byte('>')
+				if c == '{' {
+					term = '}'
+				}
+				end := strings.IndexByte(format[i:], term)
+				if end < 0 {
+					return str, ArgumentError{"malformed name - unmatched parenthesis"}
+				}
+				quoted := format[i : i+end+1]
+				if hasValue {
+					return str, ArgumentError{"named" + quoted + " after <" + quoted[1:len(quoted)-1] + ">"}
+				}
+				var err error
+				if value, err = args.namedArg(quoted[1:len(quoted)-1], quoted); err != nil {
+					return str, err
+				}
+				hasValue = true
+				i += end
+				if term == '}' {
+					c = 's'
+					break PARSE
+				}
+			case '*':
+				if spec.flags&flagWidth != 0 {
+					return str, ArgumentError{"width given twice"}
+				}
+				n, err := str.formatStarArg(&args, &i)
+				if err != nil {
+					return str, err
+				}
+				if n < 0 {
+					n = -n
+					spec.flags |= flagMinus
+				}
+				spec.width = n
+				spec.flags |= flagWidth
+			case '.':
+				if spec.flags&flagPrecision != 0 {
+					return str, ArgumentError{"precision given twice"}
+				}
+				spec.flags |= flagPrecision
+				if i+1 < len(format) && format[i+1] == '*' {
+					i++
+					n, err := str.formatStarArg(&args, &i)
+					if err != nil {
+						return str, err
+					}
+					if n < 0 {
+						spec.flags &^= flagPrecision
+					}
+					spec.precision = n
+					continue
+				}
+				n, next, err := parseNumber(format, i+1)
+				if err != nil {
+					return str, err
+				}
+				spec.precision = n
+				i = next - 1
+			default:
+				break PARSE
+			}
+		}
+
+		if i >= len(format) {
+			return str, ArgumentError{"incomplete format specifier; use %% (double %) instead"}
+		}
+
+		if c == '%' {
+			if i != start+1 {
+				return str, ArgumentError{"invalid format character - %"}
+			}
+			buf.WriteByte('%')
+			continue
+		}
+
+		if c == '\n' || c == 0 {
+			buf.WriteByte('%')
+			buf.WriteByte(c)
+			continue
+		}
+
+		if !strings.ContainsRune("cspdiuoxXbBfeEgGaA", rune(c)) {
+			return str, ArgumentError{"malformed format string - %" + string(c)}
+		}
+
+		if !hasValue {
+			var err error
+			if value, err = args.nextArg(); err != nil {
+				return str, err
+			}
+		}
+
+		switch c {
+		case 'c':
+			var s string
+			if v, ok := TryConvert(value); ok {
+				r, _ := utf8.DecodeRuneInString(v.Value)
+				s = string(r)
+				if v.Value == "" {
+					return str, ArgumentError{"%c requires a character"}
+				}
+			} else {
+				n, err := Integer(value, 0)
+				if err != nil {
+					return str, err
+				}
+				s = string(rune(n.Int64()))
+			}
+			spec.pad(&buf, s)
+		case 's', 'p':
+			var s string
+			if c == 's' {
+				s = formatToS(value)
+			} else {
+				s = Inspect(value)
+			}
+			if spec.flags&flagPrecision != 0 {
+				if sub, ok := NewString(s).OpSubscript2(0, spec.precision); ok {
+					s = sub.Value
+				}
+			}
+			spec.pad(&buf, s)
+		case 'd', 'i', 'u', 'o', 'x', 'X', 'b', 'B':
+			n, err := Integer(value, 0)
+			if err != nil {
+				return str, err
+			}
+			spec.formatInteger(&buf, n, c)
+		default:
+			f, err := Float(value)
+			if err != nil {
+				return str, err
+			}
+			spec.formatFloat(&buf, f, c)
+		}
+	}
+
+	if err := args.check(); err != nil {
+		return str, err
+	}
+	return NewString(buf.String()), nil
+}
+
+func (str String) formatStarArg(args *formatArgs, i *int) (int, error) {
+	var value interface{}
+	var err error
+	n, next, err := parseNumber(str.Value, *i+1)
+	if err != nil {
+		return 0, err
+	}
+	if next < len(str.Value) && str.Value[next] == '$' && next > *i+1 {
+		value, err = args.numberedArg(n)
+		*i = next
+	} else {
+		value, err = args.nextArg()
+	}
+	if err != nil {
+		return 0, err
+	}
+	width, err := Integer(value, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !width.IsInt64() || width.Int64() > math.MaxInt32 || width.Int64() < math.MinInt32 {
+		return 0, ArgumentError{"width too big"}
+	}
+	return int(width.Int64()), nil
+}
+
+func (str String) OpPercent(arg interface{}) (String, error) {
+	if args, ok := arg.([]interface{}); ok {
+		return str.Format(args...)
+	}
+	return str.Format(arg)
+}
+
+func Sprintf(format string, args ...interface{}) (String, error) {
+	return NewString(format).Format(args...)
+}
@@ -0,0 +1,106 @@
+package rb
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertFormat(t *testing.T, expected string, format string, args ...interface{}) {
+	ret, err := NewString(format).Format(args...)
+	assert.Nil(t, err, format)
+	assert.Equal(t, expected, ret.Value, format)
+}
+
+func TestString_Format(t *testing.T) {
+	assertFormat(t, "abc", "abc")
+	assertFormat(t, "100%", "%d%%", 100)
+	assertFormat(t, "[  abc]", "[%5s]", "abc")
+	assertFormat(t, "[abc  ]", "[%-5s]", NewString("abc"))
+	assertFormat(t, "[红宝 ]", "[%-3.2s]", "红宝石")
+	assertFormat(t, "+3.14", "%-+05.2f", 3.14159)
+	assertFormat(t, "+3.1 ", "%-+05.1f", 3.14159)
+	assertFormat(t, "-0003.1", "%07.1f", -3.14159)
+	assertFormat(t, " 42", "% d", 42)
+	assertFormat(t, "101", "%b", 5)
+	assertFormat(t, "0b101", "%#b", 5)
+	assertFormat(t, "0xff", "%#x", 255)
+	assertFormat(t, "0XFF", "%#X", 255)
+	assertFormat(t, "0", "%#x", 0)
+	assertFormat(t, "0377", "%#o", 255)
+	assertFormat(t, "..f01", "%x", -255)
+	assertFormat(t, "0x..f01", "%#x", -255)
+	assertFormat(t, "-ff", "%+x", -255)
+	assertFormat(t, "..10101", "%b", -11)
+	assertFormat(t, "..110101", "%08b", -11)
+	assertFormat(t, "            ..fffff5", "%20.8x", -11)
+	assertFormat(t, "            00000123", "%20.8d", 123)
+	assertFormat(t, "", "%.0x", 0)
+	assertFormat(t, "-0000011", "%08d", -11)
+	assertFormat(t, "   42", "%*d", 5, 42)
+	assertFormat(t, "42   ", "%*d", -5, 42)
+	assertFormat(t, "3.14", "%.*f", 2, 3.14159)
+	assertFormat(t, "3", "%d", 3.99)
+	assertFormat(t, "10", "%d", "0b1010")
+	assertFormat(t, "a", "%c", 97)
+	assertFormat(t, "h", "%c", "hello")
+	assertFormat(t, "  红", "%3c", "红宝石")
+	assertFormat(t, `"a\n"`, "%p", "a\n")
+	assertFormat(t, "nil", "%p", nil)
+	assertFormat(t, "1..2", "%p", NewRange(1, 2))
+	assertFormat(t, "1.0 1.0e+20", "%s %s", 1.0, 1e20)
+	assertFormat(t, "[1, 2] {\"a\" => 1}", "%s %s", []int{1, 2}, map[string]int{"a": 1})
+	assertFormat(t, "97 x", "%s %s", 'a', NewString("x"))
+	assertFormat(t, "1.000000e+03", "%e", 1000)
+	assertFormat(t, "1E+06", "%G", 1e6)
+	assertFormat(t, "0x1p+0", "%a", 1.0)
+	assertFormat(t, "Inf", "%f", math.Inf(1))
+	assertFormat(t, "b a", "%2$s %1$s", "a", "b")
+	assertFormat(t, "   42", "%1$*2$d", 42, 5)
+	assertFormat(t, "Bob is 042", "%<name>s is %<age>03d", map[string]interface{}{"name": "Bob", "age": 42})
+	assertFormat(t, "Bob is   42", "%{name} is %<age>4d", map[string]interface{}{"name": "Bob", "age": 42})
+	assertFormat(t, "x=1", "x=%{x}", map[string]int{"x": 1})
+}
+
+func TestString_FormatErrors(t *testing.T) {
+	_, err := NewString("%d %d").Format(1)
+	assert.Equal(t, ArgumentError{"too few arguments"}, err, "too few arguments")
+
+	_, err = NewString("%d").Format(1, 2)
+	assert.Equal(t, ArgumentError{"too many arguments for format string"}, err, "too many arguments")
+
+	_, err = NewString("%<a>s").Format(1, 2)
+	assert.Equal(t, ArgumentError{"one hash required"}, err, "one hash required")
+
+	_, err = NewString("%<a>s").Format(map[string]int{"b": 1})
+	assert.Equal(t, KeyError{"key<a> not found"}, err, "missing key")
+
+	_, err = NewString("%1$s %s").Format(1, 2)
+	assert.Equal(t, ArgumentError{"unnumbered(1) mixed with numbered"}, err, "mixed numbered and unnumbered")
+
+	_, err = NewString("%s %<a>s").Format(map[string]int{"a": 1})
+	assert.Equal(t, ArgumentError{"named<a> after unnumbered(1)"}, err, "named after unnumbered")
+
+	_, err = NewString("%").Format()
+	assert.Equal(t, ArgumentError{"incomplete format specifier; use %% (double %) instead"}, err, "incomplete specifier")
+
+	_, err = NewString("%y").Format(1)
+	assert.Equal(t, ArgumentError{"malformed format string - %y"}, err, "malformed format")
+
+	_, err = NewString("%d").Format("abc")
+	assert.Equal(t, ArgumentError{`invalid value for Integer(): "abc"`}, err, "invalid integer")
+}
+
+func TestString_OpPercent(t *testing.T) {
+	ret, err := NewString("%05.1f").OpPercent(2.25)
+	assert.Nil(t, err)
+	assert.Equal(t, "002.2", ret.Value, "single argument")
+
+	ret, err = NewString("%s-%s").OpPercent([]interface{}{"a", 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "a-1", ret.Value, "array argument")
+
+	ret, err = NewString("%{a}").OpPercent(map[string]string{"a": "x"})
+	assert.Nil(t, err)
+	assert.Equal(t, "x", ret.Value, "hash argument")
+}
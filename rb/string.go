@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"bytes"
 	"strings"
-	"regexp"
+	"unicode"
 	"unicode/utf8"
 	"strconv"
 )
@@ -13,12 +13,18 @@ type AsString interface {
 	ToStr() String
 }
 
+// String holds its encoding and frozen state next to Value, so copies keep
+// both. Go's == sees them; OpEquals and IsEql compare Value only. Build a
+// String with NewString or a keyed literal such as String{Value: "x"}; the
+// unexported fields rule out unkeyed ones.
 type String struct {
-	Value string
+	Value  string
+	enc    *Encoding
+	frozen bool
 }
 
 func NewString(str string) String {
-	return String{str}
+	return String{Value: str}
 }
 
 func (str String) String() string {
@@ -29,7 +35,7 @@ func TryConvert(obj interface{}) (out String, ok bool) {
 	ok = true
 	switch obj.(type) {
 	case string:
-		out = String{obj.(string)}
+		out = NewString(obj.(string))
 	case String:
 		out = obj.(String)
 	default:
@@ -39,10 +45,6 @@ func TryConvert(obj interface{}) (out String, ok bool) {
 	return
 }
 
-func (str String) Format(params ...interface{}) String {
-	return NewString(fmt.Sprintf(str.Value, params...))
-}
-
 func (str String) OpMultiply(times int) String {
 	var buf bytes.Buffer
 	for i := 0; i < times; i++ {
@@ -52,7 +54,7 @@ func (str String) OpMultiply(times int) String {
 }
 
 func (str String) OpAdd(rhs String) String {
-	return String{str.Value + rhs.Value}
+	return str.withValue(str.Value + rhs.Value)
 }
 
 func (str String) Concat(args ...interface{}) String {
@@ -75,8 +77,10 @@ func (str String) Concat(args ...interface{}) String {
 	return NewString(buf.String())
 }
 
-func (str String) OpLtLt(args ...interface{}) String {
-	return str.Concat(args)
+// OpLtLt appends args to str in place, formatted as Concat does.
+func (str *String) OpLtLt(args ...interface{}) error {
+	_, err := str.modify(str.withValue(str.Concat(args...).Value))
+	return err
 }
 
 func (str String) OpSpaceShip(rhs String) int {
@@ -96,17 +100,18 @@ func (str String) OpCaseEquals(obj interface{}) bool {
 	return str.OpEquals(obj)
 }
 
-func (str String) OpMatch(re regexp.Regexp) int {
-	pos := re.FindStringIndex(str.Value)
-	if pos == nil {
-		return -1
-	} else {
-		return pos[0]
+func (str String) OpMatch(re Pattern) (int, MatchData) {
+	m, ok := str.Match(re, 0)
+	if !ok {
+		return -1, m
 	}
+	return str.charIndex(m.index[0]), m
 }
 
-func (str String) OpSubscript(arg interface{}) (ret String, found bool) {
-	if index, ok := arg.(int); ok {
+// subscriptSpan returns the byte span OpSubscript selects.
+func (str String) subscriptSpan(arg interface{}) (from, to int, found bool) {
+	switch index := arg.(type) {
+	case int:
 		strLen := str.Length()
 		if index < 0 {
 			// negative index
@@ -115,83 +120,66 @@ func (str String) OpSubscript(arg interface{}) (ret String, found bool) {
 		if index < 0 || index >= strLen {
 			return
 		}
-		i := 0
-		for _, r := range str.Value {
-			if i == index {
-				return NewString(string(r)), true
-			}
-			i++
-		}
-		return
-	}
-	if rng, ok := arg.(Range); ok {
-		first := rng.First()
-		last := rng.Last()
-		if last < 0 {
-			last = str.Length() + last
-		}
-		if rng.ExcludeEnd() {
-			last -= 1
-		}
-		if last < first {
-			return NewString(""), true
-		}
-		buf := make([]rune, 0, last-first+1)
-		i := 0
-		for _, r := range str.Value {
-			if i > last {
-				break
-			}
-			if i >= first {
-				buf = append(buf, r)
-			}
-			i++
+		from = str.charOffset(index)
+		_, width := utf8.DecodeRuneInString(str.Value[from:])
+		return from, from + width, true
+	case Range[int]:
+		begin, count, ok := rangeBegLen(index, str.Length())
+		if !ok {
+			return
 		}
-		ret = NewString(string(buf))
-		return ret, true
-	}
-	if re, ok := arg.(*regexp.Regexp); ok {
-		pos := re.FindStringIndex(str.Value)
+		from = str.charOffset(begin)
+		return from, from + NewString(str.Value[from:]).charOffset(count), true
+	case Pattern:
+		pos := index.FindStringSubmatchIndex(str.Value)
 		if pos == nil {
 			return
 		}
-		return NewString(str.Value[pos[0]:pos[1]]), true
-	}
-	if s, ok := arg.(String); ok {
-		if index := strings.Index(str.Value, s.Value); index >= 0 {
-			return s, true
-		}
-		return
-	}
-	if s, ok := arg.(string); ok {
-		if index := strings.Index(str.Value, s); index >= 0 {
-			return NewString(s), true
+		return pos[0], pos[1], true
+	case String:
+		return str.subscriptSpan(index.Value)
+	case string:
+		if from = strings.Index(str.Value, index); from >= 0 {
+			return from, from + len(index), true
 		}
 		return
 	}
 	panic("Argument type must be one of: int, Range, *Regexp, string")
 }
 
-func (str String) OpSubscript2(arg1, arg2 interface{}) (ret String, found bool) {
+// subscript2Span returns the byte span OpSubscript2 selects.
+func (str String) subscript2Span(arg1, arg2 interface{}) (from, to int, found bool) {
 	if start, ok := arg1.(int); ok {
 		if length, ok := arg2.(int); ok {
-			if length < 0 {
+			strLen := str.Length()
+			if length < 0 || start > strLen {
 				return
 			}
-			return str.OpSubscript(NewRangeExclusive(start, start+length))
+			if start < 0 {
+				start += strLen
+				if start < 0 {
+					return
+				}
+			}
+			if start+length > strLen {
+				length = strLen - start
+			}
+			from = str.charOffset(start)
+			return from, from + NewString(str.Value[from:]).charOffset(length), true
 		}
 		goto TYPE_ERR
 	}
-	if re, ok := arg1.(*regexp.Regexp); ok {
+	if re, ok := arg1.(Pattern); ok {
 		if capture, ok := arg2.(int); ok {
-			if matches := re.FindStringSubmatch(str.Value); matches != nil {
+			if index := re.FindStringSubmatchIndex(str.Value); index != nil {
+				groups := len(index) / 2
 				if capture < 0 {
-					capture += len(matches)
+					capture += groups
 				}
-				if capture < 0 || capture >= len(matches) {
+				if capture < 0 || capture >= groups || index[capture*2] < 0 {
 					return
 				}
-				return NewString(matches[capture]), true
+				return index[capture*2], index[capture*2+1], true
 			}
 			return
 		}
@@ -202,7 +190,164 @@ TYPE_ERR:
 	panic("Arguments type must be one of: (int, int), (*Regexp, int)")
 }
 
-// TODO #[]=
+func (str String) OpSubscript(arg interface{}) (ret String, found bool) {
+	from, to, found := str.subscriptSpan(arg)
+	if !found {
+		return
+	}
+	return NewString(str.Value[from:to]), true
+}
+
+func (str String) OpSubscript2(arg1, arg2 interface{}) (ret String, found bool) {
+	from, to, found := str.subscript2Span(arg1, arg2)
+	if !found {
+		return
+	}
+	return NewString(str.Value[from:to]), true
+}
+
+func rangeBegLen(rng Range[int], length int) (begin, count int, ok bool) {
+	begin, end := rng.First(), rng.Last()
+	if begin < 0 {
+		begin += length
+		if begin < 0 {
+			return
+		}
+	}
+	if begin > length {
+		return
+	}
+	if end < 0 {
+		end += length
+	}
+	end = min(end, length)
+	if !rng.ExcludeEnd() {
+		end++
+	}
+	count = end - begin
+	if count < 0 {
+		count = 0
+	}
+	if begin+count > length {
+		count = length - begin
+	}
+	return begin, count, true
+}
+
+func (str String) charOffset(index int) int {
+	i := 0
+	for offset := range str.Value {
+		if i == index {
+			return offset
+		}
+		i++
+	}
+	return len(str.Value)
+}
+
+// charIndex converts a byte offset into a character index.
+func (str String) charIndex(offset int) int {
+	return str.withValue(str.Value[:offset]).Length()
+}
+
+func (str String) charSlice(begin, count int) String {
+	from := str.charOffset(begin)
+	to := from + NewString(str.Value[from:]).charOffset(count)
+	return NewString(str.Value[from:to])
+}
+
+func (str String) splice(from, to int, value String) String {
+	return NewString(str.Value[:from] + value.Value + str.Value[to:])
+}
+
+func (str String) update(begin, count int, value String) (String, error) {
+	if count < 0 {
+		return str, IndexError{"negative length " + strconv.Itoa(count)}
+	}
+	strLen := str.Length()
+	if begin > strLen {
+		return str, IndexError{"index " + strconv.Itoa(begin) + " out of string"}
+	}
+	if begin < 0 {
+		if begin+strLen < 0 {
+			return str, IndexError{"index " + strconv.Itoa(begin) + " out of string"}
+		}
+		begin += strLen
+	}
+	if begin+count > strLen {
+		count = strLen - begin
+	}
+	from := str.charOffset(begin)
+	to := from + NewString(str.Value[from:]).charOffset(count)
+	return str.splice(from, to, value), nil
+}
+
+func (str String) updateSubpattern(re Pattern, capture interface{}, value String) (String, error) {
+	index := re.FindStringSubmatchIndex(str.Value)
+	if index == nil {
+		return str, IndexError{"regexp not matched"}
+	}
+	groups := len(index) / 2
+	var nth int
+	switch c := capture.(type) {
+	case int:
+		nth = c
+		if nth >= groups || -nth >= groups {
+			return str, IndexError{"index " + strconv.Itoa(nth) + " out of regexp"}
+		}
+		if nth < 0 {
+			nth += groups
+		}
+	case string:
+		nth = re.SubexpIndex(c)
+		if nth < 0 {
+			return str, IndexError{"undefined group name reference: " + c}
+		}
+	case String:
+		return str.updateSubpattern(re, c.Value, value)
+	default:
+		panic("Capture type must be one of: int, string, String")
+	}
+	if index[nth*2] < 0 {
+		return str, IndexError{"regexp group " + strconv.Itoa(nth) + " not matched"}
+	}
+	return str.splice(index[nth*2], index[nth*2+1], value), nil
+}
+
+func (str String) OpSubscriptAssign(arg interface{}, value String) (String, error) {
+	switch index := arg.(type) {
+	case int:
+		return str.update(index, 1, value)
+	case Range[int]:
+		begin, count, ok := rangeBegLen(index, str.Length())
+		if !ok {
+			return str, RangeError{index.Inspect() + " out of range"}
+		}
+		return str.update(begin, count, value)
+	case Pattern:
+		return str.updateSubpattern(index, 0, value)
+	case String:
+		return str.OpSubscriptAssign(index.Value, value)
+	case string:
+		from := strings.Index(str.Value, index)
+		if from < 0 {
+			return str, IndexError{"string not matched"}
+		}
+		return str.splice(from, from+len(index), value), nil
+	}
+	panic("Argument type must be one of: int, Range, *Regexp, string")
+}
+
+func (str String) OpSubscript2Assign(arg1, arg2 interface{}, value String) (String, error) {
+	if start, ok := arg1.(int); ok {
+		if length, ok := arg2.(int); ok {
+			return str.update(start, length, value)
+		}
+	} else if re, ok := arg1.(Pattern); ok {
+		return str.updateSubpattern(re, arg2, value)
+	}
+	panic("Arguments type must be one of: (int, int), (*Regexp, int), (*Regexp, string)")
+}
 
 func (str String) IsAsciiOnly() bool {
 	for _, r := range str.Value {
@@ -213,7 +358,10 @@ func (str String) IsAsciiOnly() bool {
 	return true
 }
 
-// TODO #b
+// B returns a copy of str in ASCII-8BIT.
+func (str String) B() String {
+	return str.withEncoding(EncodingASCII8Bit)
+}
 
 func (str String) Bytes() []byte {
 	return []byte(str.Value)
@@ -223,22 +371,148 @@ func (str String) Bytesize() int {
 	return len(str.Value)
 }
 
-// TODO #byteslice
+// checkCharBoundary fails when a byte offset splits a character.
+func (str String) checkCharBoundary(offset int) error {
+	if offset >= len(str.Value) {
+		return nil
+	}
+	boundary := false
+	if str.enc == nil {
+		// only the character starting at the nearest lead byte can cover offset
+		start := offset
+		for start > 0 && offset-start < utf8.UTFMax-1 && !utf8.RuneStart(str.Value[start]) {
+			start--
+		}
+		_, width := utf8.DecodeRuneInString(str.Value[start:])
+		boundary = start == offset || start+width <= offset
+	} else {
+		boundary = str.charBoundaryAfter(offset) == offset
+	}
+	if !boundary {
+		return IndexError{"offset " + strconv.Itoa(offset) + " does not land on character boundary"}
+	}
+	return nil
+}
+
+// Byteindex is Index with byte offsets.
+func (str String) Byteindex(pattern interface{}, offset int) (int, bool, error) {
+	if offset < 0 {
+		offset += len(str.Value)
+	}
+	if offset < 0 || offset > len(str.Value) {
+		return 0, false, nil
+	}
+	if err := str.checkCharBoundary(offset); err != nil {
+		return 0, false, err
+	}
+	index := str.indexFrom(pattern, offset)
+	return max(index, 0), index >= 0, nil
+}
+
+// Byterindex is Rindex with byte offsets.
+func (str String) Byterindex(pattern interface{}, offset int) (int, bool, error) {
+	if offset < 0 {
+		offset += len(str.Value)
+		if offset < 0 {
+			return 0, false, nil
+		}
+	}
+	offset = min(offset, len(str.Value))
+	if err := str.checkCharBoundary(offset); err != nil {
+		return 0, false, err
+	}
+	index := str.rindexFrom(pattern, offset)
+	return max(index, 0), index >= 0, nil
+}
+
+// Byteslice selects bytes by an int index or a Range.
+func (str String) Byteslice(arg interface{}) (String, bool) {
+	switch index := arg.(type) {
+	case int:
+		if index < 0 {
+			index += len(str.Value)
+		}
+		if index < 0 || index >= len(str.Value) {
+			return String{}, false
+		}
+		return str.withValue(str.Value[index : index+1]), true
+	case Range[int]:
+		begin, count, ok := rangeBegLen(index, len(str.Value))
+		if !ok {
+			return String{}, false
+		}
+		return str.withValue(str.Value[begin : begin+count]), true
+	}
+	panic("Argument type must be one of: int, Range")
+}
+
+func (str String) Byteslice2(start, length int) (String, bool) {
+	bytesize := len(str.Value)
+	if length < 0 || start > bytesize {
+		return String{}, false
+	}
+	if start < 0 {
+		start += bytesize
+		if start < 0 {
+			return String{}, false
+		}
+	}
+	length = min(length, bytesize-start)
+	return str.withValue(str.Value[start : start+length]), true
+}
+
+// Bytesplice replaces the bytes a Range selects with value.
+func (str String) Bytesplice(rng Range[int], value String) (String, error) {
+	begin, count, ok := rangeBegLen(rng, len(str.Value))
+	if !ok {
+		return str, RangeError{rng.Inspect() + " out of range"}
+	}
+	return str.Bytesplice2(begin, count, value)
+}
 
-func (str String) Capitalize() String {
-	if str.Value == "" {
-		return str
+// Bytesplice2 replaces length bytes from start with value.
+func (str String) Bytesplice2(start, length int, value String) (String, error) {
+	bytesize := len(str.Value)
+	if length < 0 {
+		return str, IndexError{"negative length " + strconv.Itoa(length)}
+	}
+	if start > bytesize || start < -bytesize {
+		return str, IndexError{"index " + strconv.Itoa(start) + " out of string"}
+	}
+	if start < 0 {
+		start += bytesize
+	}
+	length = min(length, bytesize-start)
+	if err := str.checkCharBoundary(start); err != nil {
+		return str, err
 	}
-	_, width := utf8.DecodeRuneInString(str.Value)
-	return NewString(strings.ToUpper(str.Value[0:width]) + strings.ToLower(str.Value[width:]))
+	if err := str.checkCharBoundary(start + length); err != nil {
+		return str, err
+	}
+	enc, err := compatibleEncoding(str, value)
+	if err != nil {
+		return str, err
+	}
+	return NewString(str.Value[:start] + value.Value + str.Value[start+length:]).withEncoding(enc), nil
+}
+
+// Capitalize turns the first character into titlecase and the rest into
+// lowercase.
+func (str String) Capitalize(options ...CaseOption) String {
+	return str.mapCase(caseCapitalize, options)
 }
 
-func (str String) Casecmp(rhs String) int {
-	return str.Downcase().OpSpaceShip(rhs.Downcase())
+// Casecmp compares the Unicode case folding of both strings.
+func (str String) Casecmp(rhs String) (int, error) {
+	if _, err := compatibleEncoding(str, rhs); err != nil {
+		return 0, err
+	}
+	return str.Downcase(CaseFold).OpSpaceShip(rhs.Downcase(CaseFold)), nil
 }
 
-func (str String) IsCasecmp(rhs String) bool {
-	return str.Downcase().OpEquals(rhs.Downcase())
+func (str String) IsCasecmp(rhs String) (bool, error) {
+	cmp, err := str.Casecmp(rhs)
+	return err == nil && cmp == 0, err
 }
 
 func fillToLength(str String, length int) string {
@@ -260,22 +534,25 @@ func (str String) Center(width int) String {
 }
 
 func (str String) Center2(width int, padstr String) String {
+	return str.CenterWidth(width, padstr, WidthChars)
+}
+
+// CenterWidth centers str in width, measuring str and padstr by mode.
+func (str String) CenterWidth(width int, padstr String, mode WidthMode) String {
 	if padstr.IsEmpty() {
 		panic("Empty padding")
 	}
-	strLen := str.Length()
+	strLen := str.Width(mode)
 	leftPad := (width - strLen) / 2
 	rightPad := width - strLen - leftPad
-	return NewString(fillToLength(padstr, leftPad) + str.Value + fillToLength(padstr, rightPad))
+	return NewString(fillToWidth(padstr, leftPad, mode) + str.Value + fillToWidth(padstr, rightPad, mode))
 }
 
 func (str String) Chars() []String {
-	chars := make([]String, str.Length())
-	i := 0
-	for _, c := range str.Value {
-		chars[i] = NewString(string(c))
-		i++
-	}
+	chars := make([]String, 0, str.Length())
+	str.eachChar(func(s string, _ rune, _ int) {
+		chars = append(chars, str.withValue(s))
+	})
 	return chars
 }
 
@@ -289,19 +566,62 @@ func (str String) Chars_() []rune {
 	return chars
 }
 
+// Chomp removes a trailing "\r\n", "\n" or "\r".
 func (str String) Chomp() String {
 	return str.Chomp1(NewString("\n"))
 }
 
+// Chomp1 removes separator from the end of str. "\n" also removes "\r\n"
+// and "\r", and the empty separator removes all trailing newlines.
 func (str String) Chomp1(separator String) String {
-	if separator.IsEmpty() || !str.EndWith(separator) {
-		return str
+	return str.withValue(str.Value[:str.chompOffset(separator.Value)])
+}
+
+func (str String) chompOffset(separator string) int {
+	s := str.Value
+	switch separator {
+	case "":
+		for strings.HasSuffix(s, "\n") {
+			s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+		}
+		return len(s)
+	case "\n":
+		if strings.HasSuffix(s, "\n") {
+			s = strings.TrimSuffix(s, "\n")
+		}
+		return len(strings.TrimSuffix(s, "\r"))
+	}
+	offset := len(s) - len(separator)
+	if !strings.HasSuffix(s, separator) || str.charBoundaryAfter(offset) != offset {
+		return len(s)
+	}
+	return offset
+}
+
+// charBoundaryAfter returns the first character boundary at or after offset.
+func (str String) charBoundaryAfter(offset int) int {
+	i := 0
+	str.eachChar(func(s string, _ rune, _ int) {
+		if i < offset {
+			i += len(s)
+		}
+	})
+	return i
+}
+
+// Chop removes the last character, or a trailing "\r\n".
+func (str String) Chop() String {
+	if strings.HasSuffix(str.Value, "\r\n") {
+		return str.withValue(str.Value[:len(str.Value)-2])
 	}
-	result, _ := str.OpSubscript(NewRangeExclusive(0, -separator.Length()))
-	return result
+	last := 0
+	str.eachChar(func(s string, _ rune, _ int) {
+		last = len(s)
+	})
+	return str.withValue(str.Value[:len(str.Value)-last])
 }
 
-func trSetupTable(charSet String, includes, excludes map[rune]bool, intersect *bool) {
+func trSetupTable(charSet String, includes, excludes map[rune]bool, intersect *bool) error {
 	tr := tr{charSet.Value}
 	target := includes
 	isIntersect := *intersect
@@ -320,21 +640,17 @@ func trSetupTable(charSet String, includes, excludes map[rune]bool, intersect *b
 		}
 		*intersect = true
 	}
-	iter := tr.LazyChars()
-	for {
-		r, ok := iter()
-		if !ok {
-			break
-		}
+	chars, err := tr.chars(tr.IsNegative())
+	for _, r := range chars {
 		if isIntersect {
-			_, ok = target[r]
-			if ok {
+			if _, ok := target[r]; ok {
 				target[r] = true
 			}
 		} else {
 			target[r] = true
 		}
 	}
+	return err
 }
 
 func (str String) Count(charset String, otherCharsets ...String) int {
@@ -361,8 +677,6 @@ func (str String) Count(charset String, otherCharsets ...String) int {
 	return count
 }
 
-// TODO crypt
-
 func (str String) Delete(charset String, otherCharset ...String) String {
 	includes := make(map[rune]bool)
 	excludes := make(map[rune]bool)
@@ -394,16 +708,28 @@ func (str String) DeletePrefix(prefix String) String {
 	return NewString(str.Value)
 }
 
-func (str String) Downcase() String {
-	return NewString(strings.ToLower(str.Value))
+func (str String) Downcase(options ...CaseOption) String {
+	return str.mapCase(caseLower, options)
 }
 
 func (str String) Dump() String {
+	decode := utf8.DecodeRuneInString
+	if str.enc != nil {
+		// only UTF-8 gets \u escapes, any other non-ASCII byte is dumped as \xNN
+		decode = func(s string) (rune, int) {
+			if s == "" {
+				return utf8.RuneError, 0
+			} else if s[0] < 0x80 {
+				return rune(s[0]), 1
+			}
+			return utf8.RuneError, 1
+		}
+	}
 	width := 0
 	var r rune
 	bufLen := 2 // ""
 	for i := 0; i < len(str.Value); i += width {
-		r, width = utf8.DecodeRuneInString(str.Value[i:])
+		r, width = decode(str.Value[i:])
 		if r == utf8.RuneError {
 			if width == 0 {
 				break
@@ -426,7 +752,7 @@ func (str String) Dump() String {
 			} else if r <= 0xFFFF {
 				bufLen += 6 // \uXXXX
 			} else {
-				bufLen += 10 // \uXXXXXXXX
+				bufLen += 10 // \u{XXXXXX}
 			}
 		}
 	}
@@ -434,7 +760,7 @@ func (str String) Dump() String {
 	buffer := bytes.NewBuffer(make([]byte, 0, bufLen))
 	buffer.WriteByte('"')
 	for i := 0; i < len(str.Value); i += width {
-		r, width = utf8.DecodeRuneInString(str.Value[i:])
+		r, width = decode(str.Value[i:])
 		if r == utf8.RuneError {
 			if width == 0 {
 				break
@@ -481,12 +807,15 @@ func (str String) Dump() String {
 				} else if r <= 0xFFFF {
 					buffer.WriteString(fmt.Sprintf("u%04X", r))
 				} else {
-					buffer.WriteString(fmt.Sprintf("u%08X", r))
+					buffer.WriteString(fmt.Sprintf("u{%X}", r))
 				}
 			}
 		}
 	}
 	buffer.WriteByte('"')
+	if enc := str.Encoding(); !enc.asciiCompatible {
+		buffer.WriteString(`.dup.force_encoding("` + enc.name + `")`)
+	}
 	return NewString(buffer.String())
 }
 
@@ -520,30 +849,56 @@ func (str String) EachCodepoint(action func(rune)) (ret String) {
 	return
 }
 
-func (str String) EachLine(separator String, action func(String)) (ret String) {
+// LineOptions are the options of EachLine and Lines.
+type LineOptions struct {
+	// Chomp removes the separator from each line.
+	Chomp bool
+	// Limit, when positive, caps each line at that many bytes without
+	// splitting a character.
+	Limit int
+}
+
+// EachLine calls action with each line of str, separator included. The
+// empty separator is paragraph mode: lines are split after runs of two or
+// more newlines.
+func (str String) EachLine(separator String, options LineOptions, action func(String)) (ret String) {
 	ret = str
-	if separator.Value == "" {
-		separator = NewString("\n")
+	defer RecoverBreak("")
+	paragraph := separator.Value == ""
+	sep := separator.Value
+	if paragraph {
+		sep = "\n\n"
 	}
 	for i := 0; i < len(str.Value); {
-		idx := strings.Index(str.Value[i:], separator.Value)
-		if idx >= 0 {
-			action(NewString(str.Value[i:i+idx]))
-			i += idx + len(separator.Value)
-			if i == len(str.Value) {
-				// the separator is at the end of the String
-				action(NewString(""))
+		end, found, limited := len(str.Value), false, false
+		if idx := strings.Index(str.Value[i:], sep); idx >= 0 {
+			end, found = i+idx+len(sep), true
+			for paragraph && end < len(str.Value) && str.Value[end] == '\n' {
+				end++
 			}
-		} else {
-			action(NewString(str.Value[i:]))
-			break
 		}
+		if options.Limit > 0 && end-i > options.Limit {
+			end, limited = i+str.withValue(str.Value[i:]).charBoundaryAfter(options.Limit), true
+		}
+		line := str.withValue(str.Value[i:end])
+		if options.Chomp && !limited {
+			switch {
+			case paragraph && found:
+				line.Value = line.Value[:line.chompOffset("")]
+			case paragraph || sep == "\n":
+				if strings.HasSuffix(line.Value, "\n") {
+					line.Value = strings.TrimSuffix(strings.TrimSuffix(line.Value, "\n"), "\r")
+				}
+			default:
+				line.Value = line.Value[:line.chompOffset(sep)]
+			}
+		}
+		i = end
+		action(line)
 	}
 	return
 }
 
-// TODO encode?
-
 func (str String) EndWith(suffix String, otherSuffixes ...String) bool {
 	if strings.HasSuffix(str.Value, suffix.Value) {
 		return true
@@ -556,20 +911,133 @@ func (str String) EndWith(suffix String, otherSuffixes ...String) bool {
 	return false
 }
 
-func (str String) GetByte(index int) byte {
-	return str.Value[index]
+// GetByte returns the byte at index, which may count from the end.
+func (str String) GetByte(index int) (byte, bool) {
+	if index < 0 {
+		index += len(str.Value)
+	}
+	if index < 0 || index >= len(str.Value) {
+		return 0, false
+	}
+	return str.Value[index], true
+}
+
+func expandReplacement(replacement string, m MatchData) string {
+	if strings.IndexByte(replacement, '\\') < 0 {
+		return replacement
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		if c != '\\' || i+1 == len(replacement) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		c = replacement[i]
+		switch {
+		case c >= '0' && c <= '9':
+			if n := int(c - '0'); n <= m.Size() {
+				if group := m.group(n); group != nil {
+					buf.WriteString(*group)
+				}
+			}
+		case c == '&':
+			buf.WriteString(m.String())
+		case c == '`':
+			buf.WriteString(m.PreMatch())
+		case c == '\'':
+			buf.WriteString(m.PostMatch())
+		case c == '+':
+			for n := m.Size(); n > 0; n-- {
+				if group := m.group(n); group != nil {
+					buf.WriteString(*group)
+					break
+				}
+			}
+		case c == '\\':
+			buf.WriteByte('\\')
+		case c == 'k' && i+1 < len(replacement) && replacement[i+1] == '<':
+			end := strings.IndexByte(replacement[i+2:], '>')
+			if end < 0 {
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+				continue
+			}
+			name := replacement[i+2 : i+2+end]
+			n := m.regexp.SubexpIndex(name)
+			if n < 0 {
+				panic("undefined group name reference: " + name)
+			}
+			if group := m.group(n); group != nil {
+				buf.WriteString(*group)
+			}
+			i += end + 2
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
 }
 
-type subValues interface {
-	getValue()
+func replacementFunc(replacement interface{}) func(MatchData) string {
+	switch repl := replacement.(type) {
+	case string:
+		return func(m MatchData) string {
+			return expandReplacement(repl, m)
+		}
+	case String:
+		return func(m MatchData) string {
+			return expandReplacement(repl.Value, m)
+		}
+	case map[string]string:
+		return func(m MatchData) string {
+			return repl[m.String()]
+		}
+	case map[string]String:
+		return func(m MatchData) string {
+			return repl[m.String()].Value
+		}
+	case func(MatchData) String:
+		return func(m MatchData) string {
+			return repl(m).Value
+		}
+	}
+	panic("Replacement type must be one of: string, String, map[string]string, map[string]String, func(MatchData) String")
 }
 
-func (str String) Gsub(re regexp.Regexp, replacement interface{}) String {
-	indexes := re.FindAllStringSubmatchIndex(str.Value, -1)
+func (str String) substitute(re Pattern, replacement interface{}, limit int) String {
+	indexes := findAll(re, str.Value, limit)
 	if indexes == nil {
 		return NewString(str.Value)
 	}
-	return str
+	replace := replacementFunc(replacement)
+	var buf bytes.Buffer
+	last := 0
+	for _, index := range indexes {
+		buf.WriteString(str.Value[last:index[0]])
+		buf.WriteString(replace(NewMatchData(str.Value, re, index)))
+		last = index[1]
+	}
+	buf.WriteString(str.Value[last:])
+	return NewString(buf.String())
+}
+
+func (str String) Gsub(re Pattern, replacement interface{}) String {
+	return str.substitute(re, replacement, -1)
+}
+
+func (str String) GsubEnum(re Pattern) func() (MatchData, bool) {
+	indexes := findAll(re, str.Value, -1)
+	return func() (m MatchData, ok bool) {
+		if len(indexes) == 0 {
+			return
+		}
+		m = NewMatchData(str.Value, re, indexes[0])
+		indexes = indexes[1:]
+		return m, true
+	}
 }
 
 func (str String) IsEql(obj interface{}) bool {
@@ -583,20 +1051,464 @@ func (str String) IsEmpty() bool {
 	return str.Value == ""
 }
 
+// indexFrom returns the byte offset of the first occurrence of pattern at
+// or after byte offset from, or -1.
+func (str String) indexFrom(pattern interface{}, from int) int {
+	switch p := pattern.(type) {
+	case String:
+		return str.indexFrom(p.Value, from)
+	case string:
+		if index := strings.Index(str.Value[from:], p); index >= 0 {
+			return from + index
+		}
+		return -1
+	case Pattern:
+		if index := str.search(p, from); index != nil {
+			return index[0]
+		}
+		return -1
+	}
+	panic("Pattern type must be one of: String, string, Pattern")
+}
 
+// rindexFrom returns the byte offset of the last occurrence of pattern that
+// starts at or before byte offset from, or -1.
+func (str String) rindexFrom(pattern interface{}, from int) int {
+	switch p := pattern.(type) {
+	case String:
+		return str.rindexFrom(p.Value, from)
+	case string:
+		return strings.LastIndex(str.Value[:min(from+len(p), len(str.Value))], p)
+	case Pattern:
+		if index := str.searchBackward(p, from); index != nil {
+			return index[0]
+		}
+		return -1
+	}
+	panic("Pattern type must be one of: String, string, Pattern")
+}
+
+// Index returns the character index of the first occurrence of pattern, a
+// String, string or Pattern, starting the search at character offset.
+func (str String) Index(pattern interface{}, offset int) (int, bool) {
+	from, ok := str.matchOffset(offset)
+	if !ok {
+		return 0, false
+	}
+	if index := str.indexFrom(pattern, from); index >= 0 {
+		return str.charIndex(index), true
+	}
+	return 0, false
+}
+
+// Insert puts other before the character at index. A negative index counts
+// from the end and inserts after that character.
+func (str String) Insert(index int, other String) (String, error) {
+	if index == -1 {
+		return NewString(str.Value + other.Value), nil
+	}
+	if index < 0 {
+		index++
+	}
+	return str.update(index, 0, other)
+}
 
 func (str String) Length() int {
-	return utf8.RuneCountInString(str.Value)
+	if str.enc == nil {
+		return utf8.RuneCountInString(str.Value)
+	}
+	length := 0
+	str.eachChar(func(string, rune, int) {
+		length++
+	})
+	return length
 }
 
-func (str String) Lines(separator String) []String {
+func (str String) Lines(separator String, options LineOptions) []String {
 	lines := make([]String, 0, 1)
-	str.EachLine(separator, func(line String) {
+	str.EachLine(separator, options, func(line String) {
 		lines = append(lines, line)
 	})
 	return lines
 }
 
+// matchOffset converts a character position, which may count from the end,
+// into the byte offset a search starts at.
+func (str String) matchOffset(pos int) (int, bool) {
+	if pos == 0 {
+		return 0, true
+	}
+	length := str.Length()
+	if pos < 0 {
+		pos += length
+	}
+	if pos < 0 || pos > length {
+		return 0, false
+	}
+	return str.charOffset(pos), true
+}
+
+func (str String) Ljust(width int) String {
+	return str.Ljust2(width, NewString(" "))
+}
+
+func (str String) Ljust2(width int, padstr String) String {
+	return str.LjustWidth(width, padstr, WidthChars)
+}
+
+// LjustWidth pads str on the right to width, measuring str and padstr by mode.
+func (str String) LjustWidth(width int, padstr String, mode WidthMode) String {
+	if padstr.IsEmpty() {
+		panic("Empty padding")
+	}
+	return NewString(str.Value + fillToWidth(padstr, width-str.Width(mode), mode))
+}
+
+// Lstrip removes leading whitespace and null characters.
+func (str String) Lstrip() String {
+	return str.withValue(strings.TrimLeftFunc(str.Value, isStripSpace))
+}
+
+// search finds the first match of re at or after byte offset.
+func (str String) search(re Pattern, offset int) []int {
+	return matchFrom(re, str.Value, offset)
+}
+
+// searchBackward finds the match of re with the rightmost start at or before
+// byte offset.
+func (str String) searchBackward(re Pattern, offset int) []int {
+	for pos := offset; pos >= 0; pos-- {
+		if pos < len(str.Value) && !utf8.RuneStart(str.Value[pos]) {
+			continue
+		}
+		if index := matchAt(re, str.Value, pos); index != nil {
+			return index
+		}
+	}
+	return nil
+}
+
+func (str String) Match(re Pattern, pos int) (m MatchData, ok bool) {
+	offset, ok := str.matchOffset(pos)
+	if !ok {
+		return
+	}
+	index := str.search(re, offset)
+	if index == nil {
+		return m, false
+	}
+	return NewMatchData(str.Value, re, index), true
+}
+
+func (str String) IsMatch(re Pattern, pos int) bool {
+	offset, ok := str.matchOffset(pos)
+	return ok && matchesFrom(re, str.Value, offset)
+}
+
+// separatorSpan finds sep, a String, string or Pattern, searching from the
+// end when last is set. It returns -1 offsets when sep is not found.
+func (str String) separatorSpan(sep interface{}, last bool) (from, to int) {
+	switch p := sep.(type) {
+	case String:
+		return str.separatorSpan(p.Value, last)
+	case string:
+		if last {
+			from = strings.LastIndex(str.Value, p)
+		} else {
+			from = strings.Index(str.Value, p)
+		}
+		if from < 0 {
+			return -1, -1
+		}
+		return from, from + len(p)
+	case Pattern:
+		var index []int
+		if last {
+			index = str.searchBackward(p, len(str.Value))
+		} else {
+			index = str.search(p, 0)
+		}
+		if index == nil {
+			return -1, -1
+		}
+		return index[0], index[1]
+	}
+	panic("Separator type must be one of: String, string, Pattern")
+}
+
+func (str String) Partition(sep interface{}) (head, match, tail String) {
+	from, to := str.separatorSpan(sep, false)
+	if from < 0 {
+		return str.Dup(), str.withValue(""), str.withValue("")
+	}
+	return str.withValue(str.Value[:from]), str.withValue(str.Value[from:to]), str.withValue(str.Value[to:])
+}
+
+func (str String) Prepend(args ...interface{}) String {
+	return str.withValue(NewString("").Concat(args...).Value + str.Value)
+}
+
+// Rindex returns the character index of the last occurrence of pattern that
+// starts at or before character offset.
+func (str String) Rindex(pattern interface{}, offset int) (int, bool) {
+	length := str.Length()
+	if offset < 0 {
+		offset += length
+		if offset < 0 {
+			return 0, false
+		}
+	}
+	if index := str.rindexFrom(pattern, str.charOffset(min(offset, length))); index >= 0 {
+		return str.charIndex(index), true
+	}
+	return 0, false
+}
+
+func (str String) Rpartition(sep interface{}) (head, match, tail String) {
+	from, to := str.separatorSpan(sep, true)
+	if from < 0 {
+		return str.withValue(""), str.withValue(""), str
+	}
+	return str.withValue(str.Value[:from]), str.withValue(str.Value[from:to]), str.withValue(str.Value[to:])
+}
+
+func (str String) Rjust(width int) String {
+	return str.Rjust2(width, NewString(" "))
+}
+
+func (str String) Rjust2(width int, padstr String) String {
+	return str.RjustWidth(width, padstr, WidthChars)
+}
+
+// RjustWidth pads str on the left to width, measuring str and padstr by mode.
+func (str String) RjustWidth(width int, padstr String, mode WidthMode) String {
+	if padstr.IsEmpty() {
+		panic("Empty padding")
+	}
+	return NewString(fillToWidth(padstr, width-str.Width(mode), mode) + str.Value)
+}
+
+// Rstrip removes trailing whitespace and null characters.
+func (str String) Rstrip() String {
+	return str.withValue(strings.TrimRightFunc(str.Value, isStripSpace))
+}
+
+func (str String) Scan(re Pattern) []interface{} {
+	ret := make([]interface{}, 0, 4)
+	str.ScanEach(re, func(m MatchData) {
+		if m.Size() == 0 {
+			ret = append(ret, NewString(m.String()))
+		} else {
+			ret = append(ret, m.Captures())
+		}
+	})
+	return ret
+}
+
+func (str String) ScanEach(re Pattern, action func(MatchData)) (ret String) {
+	ret = str
+	defer RecoverBreak("")
+	for _, index := range findAll(re, str.Value, -1) {
+		action(NewMatchData(str.Value, re, index))
+	}
+	return
+}
+
+// SetByte replaces the byte at index, which may count from the end.
+func (str String) SetByte(index int, b byte) (String, error) {
+	i := index
+	if i < 0 {
+		i += len(str.Value)
+	}
+	if i < 0 || i >= len(str.Value) {
+		return str, IndexError{"index " + strconv.Itoa(index) + " out of string"}
+	}
+	return str.withValue(str.Value[:i] + string([]byte{b}) + str.Value[i+1:]), nil
+}
+
+func (str String) Sub(re Pattern, replacement interface{}) String {
+	return str.substitute(re, replacement, 1)
+}
+
+// Split divides str into fields around pattern. A nil pattern or a single
+// space splits on runs of ASCII whitespace and ignores leading whitespace,
+// an empty string splits into characters, and the captures of a regexp are
+// fields too. A positive limit caps the number of fields, a negative limit
+// keeps trailing empty fields, which are removed otherwise.
+func (str String) Split(pattern interface{}, limit int) []String {
+	fields := make([]String, 0, 4)
+	str.SplitEach(pattern, limit, func(field String) {
+		fields = append(fields, field)
+	})
+	return fields
+}
+
+// SplitEach calls action with each field Split would return.
+func (str String) SplitEach(pattern interface{}, limit int, action func(String)) (ret String) {
+	ret = str
+	defer RecoverBreak("")
+	s := str.Value
+	if limit == 1 {
+		if s != "" {
+			action(str.withValue(s))
+		}
+		return
+	}
+	// empty fields are held back until a non-empty one follows, so trailing
+	// ones are dropped unless a limit is given
+	empties := 0
+	if limit != 0 {
+		empties = -1
+	}
+	emit := func(from, to int) {
+		if empties >= 0 && from == to {
+			empties++
+			return
+		}
+		for ; empties > 0; empties-- {
+			action(str.withValue(""))
+		}
+		action(str.withValue(s[from:to]))
+	}
+	fields := 1
+	full := func() bool {
+		if limit > 0 {
+			fields++
+		}
+		return limit > 0 && limit <= fields
+	}
+
+	beg := 0
+	if p, ok := pattern.(String); ok {
+		pattern = p.Value
+	}
+	switch p := pattern.(type) {
+	case nil:
+		str.splitAwk(limit, emit, &beg)
+	case string:
+		if p == " " {
+			str.splitAwk(limit, emit, &beg)
+			break
+		}
+		for from := 0; beg < len(s); {
+			var end int
+			if p == "" {
+				_, width, _ := str.Encoding().decodeChar(s[beg:])
+				end = beg + width
+			} else {
+				index := strings.Index(s[from:], p)
+				if index < 0 {
+					break
+				}
+				if end = from + index; str.checkCharBoundary(end) != nil {
+					from = end + 1
+					continue
+				}
+			}
+			emit(beg, end)
+			beg = end + len(p)
+			from = beg
+			if full() {
+				break
+			}
+		}
+	case Pattern:
+		for start, lastNull := 0, false; start <= len(s); {
+			index := str.search(p, start)
+			if index == nil {
+				break
+			}
+			if start == index[0] && index[0] == index[1] {
+				if s == "" {
+					emit(0, 0)
+					break
+				} else if lastNull {
+					_, width, _ := str.Encoding().decodeChar(s[beg:])
+					emit(beg, beg+width)
+					beg = start
+				} else {
+					if start == len(s) {
+						start++
+					} else {
+						_, width, _ := str.Encoding().decodeChar(s[start:])
+						start += width
+					}
+					lastNull = true
+					continue
+				}
+			} else {
+				emit(beg, index[0])
+				beg, start = index[1], index[1]
+			}
+			lastNull = false
+			for i := 2; i < len(index); i += 2 {
+				if index[i] >= 0 {
+					emit(index[i], index[i+1])
+				}
+			}
+			if full() {
+				break
+			}
+		}
+	default:
+		panic("Pattern type must be one of: nil, String, string, Pattern")
+	}
+	if len(s) > 0 && (limit != 0 || len(s) > beg) {
+		emit(beg, len(s))
+	}
+	return
+}
+
+// splitAwk splits on runs of whitespace, leaving beg at the rest of str
+// once limit fields are found.
+func (str String) splitAwk(limit int, emit func(from, to int), beg *int) {
+	s := str.Value
+	fields := 1
+	end, skip := 0, true
+	for i := 0; i < len(s); i++ {
+		space := isAsciiSpace(rune(s[i]))
+		switch {
+		case skip && space:
+			*beg = i + 1
+		case skip:
+			end, skip = i+1, false
+			if limit > 0 && limit <= fields {
+				return
+			}
+		case space:
+			emit(*beg, end)
+			skip = true
+			*beg = i + 1
+			fields++
+		default:
+			end = i + 1
+		}
+	}
+}
+
+func (str String) Squeeze(charsets ...String) (String, error) {
+	match := func(rune) bool {
+		return true
+	}
+	if len(charsets) > 0 {
+		var err error
+		if match, err = trMatcher(charsets...); err != nil {
+			return str, err
+		}
+	}
+	// characters compare by their bytes, so invalid bytes are never merged
+	// with different invalid bytes
+	var buf bytes.Buffer
+	prev := ""
+	str.eachChar(func(s string, r rune, state int) {
+		if s != prev || !match(r) || state == charInvalid && len(charsets) > 0 {
+			buf.WriteString(s)
+		}
+		prev = s
+	})
+	return str.withValue(buf.String()), nil
+}
+
 func (str String) StartWith(prefix String, otherPrefixes ...String) bool {
 	if strings.HasPrefix(str.Value, prefix.Value) {
 		return true
@@ -609,6 +1521,350 @@ func (str String) StartWith(prefix String, otherPrefixes ...String) bool {
 	return false
 }
 
-func (str String) Upcase() String {
-	return NewString(strings.ToUpper(str.Value))
+func isStripSpace(r rune) bool {
+	return r == 0 || r == ' ' || r >= '\t' && r <= '\r'
+}
+
+// Strip removes leading and trailing whitespace and null characters.
+func (str String) Strip() String {
+	return str.withValue(strings.TrimFunc(str.Value, isStripSpace))
+}
+
+const (
+	neighborFound = iota
+	neighborWrapped
+	neighborNotChar
+)
+
+// succRune returns the next codepoint with the same UTF-8 length, wrapping to
+// the smallest one.
+func succRune(r rune) (rune, int) {
+	width := utf8.RuneLen(r)
+	next := r + 1
+	if next == 0xD800 {
+		next = 0xE000
+	}
+	if utf8.RuneLen(next) != width {
+		return []rune{0, 0x80, 0x800, 0x10000}[width-1], neighborWrapped
+	}
+	return next, neighborFound
+}
+
+func isSuccDigit(r rune) bool {
+	return unicode.IsDigit(r)
+}
+
+func isSuccAlpha(r rune) bool {
+	return unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+func succAlnum(r rune) (next rune, carry rune, neighbor int) {
+	digit := isSuccDigit(r)
+	sameType := isSuccAlpha
+	if digit {
+		sameType = isSuccDigit
+	} else if !isSuccAlpha(r) {
+		return r, 0, neighborNotChar
+	}
+	next = r
+	for try := 0; try < 2; try++ {
+		var state int
+		if next, state = succRune(next); state == neighborFound && sameType(next) {
+			return next, 0, neighborFound
+		}
+	}
+	// wrap to the first character of the run this one belongs to
+	first := r
+	for first > 0 && sameType(first-1) && utf8.RuneLen(first-1) == utf8.RuneLen(r) {
+		first--
+	}
+	if first == r {
+		return r, 0, neighborNotChar
+	}
+	if digit {
+		carry, _ = succRune(first)
+		return first, carry, neighborWrapped
+	}
+	return first, first, neighborWrapped
+}
+
+func (str String) Succ() String {
+	if str.IsEmpty() {
+		return str.Dup()
+	}
+	type char struct {
+		raw   string
+		r     rune
+		valid bool
+	}
+	chars := make([]char, 0, len(str.Value))
+	for i, width := 0, 0; i < len(str.Value); i += width {
+		var r rune
+		r, width = utf8.DecodeRuneInString(str.Value[i:])
+		chars = append(chars, char{str.Value[i : i+width], r, r != utf8.RuneError || width > 1})
+	}
+	join := func(carryPos int, carry string) String {
+		var buf bytes.Buffer
+		for i, c := range chars {
+			if i == carryPos {
+				buf.WriteString(carry)
+			}
+			if c.valid {
+				buf.WriteRune(c.r)
+			} else {
+				buf.WriteString(c.raw)
+			}
+		}
+		return str.withValue(buf.String())
+	}
+
+	carryPos, carry := 0, "\x01"
+	lastAlnum := -1
+	neighbor := neighborFound
+	for i := len(chars) - 1; i >= 0; i-- {
+		c := chars[i]
+		if !c.valid {
+			continue
+		}
+		if neighbor == neighborNotChar && lastAlnum >= 0 {
+			last := chars[lastAlnum].r
+			if isSuccAlpha(last) && isSuccDigit(c.r) || isSuccDigit(last) && isSuccAlpha(c.r) {
+				break
+			}
+		}
+		var next, carryRune rune
+		next, carryRune, neighbor = succAlnum(c.r)
+		switch neighbor {
+		case neighborNotChar:
+			continue
+		case neighborFound:
+			chars[i].r = next
+			return join(-1, "")
+		}
+		chars[i].r = next
+		lastAlnum = i
+		carryPos, carry = i, string(carryRune)
+	}
+
+	if lastAlnum < 0 {
+		// no alphanumerics, increment the rightmost character instead
+		for i := len(chars) - 1; i >= 0; i-- {
+			if !chars[i].valid {
+				continue
+			}
+			next, state := succRune(chars[i].r)
+			chars[i].r = next
+			if state == neighborFound {
+				return join(-1, "")
+			}
+			carryPos = i
+		}
+	}
+	return join(carryPos, carry)
+}
+
+func (str String) Next() String {
+	return str.Succ()
+}
+
+func (str String) Swapcase(options ...CaseOption) String {
+	return str.mapCase(caseSwap, options)
+}
+
+func (str String) trans(from, to String, squeeze bool) (String, error) {
+	if to.IsEmpty() {
+		match, err := trMatcher(from)
+		if err != nil {
+			return str, err
+		}
+		var buf bytes.Buffer
+		str.eachChar(func(s string, r rune, state int) {
+			if state == charInvalid || !match(r) {
+				buf.WriteString(s)
+			}
+		})
+		return str.withValue(buf.String()), nil
+	}
+
+	fromTr := tr{from.Value}
+	negative := fromTr.IsNegative()
+	fromChars, err := fromTr.chars(negative)
+	if err != nil {
+		return str, err
+	}
+	toChars, err := tr{to.Value}.chars(false)
+	if err != nil {
+		return str, err
+	}
+	if len(toChars) == 0 {
+		return str, ArgumentError{"invalid byte sequence in " + to.Encoding().name}
+	}
+	last := toChars[len(toChars)-1]
+	table := make(map[rune]rune, len(fromChars))
+	for i, c := range fromChars {
+		if negative {
+			table[c] = c
+		} else if i < len(toChars) {
+			table[c] = toChars[i]
+		} else {
+			table[c] = last
+		}
+	}
+
+	// invalid bytes are never translated, not even by a negated set
+	var buf bytes.Buffer
+	prev := rune(-1)
+	str.eachChar(func(s string, r rune, state int) {
+		mapped, found := table[r]
+		if negative {
+			mapped, found = last, !found
+		}
+		if !found || state == charInvalid {
+			buf.WriteString(s)
+			prev = -1
+			return
+		}
+		if squeeze && mapped == prev {
+			return
+		}
+		buf.WriteRune(mapped)
+		prev = mapped
+	})
+	return str.withValue(buf.String()), nil
+}
+
+func (str String) Tr(from, to String) (String, error) {
+	return str.trans(from, to, false)
+}
+
+func (str String) TrS(from, to String) (String, error) {
+	return str.trans(from, to, true)
+}
+
+func (str String) Undump() (String, error) {
+	s := str.Value
+	if !strings.HasPrefix(s, "\"") {
+		return str, RuntimeError{`invalid dumped string; not wrapped with '"' nor '"...".force_encoding("...")' form`}
+	}
+	var enc *Encoding
+	end := len(s) - 1
+	if strings.HasSuffix(s, `")`) {
+		for _, form := range []string{`".dup.force_encoding("`, `".force_encoding("`} {
+			if i := strings.LastIndex(s, form); i > 0 {
+				found, err := FindEncoding(s[i+len(form) : len(s)-2])
+				if err != nil {
+					return str, err
+				}
+				enc, end = found, i
+				break
+			}
+		}
+	}
+	if end < 1 || s[end] != '"' {
+		return str, RuntimeError{`invalid dumped string; not wrapped with '"' nor '"...".force_encoding("...")' form`}
+	}
+
+	var buf bytes.Buffer
+	for i := 1; i < end; i++ {
+		c := s[i]
+		if c >= 0x80 {
+			return str, RuntimeError{"non-ASCII character detected"}
+		}
+		if c == '"' {
+			return str, RuntimeError{"unescaped double quote found"}
+		}
+		if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+		if i++; i >= end {
+			return str, RuntimeError{"invalid escape"}
+		}
+		switch c = s[i]; c {
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'v':
+			buf.WriteByte('\v')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'a':
+			buf.WriteByte('\a')
+		case 'e':
+			buf.WriteByte('\033')
+		case 'x':
+			n, width := 0, 0
+			for ; width < 2 && i+1+width < end && hexValue(s[i+1+width]) >= 0; width++ {
+				n = n<<4 | hexValue(s[i+1+width])
+			}
+			if width == 0 {
+				return str, RuntimeError{"invalid hex escape"}
+			}
+			buf.WriteByte(byte(n))
+			i += width
+		case 'u':
+			if enc != nil {
+				return str, RuntimeError{"dumped string contained Unicode escape but used force_encoding"}
+			}
+			if i+1 < end && s[i+1] == '{' {
+				close := strings.IndexByte(s[i+1:end], '}')
+				if close < 0 {
+					return str, RuntimeError{"unterminated Unicode escape"}
+				}
+				codepoints := strings.Fields(s[i+2 : i+1+close])
+				if len(codepoints) == 0 {
+					return str, RuntimeError{"invalid Unicode escape"}
+				}
+				for _, hex := range codepoints {
+					r, err := strconv.ParseUint(hex, 16, 32)
+					if err != nil || len(hex) > 6 {
+						return str, RuntimeError{"invalid Unicode escape"}
+					}
+					if r > utf8.MaxRune {
+						return str, RuntimeError{"invalid Unicode codepoint (too large)"}
+					}
+					if r >= 0xD800 && r <= 0xDFFF {
+						return str, RuntimeError{"invalid Unicode codepoint"}
+					}
+					buf.WriteRune(rune(r))
+				}
+				i += close + 1
+				continue
+			}
+			if i+4 >= end {
+				return str, RuntimeError{"invalid Unicode escape"}
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return str, RuntimeError{"invalid Unicode escape"}
+			}
+			i += 4
+			if r >= 0xD800 && r <= 0xDFFF {
+				return str, RuntimeError{"invalid Unicode codepoint"}
+			}
+			buf.WriteRune(rune(r))
+		default:
+			if c >= 0x80 {
+				return str, RuntimeError{"non-ASCII character detected"}
+			}
+			if !strings.ContainsRune("\"\\#", rune(c)) {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(c)
+		}
+	}
+	ret := NewString(buf.String())
+	if enc != nil {
+		ret = ret.withEncoding(enc)
+	}
+	return ret, nil
+}
+
+func (str String) Upcase(options ...CaseOption) String {
+	return str.mapCase(caseUpper, options)
 }
@@ -0,0 +1,166 @@
+package rb
+
+// Freeze makes the mutating *String methods fail with a FrozenError. Copies
+// of a frozen String are frozen too.
+func (str *String) Freeze() *String {
+	str.frozen = true
+	return str
+}
+
+func (str String) IsFrozen() bool {
+	return str.frozen
+}
+
+// Dup returns an unfrozen copy of str.
+func (str String) Dup() String {
+	return str.withValue(str.Value)
+}
+
+// Clone returns a copy of str that is frozen if str is.
+func (str String) Clone() String {
+	return str
+}
+
+func (str *String) checkFrozen() error {
+	if str.IsFrozen() {
+		return FrozenError{"can't modify frozen String: " + str.Inspect()}
+	}
+	return nil
+}
+
+// modify replaces the contents of str with result and reports whether
+// anything changed.
+func (str *String) modify(result String) (bool, error) {
+	if err := str.checkFrozen(); err != nil {
+		return false, err
+	}
+	changed := str.Value != result.Value || str.enc != result.enc
+	str.Value, str.enc = result.Value, result.enc
+	return changed, nil
+}
+
+func (str *String) modifyOrFail(result String, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return str.modify(result)
+}
+
+// Replace sets the contents and encoding of str to those of other.
+func (str *String) Replace(other String) error {
+	_, err := str.modify(other.withValue(other.Value))
+	return err
+}
+
+func (str *String) Clear() error {
+	_, err := str.modify(str.withValue(""))
+	return err
+}
+
+func (str *String) CapitalizeBang(options ...CaseOption) (bool, error) {
+	return str.modify(str.Capitalize(options...))
+}
+
+func (str *String) ChompBang() (bool, error) {
+	return str.modify(str.Chomp())
+}
+
+func (str *String) Chomp1Bang(separator String) (bool, error) {
+	return str.modify(str.Chomp1(separator))
+}
+
+func (str *String) ChopBang() (bool, error) {
+	return str.modify(str.Chop())
+}
+
+func (str *String) DeleteBang(charset String, otherCharset ...String) (bool, error) {
+	return str.modify(str.Delete(charset, otherCharset...))
+}
+
+func (str *String) DeletePrefixBang(prefix String) (bool, error) {
+	return str.modify(str.DeletePrefix(prefix))
+}
+
+func (str *String) DowncaseBang(options ...CaseOption) (bool, error) {
+	return str.modify(str.Downcase(options...))
+}
+
+func (str *String) GsubBang(re Pattern, replacement interface{}) (bool, error) {
+	return str.modify(str.Gsub(re, replacement))
+}
+
+func (str *String) LstripBang() (bool, error) {
+	return str.modify(str.Lstrip())
+}
+
+func (str *String) NextBang() (bool, error) {
+	return str.modify(str.Next())
+}
+
+func (str *String) RstripBang() (bool, error) {
+	return str.modify(str.Rstrip())
+}
+
+func (str *String) ScrubBang(replacement interface{}) (bool, error) {
+	return str.modify(str.Scrub(replacement))
+}
+
+// SliceBang removes what OpSubscript selects from str and returns it.
+func (str *String) SliceBang(arg interface{}) (String, bool, error) {
+	from, to, found := str.subscriptSpan(arg)
+	return str.sliceBang(from, to, found)
+}
+
+// SliceBang2 removes what OpSubscript2 selects from str and returns it.
+func (str *String) SliceBang2(arg1, arg2 interface{}) (String, bool, error) {
+	from, to, found := str.subscript2Span(arg1, arg2)
+	return str.sliceBang(from, to, found)
+}
+
+func (str *String) sliceBang(from, to int, found bool) (String, bool, error) {
+	if err := str.checkFrozen(); err != nil {
+		return String{}, false, err
+	}
+	if !found {
+		return String{}, false, nil
+	}
+	removed := str.withValue(str.Value[from:to])
+	str.Value = str.Value[:from] + str.Value[to:]
+	return removed, true, nil
+}
+
+func (str *String) SqueezeBang(charsets ...String) (bool, error) {
+	return str.modifyOrFail(str.Squeeze(charsets...))
+}
+
+func (str *String) StripBang() (bool, error) {
+	return str.modify(str.Strip())
+}
+
+func (str *String) SubBang(re Pattern, replacement interface{}) (bool, error) {
+	return str.modify(str.Sub(re, replacement))
+}
+
+func (str *String) SuccBang() (bool, error) {
+	return str.modify(str.Succ())
+}
+
+func (str *String) SwapcaseBang(options ...CaseOption) (bool, error) {
+	return str.modify(str.Swapcase(options...))
+}
+
+func (str *String) TrBang(from, to String) (bool, error) {
+	return str.modifyOrFail(str.Tr(from, to))
+}
+
+func (str *String) TrSBang(from, to String) (bool, error) {
+	return str.modifyOrFail(str.TrS(from, to))
+}
+
+func (str *String) UnicodeNormalizeBang(form NormalizationForm) (bool, error) {
+	return str.modifyOrFail(str.UnicodeNormalize(form))
+}
+
+func (str *String) UpcaseBang(options ...CaseOption) (bool, error) {
+	return str.modify(str.Upcase(options...))
+}
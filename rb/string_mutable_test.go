@@ -0,0 +1,146 @@
+package rb
+
+import (
+	"testing"
+	"regexp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString_OpLtLt(t *testing.T) {
+	buf := NewString("a")
+	assert.Nil(t, buf.OpLtLt("b", 'c', 1), "OpLtLt")
+	assert.Nil(t, buf.OpLtLt(NewString("d")), "OpLtLt")
+	assert.Equal(t, "abc1d", buf.Value, "OpLtLt appends each argument")
+
+	latin1 := NewString("caf").ForceEncoding(EncodingISO8859_1)
+	latin1.OpLtLt("\xe9")
+	assert.Equal(t, NewString("caf\xe9").ForceEncoding(EncodingISO8859_1), latin1, "OpLtLt keeps the encoding")
+}
+
+func TestString_Bang(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		bang     func(*String) (bool, error)
+		expected string
+		changed  bool
+	}{
+		{"UpcaseBang", "abc", func(s *String) (bool, error) { return s.UpcaseBang() }, "ABC", true},
+		{"UpcaseBang", "ABC", func(s *String) (bool, error) { return s.UpcaseBang() }, "ABC", false},
+		{"DowncaseBang", "ÀB", func(s *String) (bool, error) { return s.DowncaseBang() }, "àb", true},
+		{"CapitalizeBang", "hello", func(s *String) (bool, error) { return s.CapitalizeBang() }, "Hello", true},
+		{"SwapcaseBang", "aB", func(s *String) (bool, error) { return s.SwapcaseBang() }, "Ab", true},
+		{"ChompBang", "a\r\n", func(s *String) (bool, error) { return s.ChompBang() }, "a", true},
+		{"ChompBang", "a", func(s *String) (bool, error) { return s.ChompBang() }, "a", false},
+		{"Chomp1Bang", "a--", func(s *String) (bool, error) { return s.Chomp1Bang(NewString("--")) }, "a", true},
+		{"ChopBang", "ab", func(s *String) (bool, error) { return s.ChopBang() }, "a", true},
+		{"ChopBang", "", func(s *String) (bool, error) { return s.ChopBang() }, "", false},
+		{"StripBang", " \ta\n\x00", func(s *String) (bool, error) { return s.StripBang() }, "a", true},
+		{"StripBang", "a b", func(s *String) (bool, error) { return s.StripBang() }, "a b", false},
+		{"LstripBang", "  a ", func(s *String) (bool, error) { return s.LstripBang() }, "a ", true},
+		{"RstripBang", "  a ", func(s *String) (bool, error) { return s.RstripBang() }, "  a", true},
+		{"SqueezeBang", "aaabbb", func(s *String) (bool, error) { return s.SqueezeBang(NewString("a")) }, "abbb", true},
+		{"SqueezeBang", "abc", func(s *String) (bool, error) { return s.SqueezeBang() }, "abc", false},
+		{"DeleteBang", "hello", func(s *String) (bool, error) { return s.DeleteBang(NewString("l")) }, "heo", true},
+		{"DeletePrefixBang", "hello", func(s *String) (bool, error) { return s.DeletePrefixBang(NewString("he")) }, "llo", true},
+		{"GsubBang", "a-b-c", func(s *String) (bool, error) { return s.GsubBang(regexp.MustCompile(`-`), "+") }, "a+b+c", true},
+		{"GsubBang", "abc", func(s *String) (bool, error) { return s.GsubBang(regexp.MustCompile(`-`), "+") }, "abc", false},
+		{"SubBang", "a-b-c", func(s *String) (bool, error) { return s.SubBang(regexp.MustCompile(`-`), "+") }, "a+b-c", true},
+		{"TrBang", "hello", func(s *String) (bool, error) { return s.TrBang(NewString("el"), NewString("ip")) }, "hippo", true},
+		{"TrSBang", "hello", func(s *String) (bool, error) { return s.TrSBang(NewString("l"), NewString("r")) }, "hero", true},
+		{"SuccBang", "az", func(s *String) (bool, error) { return s.SuccBang() }, "ba", true},
+		{"NextBang", "a9", func(s *String) (bool, error) { return s.NextBang() }, "b0", true},
+		{"UnicodeNormalizeBang", "é", func(s *String) (bool, error) { return s.UnicodeNormalizeBang(NormalizationNFC) }, "é", true},
+	}
+	for _, test := range tests {
+		str := NewString(test.input)
+		changed, err := test.bang(&str)
+		assert.Nil(t, err, "%s(%q)", test.name, test.input)
+		assert.Equal(t, test.changed, changed, "%s(%q) changed", test.name, test.input)
+		assert.Equal(t, test.expected, str.Value, "%s(%q)", test.name, test.input)
+	}
+}
+
+func TestString_SliceBang(t *testing.T) {
+	str := NewString("红宝石 ruby")
+	removed, ok, err := str.SliceBang(1)
+	assert.Nil(t, err, "SliceBang(int)")
+	assert.Equal(t, []interface{}{"宝", true}, []interface{}{removed.Value, ok}, "SliceBang(int)")
+	assert.Equal(t, "红石 ruby", str.Value, "SliceBang(int) leaves")
+	removed, _, _ = str.SliceBang(regexp.MustCompile(`\s+`))
+	assert.Equal(t, " ", removed.Value, "SliceBang(regexp)")
+	removed, _, _ = str.SliceBang2(2, 2)
+	assert.Equal(t, "ru", removed.Value, "SliceBang2")
+	assert.Equal(t, "红石by", str.Value, "SliceBang2 leaves")
+	_, ok, _ = str.SliceBang("java")
+	assert.False(t, ok, "SliceBang not found")
+	assert.Equal(t, "红石by", str.Value, "SliceBang not found leaves str")
+}
+
+func TestString_Freeze(t *testing.T) {
+	str := NewString("abc")
+	assert.False(t, str.IsFrozen(), "not frozen by default")
+	str.Freeze()
+	assert.True(t, str.IsFrozen(), "Freeze")
+
+	frozen := FrozenError{`can't modify frozen String: "abc"`}
+	_, err := str.UpcaseBang()
+	assert.Equal(t, frozen, err, "UpcaseBang on a frozen string")
+	_, err = str.GsubBang(regexp.MustCompile(`x`), "y")
+	assert.Equal(t, frozen, err, "GsubBang on a frozen string without a match")
+	_, _, err = str.SliceBang(0)
+	assert.Equal(t, frozen, err, "SliceBang on a frozen string")
+	assert.Equal(t, frozen, str.OpLtLt("d"), "OpLtLt on a frozen string")
+	assert.Equal(t, frozen, str.Replace(NewString("x")), "Replace on a frozen string")
+	assert.Equal(t, frozen, str.Clear(), "Clear on a frozen string")
+	assert.Equal(t, "abc", str.Value, "frozen string is unchanged")
+
+	upcased := str.Upcase()
+	assert.False(t, upcased.IsFrozen(), "non-bang methods return unfrozen strings")
+	assert.False(t, str.Scrub(nil).IsFrozen(), "Scrub of a valid string is unfrozen")
+	assert.True(t, str.Clone().IsFrozen(), "Clone keeps the frozen state")
+	dup := str.Dup()
+	assert.False(t, dup.IsFrozen(), "Dup is not frozen")
+	assert.Nil(t, dup.OpLtLt("d"), "Dup can be modified")
+	assert.Equal(t, "abcd", dup.Value, "Dup can be modified")
+	assert.Equal(t, "abc", str.Value, "Dup leaves the original")
+}
+
+func TestString_FrozenEquality(t *testing.T) {
+	str, frozen := NewString("abc"), NewString("abc")
+	frozen.Freeze()
+	assert.True(t, str.OpEquals(frozen), "frozen state takes no part in OpEquals")
+	assert.True(t, str.IsEql(frozen), "frozen state takes no part in IsEql")
+	assert.Equal(t, 0, str.OpSpaceShip(frozen), "frozen state takes no part in OpSpaceShip")
+
+	clone := frozen.Clone()
+	assert.True(t, clone.IsFrozen(), "Clone keeps the frozen state")
+	assert.True(t, clone.OpEquals(str), "Clone has the same contents")
+	copied := frozen
+	assert.True(t, copied.IsFrozen(), "a copy of a frozen value is frozen")
+
+	strs := []String{NewString("a")}
+	strs[0].Freeze()
+	strs = append(strs, NewString("b"), NewString("c"))
+	assert.True(t, strs[0].IsFrozen(), "frozen state survives append")
+	assert.False(t, strs[1].IsFrozen(), "append adds unfrozen strings")
+}
+
+func TestString_BangAllocs(t *testing.T) {
+	str := NewString("abc")
+	allocs := testing.AllocsPerRun(100, func() {
+		str.StripBang()
+		str.ChompBang()
+	})
+	assert.Equal(t, 0.0, allocs, "bang methods that change nothing allocate nothing")
+}
+
+func TestString_Replace(t *testing.T) {
+	str := NewString("abc")
+	other := NewString("\xe9").ForceEncoding(EncodingISO8859_1)
+	other.Freeze()
+	assert.Nil(t, str.Replace(other), "Replace")
+	assert.Equal(t, NewString("\xe9").ForceEncoding(EncodingISO8859_1), str, "Replace takes the contents and encoding")
+	assert.Nil(t, str.Clear(), "Clear")
+	assert.Equal(t, "", str.Value, "Clear")
+}
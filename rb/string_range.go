@@ -0,0 +1,98 @@
+package rb
+
+import (
+	"bytes"
+	"strconv"
+)
+
+type StringRange = Range[String]
+
+func NewStringRange(begin, end String) StringRange {
+	return NewRange(begin, end)
+}
+
+func NewStringRangeExclusive(begin, end String) StringRange {
+	return NewRangeExclusive(begin, end)
+}
+
+func isAsciiChar(str String) bool {
+	return len(str.Value) == 1 && str.Value[0] < 0x80
+}
+
+func isAsciiDigits(str String) bool {
+	if str.IsEmpty() {
+		return false
+	}
+	for i := 0; i < len(str.Value); i++ {
+		if str.Value[i] < '0' || str.Value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// stringUpto follows String#upto: single ASCII characters step by code,
+// digit strings count numerically and anything else walks Succ.
+func stringUpto(begin, end String, excl bool, action func(String)) {
+	if isAsciiChar(begin) && isAsciiChar(end) {
+		c, e := begin.Value[0], end.Value[0]
+		if c > e || (excl && c == e) {
+			return
+		}
+		for {
+			action(begin.withValue(string([]byte{c})))
+			if !excl && c == e {
+				break
+			}
+			c++
+			if excl && c == e {
+				break
+			}
+		}
+		return
+	}
+
+	if isAsciiDigits(begin) && isAsciiDigits(end) {
+		b, errB := strconv.ParseInt(begin.Value, 10, 64)
+		e, errE := strconv.ParseInt(end.Value, 10, 64)
+		if errB == nil && errE == nil {
+			width := len(begin.Value)
+			if excl {
+				e--
+			}
+			for i := b; i <= e; i++ {
+				s := strconv.FormatInt(i, 10)
+				if len(s) < width {
+					s = string(bytes.Repeat([]byte{'0'}, width-len(s))) + s
+				}
+				action(begin.withValue(s))
+			}
+			return
+		}
+	}
+
+	n := begin.OpSpaceShip(end)
+	if n > 0 || (excl && n == 0) {
+		return
+	}
+	afterEnd := end.Succ()
+	current := begin
+	for !current.OpEquals(afterEnd) {
+		var next *String
+		if excl || !current.OpEquals(end) {
+			succ := current.Succ()
+			next = &succ
+		}
+		action(current)
+		if next == nil {
+			break
+		}
+		current = *next
+		if excl && current.OpEquals(end) {
+			break
+		}
+		if len(current.Value) > len(end.Value) || current.IsEmpty() {
+			break
+		}
+	}
+}
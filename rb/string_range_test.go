@@ -0,0 +1,62 @@
+package rb
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStrings(values ...string) []String {
+	ret := make([]String, len(values))
+	for i, v := range values {
+		ret[i] = NewString(v)
+	}
+	return ret
+}
+
+func TestStringRange_Each(t *testing.T) {
+	assert.Equal(t, newStrings("a", "b", "c"), NewStringRange(NewString("a"), NewString("c")).ToA(), `"a".."c"`)
+	assert.Equal(t, newStrings("a", "b"), NewStringRangeExclusive(NewString("a"), NewString("c")).ToA(), `"a"..."c"`)
+	assert.Equal(t, newStrings("az", "ba", "bb"), NewStringRange(NewString("az"), NewString("bb")).ToA(), `"az".."bb"`)
+	assert.Equal(t, []String{}, NewStringRange(NewString("y"), NewString("ab")).ToA(), `"y".."ab"`)
+	assert.Equal(t, 702, len(NewStringRange(NewString("a"), NewString("zz")).ToA()), `"a".."zz"`)
+	assert.Equal(t, newStrings("A08", "A09", "A10"), NewStringRange(NewString("A08"), NewString("A10")).ToA(), `"A08".."A10"`)
+	assert.Equal(t, newStrings("9", "10"), NewStringRange(NewString("9"), NewString("10")).ToA(), `"9".."10"`)
+	assert.Equal(t, newStrings("08", "09", "10"), NewStringRange(NewString("08"), NewString("10")).ToA(), `"08".."10"`)
+	assert.Equal(t, []String{}, NewStringRange(NewString("b"), NewString("a")).ToA(), `"b".."a"`)
+
+	r := make([]String, 0, 4)
+	NewStringRange(NewString("a"), NewString("e")).Each(func(s String) {
+		if s.Value == "c" {
+			Break()
+		}
+		r = append(r, s)
+	})
+	assert.Equal(t, newStrings("a", "b"), r, "Break on Each")
+}
+
+func TestStringRange_Step(t *testing.T) {
+	r := make([]String, 0, 4)
+	NewStringRange(NewString("a"), NewString("e")).Step(2, func(s String) {
+		r = append(r, s)
+	})
+	assert.Equal(t, newStrings("a", "c", "e"), r, `("a".."e").Step(2)`)
+}
+
+func TestStringRange_IsInclude(t *testing.T) {
+	r := NewStringRange(NewString("a"), NewString("zz"))
+	assert.True(t, r.IsInclude("bb"), `("a".."zz").IsInclude("bb")`)
+	assert.False(t, r.IsInclude("bbb"), `("a".."zz").IsInclude("bbb")`)
+	assert.True(t, r.IsCover("bbb"), `("a".."zz").IsCover("bbb")`)
+	assert.True(t, r.OpCaseEquals(NewString("bbb")), `("a".."zz") === "bbb"`)
+	assert.False(t, r.IsCover(1), `("a".."zz").IsCover(1)`)
+
+	chars := NewStringRangeExclusive(NewString("a"), NewString("e"))
+	assert.True(t, chars.IsMember("d"), `("a"..."e").IsMember("d")`)
+	assert.False(t, chars.IsMember("e"), `("a"..."e").IsMember("e")`)
+	assert.False(t, chars.IsMember("bb"), `("a"..."e").IsMember("bb")`)
+}
+
+func TestStringRange_Inspect(t *testing.T) {
+	assert.Equal(t, `"a".."e"`, NewStringRange(NewString("a"), NewString("e")).Inspect(), "inclusive")
+	assert.Equal(t, `"a"..."e"`, NewStringRangeExclusive(NewString("a"), NewString("e")).Inspect(), "exclusive")
+}
@@ -0,0 +1,198 @@
+package rb
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// scannerCharPattern stands in for the regexp of matches made by Getch and
+// GetByte.
+var scannerCharPattern = regexp.MustCompile(`(?s).`)
+
+// StringScanner tokenizes a String as Ruby's StringScanner does. Matches
+// are anchored at the scan pointer, which is a byte offset, and patterns see
+// the rest of the string as a string of its own, so \A and ^ match at the
+// pointer.
+type StringScanner struct {
+	str     String
+	pos     int
+	prev    int
+	last    MatchData
+	matched bool
+}
+
+func NewStringScanner(str String) *StringScanner {
+	return &StringScanner{str: str}
+}
+
+// scan matches re against the rest of the string, at the scan pointer when
+// anchored, and returns the offset of the end of the match.
+func (s *StringScanner) scan(re Pattern, anchored, advance bool) (int, bool) {
+	rest := s.str.Value[s.pos:]
+	var index []int
+	if anchored {
+		index = matchAt(re, rest, 0)
+	} else {
+		index = matchFrom(re, rest, 0)
+	}
+	if index == nil {
+		s.matched = false
+		return 0, false
+	}
+	for i := range index {
+		if index[i] >= 0 {
+			index[i] += s.pos
+		}
+	}
+	s.last, s.matched, s.prev = NewMatchData(s.str.Value, re, index), true, s.pos
+	if advance {
+		s.pos = index[1]
+	}
+	return index[1], true
+}
+
+func (s *StringScanner) scanString(re Pattern, anchored, advance bool) (String, bool) {
+	from := s.pos
+	end, ok := s.scan(re, anchored, advance)
+	if !ok {
+		return String{}, false
+	}
+	return s.str.withValue(s.str.Value[from:end]), true
+}
+
+func (s *StringScanner) scanLength(re Pattern, anchored, advance bool) (int, bool) {
+	from := s.pos
+	end, ok := s.scan(re, anchored, advance)
+	return end - from, ok
+}
+
+// Scan matches re at the scan pointer and returns the match, advancing past
+// it.
+func (s *StringScanner) Scan(re Pattern) (String, bool) {
+	return s.scanString(re, true, true)
+}
+
+// ScanUntil searches for re and returns everything up to the end of the
+// match, advancing past it.
+func (s *StringScanner) ScanUntil(re Pattern) (String, bool) {
+	return s.scanString(re, false, true)
+}
+
+// Skip is Scan returning the length of the match in bytes.
+func (s *StringScanner) Skip(re Pattern) (int, bool) {
+	return s.scanLength(re, true, true)
+}
+
+// SkipUntil is ScanUntil returning the number of bytes advanced.
+func (s *StringScanner) SkipUntil(re Pattern) (int, bool) {
+	return s.scanLength(re, false, true)
+}
+
+// Check is Scan without advancing the scan pointer.
+func (s *StringScanner) Check(re Pattern) (String, bool) {
+	return s.scanString(re, true, false)
+}
+
+// CheckUntil is ScanUntil without advancing the scan pointer.
+func (s *StringScanner) CheckUntil(re Pattern) (String, bool) {
+	return s.scanString(re, false, false)
+}
+
+// Match returns the length in bytes of the match of re at the scan pointer,
+// without advancing.
+func (s *StringScanner) Match(re Pattern) (int, bool) {
+	return s.scanLength(re, true, false)
+}
+
+func (s *StringScanner) advance(width int) String {
+	s.prev = s.pos
+	s.pos += min(width, len(s.str.Value)-s.pos)
+	s.last = NewMatchData(s.str.Value, scannerCharPattern, []int{s.prev, s.pos})
+	s.matched = true
+	return s.str.withValue(s.str.Value[s.prev:s.pos])
+}
+
+// Getch returns the next character, advancing past it.
+func (s *StringScanner) Getch() (String, bool) {
+	if s.IsEOS() {
+		s.matched = false
+		return String{}, false
+	}
+	_, width, _ := s.str.Encoding().decodeChar(s.str.Value[s.pos:])
+	return s.advance(width), true
+}
+
+// GetByte returns the next byte as a String, advancing past it.
+func (s *StringScanner) GetByte() (String, bool) {
+	if s.IsEOS() {
+		s.matched = false
+		return String{}, false
+	}
+	return s.advance(1), true
+}
+
+// Peek returns up to length bytes at the scan pointer without advancing.
+func (s *StringScanner) Peek(length int) String {
+	if length < 0 {
+		panic("negative string size (or size too big)")
+	}
+	return s.str.withValue(s.str.Value[s.pos:min(s.pos+length, len(s.str.Value))])
+}
+
+// Unscan moves the scan pointer back to where the last match started from.
+func (s *StringScanner) Unscan() error {
+	if !s.matched {
+		return ScanError{"unscan error: not scanned yet"}
+	}
+	s.pos, s.matched = s.prev, false
+	return nil
+}
+
+// LastMatch returns the last match, which a failed match clears.
+func (s *StringScanner) LastMatch() (MatchData, bool) {
+	return s.last, s.matched
+}
+
+// Pos returns the scan pointer as a byte offset.
+func (s *StringScanner) Pos() int {
+	return s.pos
+}
+
+// CharPos returns the scan pointer as a character offset.
+func (s *StringScanner) CharPos() int {
+	return s.str.withValue(s.str.Value[:s.pos]).Length()
+}
+
+func (s *StringScanner) IsEOS() bool {
+	return s.pos >= len(s.str.Value)
+}
+
+func (s *StringScanner) Rest() String {
+	return s.str.withValue(s.str.Value[s.pos:])
+}
+
+// Terminate moves the scan pointer to the end of the string.
+func (s *StringScanner) Terminate() {
+	s.pos, s.matched = len(s.str.Value), false
+}
+
+// Inspect shows the scan pointer with a few bytes on either side of it.
+func (s *StringScanner) Inspect() string {
+	if s.IsEOS() {
+		return "#<StringScanner fin>"
+	}
+	const context = 5
+	inspect := "#<StringScanner " + strconv.Itoa(s.pos) + "/" + strconv.Itoa(len(s.str.Value))
+	if s.pos > 0 {
+		before := s.str.Value[:s.pos]
+		if len(before) > context {
+			before = "..." + before[len(before)-context:]
+		}
+		inspect += " " + s.str.withValue(before).Inspect()
+	}
+	after := s.str.Value[s.pos:]
+	if len(after) > context {
+		after = after[:context] + "..."
+	}
+	return inspect + " @ " + s.str.withValue(after).Inspect() + ">"
+}
@@ -0,0 +1,137 @@
+package rb
+
+import (
+	"testing"
+	"regexp"
+	"strings"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringScanner_Scan(t *testing.T) {
+	s := NewStringScanner(NewString("test string"))
+	word, space := MustCompileRegexp(`\w+`), MustCompileRegexp(`\s+`)
+
+	token, ok := s.Scan(word)
+	assert.Equal(t, NewString("test"), token, "Scan")
+	assert.True(t, ok, "Scan")
+	_, ok = s.Scan(word)
+	assert.False(t, ok, "Scan is anchored at the pointer")
+	_, ok = s.LastMatch()
+	assert.False(t, ok, "a failed scan clears the match")
+	token, _ = s.Scan(space)
+	assert.Equal(t, NewString(" "), token, "Scan")
+	token, _ = s.Scan(word)
+	assert.Equal(t, NewString("string"), token, "Scan")
+	assert.True(t, s.IsEOS(), "IsEOS")
+	_, ok = s.Scan(word)
+	assert.False(t, ok, "Scan at the end")
+
+	s = NewStringScanner(NewString("ab12"))
+	token, ok = s.Scan(regexp.MustCompile(`\d+`))
+	assert.False(t, ok, "Scan with a Go regexp is anchored")
+	token, ok = s.Scan(MustCompileGoRegexp(`[a-z]+`, 0))
+	assert.Equal(t, NewString("ab"), token, "Scan with a GoRegexp")
+	token, ok = s.Scan(regexp.MustCompile(`^\d`))
+	assert.Equal(t, NewString("1"), token, "^ matches at the pointer")
+}
+
+func TestStringScanner_ScanStaysAtPointer(t *testing.T) {
+	s := NewStringScanner(NewString(strings.Repeat("a", 1<<20) + "1"))
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		_, ok := s.Scan(regexp.MustCompile(`\d`))
+		assert.False(t, ok, "Scan with a Go regexp")
+		_, ok = s.Scan(MustCompileGoRegexp(`\d`, 0))
+		assert.False(t, ok, "Scan with a GoRegexp")
+	}
+	assert.Less(t, time.Since(start), time.Second, "a failed Scan does not look past the pointer")
+}
+
+func TestStringScanner_Until(t *testing.T) {
+	s := NewStringScanner(NewString("Fri Dec 12 1975 14:39"))
+	digits := MustCompileRegexp(`\d+`)
+
+	token, ok := s.CheckUntil(digits)
+	assert.Equal(t, NewString("Fri Dec 12"), token, "CheckUntil")
+	assert.True(t, ok, "CheckUntil")
+	assert.Equal(t, 0, s.Pos(), "CheckUntil does not advance")
+	token, _ = s.ScanUntil(digits)
+	assert.Equal(t, NewString("Fri Dec 12"), token, "ScanUntil")
+	m, _ := s.LastMatch()
+	assert.Equal(t, "12", m.String(), "LastMatch")
+	assert.Equal(t, "Fri Dec ", m.PreMatch(), "PreMatch")
+	assert.Equal(t, " 1975 14:39", m.PostMatch(), "PostMatch")
+	n, _ := s.SkipUntil(MustCompileRegexp(`:`))
+	assert.Equal(t, 9, n, "SkipUntil")
+	_, ok = s.ScanUntil(MustCompileRegexp(`x`))
+	assert.False(t, ok, "ScanUntil without a match")
+	assert.Equal(t, NewString("39"), s.Rest(), "Rest")
+}
+
+func TestStringScanner_CheckSkipMatch(t *testing.T) {
+	s := NewStringScanner(NewString("key = value"))
+	key := MustCompileRegexp(`(?<name>\w+)\s*=\s*`)
+
+	n, ok := s.Match(key)
+	assert.Equal(t, 6, n, "Match")
+	assert.True(t, ok, "Match")
+	token, _ := s.Check(key)
+	assert.Equal(t, NewString("key = "), token, "Check")
+	assert.Equal(t, 0, s.Pos(), "Check does not advance")
+	n, _ = s.Skip(key)
+	assert.Equal(t, 6, n, "Skip")
+	assert.Equal(t, 6, s.Pos(), "Skip advances")
+	m, _ := s.LastMatch()
+	assert.Equal(t, "key", *m.NamedCaptures()["name"], "named captures")
+	assert.Equal(t, []*string{m.Group(1)}, m.Captures(), "Captures")
+	_, ok = s.Match(key)
+	assert.False(t, ok, "Match without a match")
+}
+
+func TestStringScanner_Chars(t *testing.T) {
+	s := NewStringScanner(NewString("aé\xff"))
+	c, _ := s.Getch()
+	assert.Equal(t, NewString("a"), c, "Getch")
+	c, _ = s.Getch()
+	assert.Equal(t, NewString("é"), c, "Getch of a multibyte char")
+	assert.Equal(t, 3, s.Pos(), "Pos")
+	assert.Equal(t, 2, s.CharPos(), "CharPos")
+	assert.Equal(t, NewString("\xff"), s.Peek(10), "Peek")
+	c, _ = s.Getch()
+	assert.Equal(t, NewString("\xff"), c, "Getch of an invalid byte")
+	_, ok := s.Getch()
+	assert.False(t, ok, "Getch at the end")
+
+	s = NewStringScanner(NewString("éa"))
+	b, _ := s.GetByte()
+	assert.Equal(t, NewString("\xc3"), b, "GetByte")
+	m, _ := s.LastMatch()
+	assert.Equal(t, "\xa9a", m.PostMatch(), "PostMatch after GetByte")
+	assert.Equal(t, NewString("\xa9a"), s.Peek(2), "Peek")
+	assert.Panics(t, func() { s.Peek(-1) }, "negative Peek")
+}
+
+func TestStringScanner_Unscan(t *testing.T) {
+	s := NewStringScanner(NewString("test string"))
+	assert.Equal(t, ScanError{"unscan error: not scanned yet"}, s.Unscan(), "Unscan before a match")
+	s.Scan(MustCompileRegexp(`\w+`))
+	assert.Nil(t, s.Unscan(), "Unscan")
+	assert.Equal(t, 0, s.Pos(), "Unscan moves back")
+	assert.Equal(t, ScanError{"unscan error: not scanned yet"}, s.Unscan(), "Unscan twice")
+
+	s.Terminate()
+	assert.True(t, s.IsEOS(), "Terminate")
+	assert.Equal(t, NewString(""), s.Rest(), "Rest after Terminate")
+}
+
+func TestStringScanner_Inspect(t *testing.T) {
+	s := NewStringScanner(NewString("test string here"))
+	assert.Equal(t, `#<StringScanner 0/16 @ "test ...">`, s.Inspect(), "at the start")
+	s.Scan(MustCompileRegexp(`\w+`))
+	assert.Equal(t, `#<StringScanner 4/16 "test" @ " stri...">`, s.Inspect(), "in the middle")
+	s.Scan(MustCompileRegexp(`\s\w+\s`))
+	assert.Equal(t, `#<StringScanner 12/16 "...ring " @ "here">`, s.Inspect(), "near the end")
+	s.Terminate()
+	assert.Equal(t, "#<StringScanner fin>", s.Inspect(), "at the end")
+}
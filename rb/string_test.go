@@ -18,7 +18,7 @@ func TestString_Concat(t *testing.T) {
 	assert.Equal(t, "ab", NewString("a").Concat("b").Value, `"a".Concat("b")`)
 	assert.Equal(t, "ab99", NewString("ab").Concat(99).Value, `"ab".Concat(99)`)
 	assert.Equal(t, "ab99d", NewString("ab99").Concat(rune(100)).Value, `"ab99".Concat(rune(100))`)
-	assert.Equal(t, "ab99de", NewString("ab99d").Concat(String{"e"}).Value, `"ab99d".Concat(String{"e"})`)
+	assert.Equal(t, "ab99de", NewString("ab99d").Concat(NewString("e")).Value, `"ab99d".Concat(NewString("e"))`)
 	assert.Equal(t, "ab99de1", NewString("ab99de").Concat(byte(1)).Value, `"ab99de".Concat(byte(1))`)
 	assert.Equal(t, "atrue", NewString("a").Concat(true).Value, `"a".Concat(true)`)
 	assert.Equal(t, "abc", NewString("").Concat("a", "b", "c").Value, `"".Concat("a", "b", "c")`)
@@ -43,6 +43,17 @@ func TestString_OpSubscript(t *testing.T) {
 	assert.True(t, ok, "range OK")
 	assert.Equal(t, "bc红宝", sub.Value, "range")
 
+	sub, ok = str.OpSubscript2(-2, 2)
+	assert.True(t, ok, "negative start, length OK")
+	assert.Equal(t, "宝石", sub.Value, "negative start, length")
+
+	sub, ok = str.OpSubscript(NewRange(-3, -2))
+	assert.True(t, ok, "negative range OK")
+	assert.Equal(t, "红宝", sub.Value, "negative range")
+
+	_, ok = str.OpSubscript(NewRange(7, 8))
+	assert.False(t, ok, "range out of string")
+
 	sub, ok = str.OpSubscript(regexp.MustCompile(`c.`))
 	assert.True(t, ok, "regexp OK")
 	assert.Equal(t, "c红", sub.Value, "regexp")
@@ -76,10 +87,25 @@ func TestString_CenterWith(t *testing.T) {
 func TestString_Chomp(t *testing.T) {
 	assert.Equal(t, "abc", NewString("abc").Chomp().Value, "No update if not ended with LF")
 	assert.Equal(t, "abc", NewString("abc\n").Chomp().Value, "Remove trailing LF")
+	assert.Equal(t, "abc", NewString("abc\r\n").Chomp().Value, "Remove trailing CRLF")
+	assert.Equal(t, "abc", NewString("abc\r").Chomp().Value, "Remove trailing CR")
+	assert.Equal(t, "abc\n", NewString("abc\n\r").Chomp().Value, "Remove only CR after LF")
 }
 
 func TestString_Chomp1(t *testing.T) {
 	assert.Equal(t, "a", NewString("abc").Chomp1(NewString("bc")).Value, "Remove trailing sequence")
+	assert.Equal(t, "abc", NewString("abc\r\n\n\r\n").Chomp1(NewString("")).Value, "Remove all trailing newlines")
+	assert.Equal(t, "abc\r", NewString("abc\r").Chomp1(NewString("")).Value, "Keep a lone CR")
+	assert.Equal(t, "abc\r\n", NewString("abc\r\n").Chomp1(NewString("\n\n")).Value, "Not ended with the separator")
+	assert.Equal(t, "\xe3\x81\x82", NewString("\xe3\x81\x82").Chomp1(NewString("\x81\x82")).Value, "Not at a character boundary")
+}
+
+func TestString_Chop(t *testing.T) {
+	assert.Equal(t, "ab", NewString("abc").Chop().Value, "Remove last character")
+	assert.Equal(t, "ab", NewString("ab\r\n").Chop().Value, "Remove CRLF")
+	assert.Equal(t, "ab\n", NewString("ab\n\r").Chop().Value, "Remove CR after LF")
+	assert.Equal(t, "红宝", NewString("红宝石").Chop().Value, "Remove multibyte character")
+	assert.Equal(t, "", NewString("").Chop().Value, "Empty string")
 }
 
 func TestString_Count(t *testing.T) {
@@ -108,20 +134,693 @@ func TestString_Dump(t *testing.T) {
 	assert.Equal(t, `"hello \n ''"`, NewString("hello \n ''").Dump().Value, `\"hello \\n ''\".Dump()`)
 	assert.Equal(t, `"a\v"`, NewString("a\013").Dump().Value, `\"hello \\n ''\".Dump()`)
 	assert.Equal(t, `"a\xC4"`, NewString("a\xC4").Dump().Value, `\"hello \\n ''\".Dump()`)
+	assert.Equal(t, `"\u00E9\u{1F600}"`, NewString("é😀").Dump().Value, `"é😀".Dump()`)
 }
 
 func TestString_EachLine(t *testing.T) {
 	result := make([]string, 0, 5)
-	NewString("a\nb").EachLine(NewString(""), func(line String) {
+	ret := NewString("a\nb\nc").EachLine(NewString("\n"), LineOptions{}, func(line String) {
+		if line.Value == "c" {
+			Break()
+		}
 		result = append(result, line.Value)
 	})
-	assert.Equal(t, []string{"a", "b"}, result, "a\\nb")
+	assert.Equal(t, []string{"a\n", "b\n"}, result, "EachLine with Break")
+	assert.Equal(t, "a\nb\nc", ret.Value, "EachLine returns the receiver")
 }
 
 func TestString_Lines(t *testing.T) {
-	assert.Equal(t, []String{NewString("a"), NewString("b")}, NewString("a\nb").Lines(NewString("\n")), "a\\nb")
-	assert.Equal(t, []String{NewString("a"), NewString("")}, NewString("a\n").Lines(NewString("\n")), "a\\n")
-	assert.Equal(t, []String{NewString(""), NewString("b")}, NewString("\nb").Lines(NewString("\n")), "\\nb")
-	assert.Equal(t, []String{NewString("a")}, NewString("a").Lines(NewString("\n")), "a")
-	assert.Equal(t, []String{NewString("a"), NewString("b")}, NewString("a\r\nb").Lines(NewString("\r\n")), "a\\r\\nb")
+	nl := NewString("\n")
+	tests := []struct {
+		input     string
+		separator String
+		options   LineOptions
+		expected  []String
+	}{
+		{"a\nb", nl, LineOptions{}, newStrings("a\n", "b")},
+		{"a\n", nl, LineOptions{}, newStrings("a\n")},
+		{"\nb", nl, LineOptions{}, newStrings("\n", "b")},
+		{"a", nl, LineOptions{}, newStrings("a")},
+		{"", nl, LineOptions{}, []String{}},
+		{"a\r\nb", NewString("\r\n"), LineOptions{}, newStrings("a\r\n", "b")},
+		{"a--b--", NewString("--"), LineOptions{}, newStrings("a--", "b--")},
+		{"a\r\nb\nc\r", nl, LineOptions{Chomp: true}, newStrings("a", "b", "c\r")},
+		{"a--b--", NewString("--"), LineOptions{Chomp: true}, newStrings("a", "b")},
+		{"a\nb\n\n\nc\n\nd\n", NewString(""), LineOptions{}, newStrings("a\nb\n\n\n", "c\n\n", "d\n")},
+		{"a\nb\n\n\nc\n\nd\n", NewString(""), LineOptions{Chomp: true}, newStrings("a\nb", "c", "d")},
+		{"abcde\nfg\n", nl, LineOptions{Limit: 3}, newStrings("abc", "de\n", "fg\n")},
+		{"abcde\nfg\n", nl, LineOptions{Limit: 3, Chomp: true}, newStrings("abc", "de", "fg")},
+		{"红宝石", nl, LineOptions{Limit: 4}, newStrings("红宝", "石")},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).Lines(test.separator, test.options), "%q.Lines(%q, %+v)", test.input, test.separator.Value, test.options)
+	}
+}
+
+func TestString_Gsub(t *testing.T) {
+	str := NewString("hello world")
+	assert.Equal(t, "h*ll* w*rld", str.Gsub(regexp.MustCompile(`[aeiou]`), "*").Value, `gsub(/[aeiou]/, "*")`)
+	assert.Equal(t, "h<e>ll<o> w<o>rld", str.Gsub(regexp.MustCompile(`([aeiou])`), `<\1>`).Value, `gsub(/([aeiou])/, "<\\1>")`)
+	assert.Equal(t, "h{e}ll{o} w{o}rld", str.Gsub(regexp.MustCompile(`[aeiou]`), `{\0}`).Value, `gsub(/[aeiou]/, "{\\0}")`)
+	assert.Equal(t, "h-e-ll-o- w-o-rld", str.Gsub(regexp.MustCompile(`[aeiou]`), `-\&-`).Value, `gsub(/[aeiou]/, "-\\&-")`)
+	assert.Equal(t, "h[e]ll[o] w[o]rld", str.Gsub(regexp.MustCompile(`(?P<v>[aeiou])`), `[\k<v>]`).Value, `gsub(/(?<v>[aeiou])/, "[\\k<v>]")`)
+	assert.Equal(t, "hello hello ", str.Gsub(regexp.MustCompile(`world`), "\\`").Value, "gsub(/world/, \"\\\\`\")")
+	assert.Equal(t, " world world", str.Gsub(regexp.MustCompile(`hello`), `\'`).Value, `gsub(/hello/, "\\'")`)
+	assert.Equal(t, `h\ll\ w\rld`, str.Gsub(regexp.MustCompile(`[aeiou]`), `\\`).Value, `gsub(/[aeiou]/, "\\\\")`)
+	assert.Equal(t, "h3ll0 w0rld", str.Gsub(regexp.MustCompile(`[eo]`), map[string]string{"e": "3", "o": "0"}).Value, "hash replacement")
+	assert.Equal(t, "hll wrld", str.Gsub(regexp.MustCompile(`[eo]`), map[string]string{}).Value, "hash replacement without key")
+	assert.Equal(t, "HELLO WORLD", str.Gsub(regexp.MustCompile(`\w+`), func(m MatchData) String {
+		return NewString(m.String()).Upcase()
+	}).Value, "block replacement")
+	assert.Equal(t, "-a-b-c-", NewString("abc").Gsub(regexp.MustCompile(`x*`), "-").Value, "empty matches")
+	for _, re := range []Pattern{regexp.MustCompile(`a*`), MustCompileGoRegexp(`a*`, 0), MustCompileRegexp(`a*`)} {
+		assert.Equal(t, "-b--", NewString("baaa").Gsub(re, "-").Value, "empty match after a match with %T", re)
+	}
+}
+
+func TestString_GsubEnum(t *testing.T) {
+	result := make([]string, 0, 3)
+	iter := NewString("a1b22c333").GsubEnum(regexp.MustCompile(`\d+`))
+	for {
+		m, ok := iter()
+		if !ok {
+			break
+		}
+		result = append(result, m.String())
+	}
+	assert.Equal(t, []string{"1", "22", "333"}, result, "enumerate matches")
+}
+
+func TestString_Match(t *testing.T) {
+	str := NewString("红宝石 ruby gem")
+	m, ok := str.Match(regexp.MustCompile(`(\w)(\w+)`), 0)
+	assert.True(t, ok, "match OK")
+	assert.Equal(t, "ruby", m.String(), "match")
+	assert.Equal(t, "红宝石 ", m.PreMatch(), "pre match")
+	assert.Equal(t, []*string{m.Group(2), m.Group(1), nil}, m.ValuesAt(2, -2, 3), "values at")
+
+	m, ok = str.Match(regexp.MustCompile(`\w+`), 10)
+	assert.True(t, ok, "match from position OK")
+	assert.Equal(t, "em", m.String(), "match from position")
+	assert.Equal(t, 16, m.Begin(0), "begin of match from position")
+
+	m, ok = str.Match(regexp.MustCompile(`\w+`), -3)
+	assert.True(t, ok, "match from negative position OK")
+	assert.Equal(t, "gem", m.String(), "match from negative position")
+
+	_, ok = str.Match(regexp.MustCompile(`\w+`), 13)
+	assert.False(t, ok, "match out of string")
+	_, ok = str.Match(regexp.MustCompile(`x`), 0)
+	assert.False(t, ok, "no match")
+
+	assert.True(t, str.IsMatch(regexp.MustCompile(`gem`), 0), "match?")
+	assert.False(t, str.IsMatch(regexp.MustCompile(`ruby`), 9), "match? from position")
+	assert.False(t, str.IsMatch(regexp.MustCompile(``), -14), "match? out of string")
+	assert.False(t, NewString("ab").IsMatch(regexp.MustCompile(`^b`), 1), "match? sees ^ before position")
+	assert.True(t, NewString("a\nb").IsMatch(MustCompileGoRegexp(`^b`, 0), 1), "match? line anchor after position")
+
+	_, ok = NewString("ruby").Match(regexp.MustCompile(`\bu`), 1)
+	assert.False(t, ok, "match sees \\b before position")
+	m, ok = NewString("a ruby").Match(MustCompileGoRegexp(`\b\w`, 0), 1)
+	assert.True(t, ok, "match \\b from position OK")
+	assert.Equal(t, 2, m.Begin(0), "match \\b from position")
+	m, ok = NewString("aaa").Match(regexp.MustCompile(`aa`), 1)
+	assert.True(t, ok, "match overlapping the previous character OK")
+	assert.Equal(t, 1, m.Begin(0), "match overlapping the previous character")
+
+	pos, m := str.OpMatch(regexp.MustCompile(`r(u)by`))
+	assert.Equal(t, 4, pos, "=~ returns character position")
+	assert.Equal(t, "u", *m.Group(1), "=~ match data")
+	pos, _ = str.OpMatch(regexp.MustCompile(`x`))
+	assert.Equal(t, -1, pos, "=~ without match")
+}
+
+func TestString_IsMatchAllocs(t *testing.T) {
+	str := NewString("红宝石 ruby gem")
+	for _, re := range []Pattern{regexp.MustCompile(`\bg\w+`), MustCompileGoRegexp(`\bg\w+`, 0), MustCompileRegexp(`(?<= )g\w+`)} {
+		for _, pos := range []int{0, 5, 9} {
+			allocs := testing.AllocsPerRun(100, func() {
+				if !str.IsMatch(re, pos) {
+					t.Fatalf("IsMatch(%v, %d)", re, pos)
+				}
+			})
+			assert.Equal(t, 0.0, allocs, "IsMatch(%v, %d) allocates nothing", re, pos)
+		}
+	}
+}
+
+func TestString_Scan(t *testing.T) {
+	str := NewString("a1 b22 c333")
+	assert.Equal(t, []interface{}{NewString("1"), NewString("22"), NewString("333")}, str.Scan(regexp.MustCompile(`\d+`)), "scan whole matches")
+
+	a, b, one, two := "a", "b", "1", "22"
+	assert.Equal(t, []interface{}{[]*string{&a, &one}, []*string{&b, &two}}, str.Scan(regexp.MustCompile(`([ab])(\d+)`)), "scan groups")
+	assert.Equal(t, []interface{}{[]*string{nil}, []*string{nil}}, NewString("xx").Scan(regexp.MustCompile(`x(y)?`)), "scan unmatched group")
+	for _, re := range []Pattern{regexp.MustCompile(`a*`), MustCompileGoRegexp(`a*`, 0), MustCompileRegexp(`a*`)} {
+		assert.Equal(t, []interface{}{NewString(""), NewString("aaa"), NewString("")}, NewString("baaa").Scan(re), "empty match after a match with %T", re)
+	}
+
+	offsets := make([]int, 0, 2)
+	ret := str.ScanEach(regexp.MustCompile(`\d+`), func(m MatchData) {
+		if m.String() == "333" {
+			Break()
+		}
+		offsets = append(offsets, m.Begin(0))
+	})
+	assert.Equal(t, []int{1, 4}, offsets, "scan with block")
+	assert.Equal(t, str, ret, "scan with block returns receiver")
+}
+
+func TestString_Sub(t *testing.T) {
+	str := NewString("hello world")
+	assert.Equal(t, "h*llo world", str.Sub(regexp.MustCompile(`[aeiou]`), "*").Value, `sub(/[aeiou]/, "*")`)
+	assert.Equal(t, "hello world", str.Sub(regexp.MustCompile(`x`), "*").Value, `sub(/x/, "*")`)
+	assert.Equal(t, "world hello", str.Sub(regexp.MustCompile(`(\w+) (\w+)`), `\2 \1`).Value, `sub(/(\w+) (\w+)/, "\\2 \\1")`)
+}
+
+func TestString_OpSubscriptAssign(t *testing.T) {
+	str := NewString("abc红宝石")
+
+	ret, err := str.OpSubscriptAssign(3, NewString("X"))
+	assert.Nil(t, err, "utf8 index OK")
+	assert.Equal(t, "abcX宝石", ret.Value, "utf8 index")
+
+	ret, err = str.OpSubscriptAssign(-1, NewString("XY"))
+	assert.Nil(t, err, "negative index OK")
+	assert.Equal(t, "abc红宝XY", ret.Value, "negative index")
+
+	ret, err = str.OpSubscriptAssign(6, NewString("!"))
+	assert.Nil(t, err, "index at end OK")
+	assert.Equal(t, "abc红宝石!", ret.Value, "index at end")
+
+	_, err = str.OpSubscriptAssign(7, NewString("!"))
+	assert.Equal(t, IndexError{"index 7 out of string"}, err, "index out of string")
+
+	_, err = str.OpSubscriptAssign(-7, NewString("!"))
+	assert.Equal(t, IndexError{"index -7 out of string"}, err, "negative index out of string")
+
+	ret, err = str.OpSubscript2Assign(2, 2, NewString(""))
+	assert.Nil(t, err, "start, length OK")
+	assert.Equal(t, "ab宝石", ret.Value, "start, length")
+
+	ret, err = str.OpSubscript2Assign(-2, 10, NewString("Z"))
+	assert.Nil(t, err, "negative start, long length OK")
+	assert.Equal(t, "abc红Z", ret.Value, "negative start, long length")
+
+	_, err = str.OpSubscript2Assign(0, -1, NewString("Z"))
+	assert.Equal(t, IndexError{"negative length -1"}, err, "negative length")
+
+	ret, err = str.OpSubscriptAssign(NewRange(1, -2), NewString("-"))
+	assert.Nil(t, err, "range OK")
+	assert.Equal(t, "a-石", ret.Value, "range")
+
+	_, err = str.OpSubscriptAssign(NewRange(8, 9), NewString("-"))
+	assert.Equal(t, RangeError{"8..9 out of range"}, err, "range out of range")
+
+	ret, err = str.OpSubscriptAssign(regexp.MustCompile(`c.`), NewString("C"))
+	assert.Nil(t, err, "regexp OK")
+	assert.Equal(t, "abC宝石", ret.Value, "regexp")
+
+	ret, err = str.OpSubscript2Assign(regexp.MustCompile(`c(.)`), 1, NewString("R"))
+	assert.Nil(t, err, "regexp, int OK")
+	assert.Equal(t, "abcR宝石", ret.Value, "regexp, int")
+
+	ret, err = str.OpSubscript2Assign(regexp.MustCompile(`(?P<first>.)宝`), "first", NewString("-"))
+	assert.Nil(t, err, "regexp, name OK")
+	assert.Equal(t, "abc-宝石", ret.Value, "regexp, name")
+
+	_, err = str.OpSubscript2Assign(regexp.MustCompile(`c(.)`), 2, NewString("R"))
+	assert.Equal(t, IndexError{"index 2 out of regexp"}, err, "regexp capture out of range")
+
+	_, err = str.OpSubscript2Assign(regexp.MustCompile(`c(x)?`), 1, NewString("R"))
+	assert.Equal(t, IndexError{"regexp group 1 not matched"}, err, "regexp capture not matched")
+
+	_, err = str.OpSubscriptAssign(regexp.MustCompile(`z`), NewString("R"))
+	assert.Equal(t, IndexError{"regexp not matched"}, err, "regexp not matched")
+
+	ret, err = str.OpSubscriptAssign("宝", NewString("玉"))
+	assert.Nil(t, err, "string OK")
+	assert.Equal(t, "abc红玉石", ret.Value, "string")
+
+	_, err = str.OpSubscriptAssign(NewString("z"), NewString("玉"))
+	assert.Equal(t, IndexError{"string not matched"}, err, "string not matched")
+}
+
+func TestString_Undump(t *testing.T) {
+	undump := func(s string) string {
+		ret, err := NewString(s).Undump()
+		assert.Nil(t, err, s)
+		return ret.Value
+	}
+	assert.Equal(t, "hello \n ''", undump(`"hello \n ''"`), `"hello \n ''"`)
+	assert.Equal(t, "a\013\033\"\\#", undump(`"a\v\e\"\\\#"`), "escapes")
+	assert.Equal(t, "a\xC4", undump(`"a\xC4"`), "hex escape")
+	assert.Equal(t, "é😀", undump(`"\u00E9\u{1F600}"`), "Unicode escapes")
+	assert.Equal(t, "AB", undump(`"\u{41 42}"`), "multiple codepoints")
+	assert.Equal(t, "\x01F600", undump(`"\u0001F600"`), "\\u takes exactly four digits")
+	assert.Equal(t, "\n1234", undump(`"\u000A1234"`), "\\u takes exactly four digits")
+	assert.Equal(t, "é1234", undump(`"\u00E91234"`), "BMP escape followed by hex digits")
+
+	ret, err := NewString(`"a\x00".dup.force_encoding("UTF-16LE")`).Undump()
+	assert.Nil(t, err)
+	assert.Equal(t, NewString("a\x00").ForceEncoding(EncodingUTF16LE), ret, "force_encoding form")
+
+	_, err = NewString(`abc`).Undump()
+	assert.Equal(t, RuntimeError{`invalid dumped string; not wrapped with '"' nor '"...".force_encoding("...")' form`}, err, "not wrapped")
+	_, err = NewString(`"\x"`).Undump()
+	assert.Equal(t, RuntimeError{"invalid hex escape"}, err, "invalid hex escape")
+	_, err = NewString(`"\u12"`).Undump()
+	assert.Equal(t, RuntimeError{"invalid Unicode escape"}, err, "invalid Unicode escape")
+	_, err = NewString(`"\u{110000}"`).Undump()
+	assert.Equal(t, RuntimeError{"invalid Unicode codepoint (too large)"}, err, "codepoint too large")
+	_, err = NewString(`"\u{41"`).Undump()
+	assert.Equal(t, RuntimeError{"unterminated Unicode escape"}, err, "unterminated Unicode escape")
+	_, err = NewString(`"a"b"`).Undump()
+	assert.Equal(t, RuntimeError{"unescaped double quote found"}, err, "unescaped double quote")
+	_, err = NewString("\"é\"").Undump()
+	assert.Equal(t, RuntimeError{"non-ASCII character detected"}, err, "non-ASCII character")
+}
+
+func TestString_DumpUndumpRoundTrip(t *testing.T) {
+	samples := []string{"", "plain", "é1234", "😀\x00\x7F", "\xFF\xFE\xE3\x81", "�", "\"\\#{x}", "tab\tnew\nline\r"}
+	for b := 0; b < 256; b++ {
+		samples = append(samples, string([]byte{byte(b), 'a'}))
+	}
+	for _, s := range samples {
+		ret, err := NewString(s).Dump().Undump()
+		assert.Nil(t, err, s)
+		assert.Equal(t, s, ret.Value, "round trip %q", s)
+	}
+	utf16 := NewString("a😀").ForceEncoding(EncodingUTF16LE)
+	ret, err := utf16.Dump().Undump()
+	assert.Nil(t, err)
+	assert.Equal(t, utf16, ret, "round trip UTF-16LE")
+}
+
+func TestString_Tr(t *testing.T) {
+	tr := func(str, from, to string) string {
+		ret, err := NewString(str).Tr(NewString(from), NewString(to))
+		assert.Nil(t, err, "%q.Tr(%q, %q)", str, from, to)
+		return ret.Value
+	}
+	assert.Equal(t, "hippo", tr("hello", "el", "ip"), `"hello".Tr("el", "ip")`)
+	assert.Equal(t, "*e**o", tr("hello", "^aeiou", "*"), `"hello".Tr("^aeiou", "*")`)
+	assert.Equal(t, "ifmmp", tr("hello", "a-y", "b-z"), `"hello".Tr("a-y", "b-z")`)
+	assert.Equal(t, "h*ll*", tr("hello", "aeiou", "*"), "pads with the last character")
+	assert.Equal(t, "hippp", tr("hello", "elo", "ip"), "pads with the last to character")
+	assert.Equal(t, "hll", tr("hello", "aeiou", ""), "empty to deletes")
+	assert.Equal(t, "宝石^", tr("红石^", "红", "宝"), "multibyte")
+	assert.Equal(t, "x", tr("^", "^", "x"), "lone ^ is literal")
+	assert.Equal(t, "a-c", tr("a-b", "b\\-", "c-"), "escaped dash")
+	assert.Equal(t, "*\xff*\xfe", tr("a\xffb\xfe", "^z", "*"), "negated set keeps invalid bytes")
+	assert.Equal(t, "\xff\xfe", tr("a\xffb\xfe", "^\xff", ""), "negated delete keeps invalid bytes")
+
+	_, err := NewString("hello").Tr(NewString("z-a"), NewString("x"))
+	assert.Equal(t, ArgumentError{`invalid range "z-a" in string transliteration`}, err, "reversed range")
+	_, err = NewString("abc").Tr(NewString("a"), NewString("\xff"))
+	assert.Equal(t, ArgumentError{"invalid byte sequence in UTF-8"}, err, "to without characters")
+	_, err = NewString("abc").Tr(NewString("z-a"), NewString(""))
+	assert.Equal(t, ArgumentError{`invalid range "z-a" in string transliteration`}, err, "reversed range when deleting")
+}
+
+func TestString_TrS(t *testing.T) {
+	ret, err := NewString("hello").TrS(NewString("l"), NewString("r"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hero", ret.Value, `"hello".TrS("l", "r")`)
+
+	ret, err = NewString("aabbcc").TrS(NewString("ab"), NewString("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, "xcc", ret.Value, "only translated runs are squeezed")
+
+	ret, err = NewString("hello").TrS(NewString("^l"), NewString("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, "*ll*", ret.Value, `"hello".TrS("^l", "*")`)
+}
+
+func TestString_Squeeze(t *testing.T) {
+	ret, err := NewString("yellow  moon").Squeeze()
+	assert.Nil(t, err)
+	assert.Equal(t, "yelow mon", ret.Value, "squeeze all")
+
+	ret, err = NewString("  now   is  the").Squeeze(NewString(" "))
+	assert.Nil(t, err)
+	assert.Equal(t, " now is the", ret.Value, "squeeze spaces")
+
+	ret, err = NewString("putters shoot balls").Squeeze(NewString("m-z"))
+	assert.Nil(t, err)
+	assert.Equal(t, "puters shot balls", ret.Value, "squeeze range")
+
+	ret, err = NewString("\xff\xfe\xfe").Squeeze()
+	assert.Nil(t, err)
+	assert.Equal(t, "\xff\xfe", ret.Value, "invalid bytes compare by their bytes")
+
+	ret, err = NewString("\xff\xff").Squeeze(NewString("^a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "\xff\xff", ret.Value, "invalid bytes are not in any set")
+
+	ret, err = NewString("aaabbbccc").Squeeze(NewString("a-c"), NewString("^b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abbbc", ret.Value, "squeeze intersection")
+	ret, _ = NewString("aabbcc").Squeeze(NewString("^b"), NewString("^c"))
+	assert.Equal(t, "abbcc", ret.Value, "squeeze negated sets only")
+
+	_, err = NewString("hello").Squeeze(NewString("l-a"))
+	assert.Equal(t, ArgumentError{`invalid range "l-a" in string transliteration`}, err, "reversed range")
+}
+
+func TestString_Succ(t *testing.T) {
+	cases := map[string]string{
+		"":          "",
+		"abcd":      "abce",
+		"THX1138":   "THX1139",
+		"<<koala>>": "<<koalb>>",
+		"1999zzz":   "2000aaa",
+		"ZZZ9999":   "AAAA0000",
+		"***":       "**+",
+		"az":        "ba",
+		"zz":        "aaa",
+		"a9":        "b0",
+		"Zz":        "AAa",
+		"-9":        "-10",
+		"1.9.9":     "2.0.0",
+		"a-9":       "a-10",
+		"A01":       "A02",
+		"A09":       "A10",
+		"é":         "ê",
+		"\x7F":      "\x01\x00",
+	}
+	for str, expected := range cases {
+		assert.Equal(t, expected, NewString(str).Succ().Value, "%q.Succ()", str)
+	}
+	assert.Equal(t, "b", NewString("a").Next().Value, `"a".Next()`)
+}
+
+func TestString_Upcase(t *testing.T) {
+	assert.Equal(t, "STRASSE", NewString("straße").Upcase().Value, "special casing")
+	assert.Equal(t, "FFI ǄA", NewString("ﬃ ǆa").Upcase().Value, "ligature and digraph")
+	assert.Equal(t, "àB", NewString("àb").Upcase(CaseAscii).Value, ":ascii")
+	assert.Equal(t, "İI", NewString("iI").Upcase(CaseTurkic).Value, ":turkic")
+	assert.Equal(t, "I", NewString("i\u0307").Upcase(CaseLithuanian).Value, ":lithuanian drops the dot above i")
+	assert.Equal(t, "\xc9T\xc9", NewString("\xe9t\xe9").ForceEncoding(EncodingISO8859_1).Upcase().Value, "ISO-8859-1")
+	assert.Equal(t, "\xdf", NewString("\xdf").ForceEncoding(EncodingASCII8Bit).Upcase().Value, "ASCII-8BIT maps ASCII only")
+	assert.Panics(t, func() { NewString("a").Upcase(CaseFold) }, ":fold is only for Downcase")
+	assert.Panics(t, func() { NewString("a").Upcase(CaseAscii, CaseTurkic) }, ":ascii stands alone")
+}
+
+func TestString_Downcase(t *testing.T) {
+	assert.Equal(t, "όσος σ", NewString("ΌΣΟΣ Σ").Downcase().Value, "final sigma")
+	assert.Equal(t, "i\u0307", NewString("İ").Downcase().Value, "special casing")
+	assert.Equal(t, "ıi", NewString("Iİ").Downcase(CaseTurkic).Value, ":turkic")
+	assert.Equal(t, "i\u0307\u0301", NewString("Í").Downcase(CaseLithuanian).Value, ":lithuanian keeps the dot")
+	assert.Equal(t, "strasse ss", NewString("Straße ẞ").Downcase(CaseFold).Value, ":fold")
+	assert.Equal(t, "Ꭰ", NewString("ꭰ").Downcase(CaseFold).Value, ":fold Cherokee")
+	assert.Equal(t, "Éb", NewString("ÉB").Downcase(CaseAscii).Value, ":ascii")
+}
+
+func TestString_Capitalize(t *testing.T) {
+	assert.Equal(t, "Hello world", NewString("hELLO WORLD").Capitalize().Value, "Capitalize")
+	assert.Equal(t, "ǅemal", NewString("ǆEMAL").Capitalize().Value, "titlecase digraph")
+	assert.Equal(t, "Ffi", NewString("ﬃ").Capitalize().Value, "titlecase ligature")
+	assert.Equal(t, "İstanbul", NewString("iSTANBUL").Capitalize(CaseTurkic).Value, ":turkic")
+	assert.Equal(t, "", NewString("").Capitalize().Value, "empty")
+}
+
+func TestString_Swapcase(t *testing.T) {
+	assert.Equal(t, "hELLO wORLD", NewString("Hello World").Swapcase().Value, "Swapcase")
+	assert.Equal(t, "SSx", NewString("ßX").Swapcase().Value, "special casing")
+	assert.Equal(t, "äB", NewString("äb").Swapcase(CaseAscii).Value, ":ascii")
+}
+
+func TestString_Casecmp(t *testing.T) {
+	cmp, err := NewString("STRASSE").Casecmp(NewString("straße"))
+	assert.Nil(t, err, "Casecmp")
+	assert.Equal(t, 0, cmp, "Casecmp folds ß")
+	cmp, _ = NewString("abc").Casecmp(NewString("ABD"))
+	assert.Equal(t, -1, cmp, "Casecmp less")
+
+	equal, err := NewString("ΣΑΣ").IsCasecmp(NewString("σας"))
+	assert.Nil(t, err, "IsCasecmp")
+	assert.True(t, equal, "IsCasecmp folds final sigma")
+	equal, _ = NewString("ǅ").IsCasecmp(NewString("ǆ"))
+	assert.True(t, equal, "IsCasecmp titlecase")
+
+	utf16 := NewString("\x00\xe9").ForceEncoding(EncodingUTF16BE)
+	_, err = NewString("é").Casecmp(utf16)
+	assert.Equal(t, EncodingCompatibilityError{"incompatible character encodings: UTF-8 and UTF-16BE"}, err, "incompatible encodings")
+	_, err = NewString("").IsCasecmp(utf16)
+	assert.Nil(t, err, "an empty string is compatible")
+}
+
+func TestString_Ljust(t *testing.T) {
+	assert.Equal(t, "abc  ", NewString("abc").Ljust(5).Value, "Ljust")
+	assert.Equal(t, "abc121", NewString("abc").Ljust2(6, NewString("12")).Value, "Ljust2")
+	assert.Equal(t, "abc", NewString("abc").Ljust(2).Value, "Ljust shorter width")
+}
+
+func TestString_Rjust(t *testing.T) {
+	assert.Equal(t, "  abc", NewString("abc").Rjust(5).Value, "Rjust")
+	assert.Equal(t, "121abc", NewString("abc").Rjust2(6, NewString("12")).Value, "Rjust2")
+	assert.Panics(t, func() { NewString("abc").Rjust2(6, NewString("")) }, "empty padding")
+}
+
+func TestString_Index(t *testing.T) {
+	str := NewString("红宝石 ruby ruby")
+	tests := []struct {
+		pattern  interface{}
+		offset   int
+		expected int
+		found    bool
+	}{
+		{"ruby", 0, 4, true},
+		{NewString("ruby"), 5, 9, true},
+		{"ruby", -4, 9, true},
+		{"宝", 0, 1, true},
+		{"", 13, 13, true},
+		{"ruby", 14, 0, false},
+		{"ruby", -14, 0, false},
+		{"java", 0, 0, false},
+		{regexp.MustCompile(`r\w+`), 5, 9, true},
+		{MustCompileRegexp(`(?<= )r`), 0, 4, true},
+	}
+	for _, test := range tests {
+		index, found := str.Index(test.pattern, test.offset)
+		assert.Equal(t, test.found, found, "Index(%v, %d) found", test.pattern, test.offset)
+		assert.Equal(t, test.expected, index, "Index(%v, %d)", test.pattern, test.offset)
+	}
+}
+
+func TestString_Rindex(t *testing.T) {
+	str := NewString("红宝石 ruby ruby")
+	tests := []struct {
+		pattern  interface{}
+		offset   int
+		expected int
+		found    bool
+	}{
+		{"ruby", 13, 9, true},
+		{"ruby", 8, 4, true},
+		{"ruby", 100, 9, true},
+		{"ruby", -5, 4, true},
+		{"ruby", 3, 0, false},
+		{"", 13, 13, true},
+		{"ruby", -14, 0, false},
+		{regexp.MustCompile(`r\w+`), 13, 9, true},
+		{MustCompileRegexp(`(?<=宝)石`), 13, 2, true},
+		{MustCompileRegexp(`b`), 7, 6, true},
+		{regexp.MustCompile(`\bu`), 13, 0, false},
+		{MustCompileGoRegexp(`\Bu`, 0), 13, 10, true},
+		{MustCompileGoRegexp(`^r`, 0), 13, 0, false},
+	}
+	for _, test := range tests {
+		index, found := str.Rindex(test.pattern, test.offset)
+		assert.Equal(t, test.found, found, "Rindex(%v, %d) found", test.pattern, test.offset)
+		assert.Equal(t, test.expected, index, "Rindex(%v, %d)", test.pattern, test.offset)
+	}
+
+	index, found := NewString("aaa").Rindex(regexp.MustCompile(`aa`), 3)
+	assert.True(t, found, "Rindex overlapping matches found")
+	assert.Equal(t, 1, index, "Rindex overlapping matches")
+}
+
+func TestString_Byteindex(t *testing.T) {
+	str := NewString("红宝石 ruby ruby")
+	index, found, err := str.Byteindex("ruby", 0)
+	assert.Equal(t, []interface{}{10, true, nil}, []interface{}{index, found, err}, "Byteindex")
+	index, found, _ = str.Byteindex(regexp.MustCompile(`ruby`), 11)
+	assert.Equal(t, []interface{}{15, true}, []interface{}{index, found}, "Byteindex with regexp")
+	_, found, _ = str.Byteindex("ruby", 20)
+	assert.False(t, found, "Byteindex past the end")
+	_, _, err = str.Byteindex("ruby", 1)
+	assert.Equal(t, IndexError{"offset 1 does not land on character boundary"}, err, "Byteindex in a character")
+
+	index, found, _ = str.Byterindex("ruby", 19)
+	assert.Equal(t, []interface{}{15, true}, []interface{}{index, found}, "Byterindex")
+	index, found, _ = str.Byterindex("ruby", 14)
+	assert.Equal(t, []interface{}{10, true}, []interface{}{index, found}, "Byterindex before the last")
+	_, _, err = str.Byterindex("石", 7)
+	assert.Equal(t, IndexError{"offset 7 does not land on character boundary"}, err, "Byterindex in a character")
+}
+
+func TestString_Byteslice(t *testing.T) {
+	str := NewString("héllo")
+	sub, ok := str.Byteslice(0)
+	assert.Equal(t, []interface{}{"h", true}, []interface{}{sub.Value, ok}, "Byteslice(int)")
+	sub, ok = str.Byteslice(1)
+	assert.Equal(t, "\xc3", sub.Value, "Byteslice splits a character")
+	_, ok = str.Byteslice(6)
+	assert.False(t, ok, "Byteslice past the end")
+	sub, _ = str.Byteslice(-2)
+	assert.Equal(t, "l", sub.Value, "Byteslice negative")
+	sub, _ = str.Byteslice(NewRange(1, 2))
+	assert.Equal(t, "é", sub.Value, "Byteslice(Range)")
+
+	sub, ok = str.Byteslice2(3, 10)
+	assert.Equal(t, []interface{}{"llo", true}, []interface{}{sub.Value, ok}, "Byteslice2")
+	sub, ok = str.Byteslice2(6, 1)
+	assert.Equal(t, []interface{}{"", true}, []interface{}{sub.Value, ok}, "Byteslice2 at the end")
+	_, ok = str.Byteslice2(7, 1)
+	assert.False(t, ok, "Byteslice2 past the end")
+	_, ok = str.Byteslice2(0, -1)
+	assert.False(t, ok, "Byteslice2 negative length")
+}
+
+func TestString_Partition(t *testing.T) {
+	head, sep, tail := NewString("a=b=c").Partition("=")
+	assert.Equal(t, newStrings("a", "=", "b=c"), []String{head, sep, tail}, "Partition")
+	head, sep, tail = NewString("a=b=c").Rpartition(NewString("="))
+	assert.Equal(t, newStrings("a=b", "=", "c"), []String{head, sep, tail}, "Rpartition")
+	head, sep, tail = NewString("abc").Partition("=")
+	assert.Equal(t, newStrings("abc", "", ""), []String{head, sep, tail}, "Partition not found")
+	head, sep, tail = NewString("abc").Rpartition("=")
+	assert.Equal(t, newStrings("", "", "abc"), []String{head, sep, tail}, "Rpartition not found")
+	head, sep, tail = NewString("hello world").Partition(regexp.MustCompile(`o\s*`))
+	assert.Equal(t, newStrings("hell", "o ", "world"), []String{head, sep, tail}, "Partition with regexp")
+	head, sep, tail = NewString("hello world").Rpartition(regexp.MustCompile(`o\w*`))
+	assert.Equal(t, newStrings("hello w", "orld", ""), []String{head, sep, tail}, "Rpartition with regexp")
+}
+
+func TestString_Insert(t *testing.T) {
+	tests := []struct {
+		index    int
+		expected string
+	}{
+		{0, "Xabcd"},
+		{3, "abcXd"},
+		{4, "abcdX"},
+		{-3, "abXcd"},
+		{-1, "abcdX"},
+		{-5, "Xabcd"},
+	}
+	for _, test := range tests {
+		str, err := NewString("abcd").Insert(test.index, NewString("X"))
+		assert.Nil(t, err, "Insert(%d)", test.index)
+		assert.Equal(t, test.expected, str.Value, "Insert(%d)", test.index)
+	}
+	_, err := NewString("abcd").Insert(5, NewString("X"))
+	assert.Equal(t, IndexError{"index 5 out of string"}, err, "Insert out of string")
+	_, err = NewString("abcd").Insert(-6, NewString("X"))
+	assert.Equal(t, IndexError{"index -5 out of string"}, err, "Insert out of string")
+}
+
+func TestString_Prepend(t *testing.T) {
+	assert.Equal(t, "abcde", NewString("de").Prepend("a", NewString("b"), 'c').Value, "Prepend")
+}
+
+func TestString_B(t *testing.T) {
+	b := NewString("é").B()
+	assert.Equal(t, EncodingASCII8Bit, b.Encoding(), "B is binary")
+	assert.Equal(t, 2, b.Length(), "B counts bytes")
+	assert.Equal(t, EncodingUTF8, NewString("é").Encoding(), "B leaves the receiver")
+}
+
+func TestString_GetByte(t *testing.T) {
+	str := NewString("abc")
+	b, ok := str.GetByte(0)
+	assert.Equal(t, []interface{}{byte('a'), true}, []interface{}{b, ok}, "GetByte")
+	b, _ = str.GetByte(-1)
+	assert.Equal(t, byte('c'), b, "GetByte negative")
+	_, ok = str.GetByte(3)
+	assert.False(t, ok, "GetByte past the end")
+	_, ok = str.GetByte(-4)
+	assert.False(t, ok, "GetByte before the start")
+}
+
+func TestString_SetByte(t *testing.T) {
+	str, err := NewString("abc").SetByte(-1, 'x')
+	assert.Nil(t, err, "SetByte")
+	assert.Equal(t, "abx", str.Value, "SetByte negative")
+	str, _ = NewString("abc").B().SetByte(0, 0xff)
+	assert.Equal(t, NewString("\xffbc").B(), str, "SetByte keeps the encoding")
+	_, err = NewString("abc").SetByte(3, 'x')
+	assert.Equal(t, IndexError{"index 3 out of string"}, err, "SetByte out of string")
+}
+
+func TestString_Bytesplice(t *testing.T) {
+	str, err := NewString("hello").Bytesplice2(1, 3, NewString("ipp"))
+	assert.Nil(t, err, "Bytesplice2")
+	assert.Equal(t, "hippo", str.Value, "Bytesplice2")
+	str, _ = NewString("hello").Bytesplice2(-2, 10, NewString("p"))
+	assert.Equal(t, "help", str.Value, "Bytesplice2 negative start")
+	str, _ = NewString("hello").Bytesplice2(5, 0, NewString("!"))
+	assert.Equal(t, "hello!", str.Value, "Bytesplice2 at the end")
+	str, _ = NewString("héllo").Bytesplice(NewRangeExclusive(1, 3), NewString("e"))
+	assert.Equal(t, "hello", str.Value, "Bytesplice(Range)")
+
+	_, err = NewString("hello").Bytesplice2(6, 0, NewString("!"))
+	assert.Equal(t, IndexError{"index 6 out of string"}, err, "Bytesplice2 out of string")
+	_, err = NewString("hello").Bytesplice2(0, -1, NewString("!"))
+	assert.Equal(t, IndexError{"negative length -1"}, err, "Bytesplice2 negative length")
+	_, err = NewString("hello").Bytesplice(NewRange(6, 7), NewString("!"))
+	assert.Equal(t, RangeError{"6..7 out of range"}, err, "Bytesplice out of range")
+	_, err = NewString("héllo").Bytesplice2(1, 1, NewString("e"))
+	assert.Equal(t, IndexError{"offset 2 does not land on character boundary"}, err, "Bytesplice2 in a character")
+	_, err = NewString("\xff").B().Bytesplice2(0, 0, NewString("é"))
+	assert.Equal(t, EncodingCompatibilityError{"incompatible character encodings: ASCII-8BIT and UTF-8"}, err, "Bytesplice2 incompatible")
+
+	frame, _ := NewString("\x00\x00body").B().Bytesplice2(0, 2, NewString("\x00\x04").B())
+	assert.Equal(t, NewString("\x00\x04body").B(), frame, "Bytesplice2 on binary")
+}
+
+func TestString_Split(t *testing.T) {
+	tests := []struct {
+		input    string
+		pattern  interface{}
+		limit    int
+		expected []String
+	}{
+		{" now's  the time ", nil, 0, newStrings("now's", "the", "time")},
+		{" now's  the time ", " ", 0, newStrings("now's", "the", "time")},
+		{" now's  the time", regexp.MustCompile(` `), 0, newStrings("", "now's", "", "the", "time")},
+		{"1, 2.34,56, 7", regexp.MustCompile(`,\s*`), 0, newStrings("1", "2.34", "56", "7")},
+		{"hello", regexp.MustCompile(``), 0, newStrings("h", "e", "l", "l", "o")},
+		{"hello", regexp.MustCompile(``), 3, newStrings("h", "e", "llo")},
+		{"hi mom", regexp.MustCompile(`\s*`), 0, newStrings("h", "i", "m", "o", "m")},
+		{"mellow yellow", "ello", 0, newStrings("m", "w y", "w")},
+		{"1,2,,3,4,,", ",", 0, newStrings("1", "2", "", "3", "4")},
+		{"1,2,,3,4,,", NewString(","), 4, newStrings("1", "2", "", "3,4,,")},
+		{"1,2,,3,4,,", ",", -4, newStrings("1", "2", "", "3", "4", "", "")},
+		{"1:2:3", regexp.MustCompile(`(:)()()`), 2, newStrings("1", ":", "", "", "2:3")},
+		{"a1b2c", MustCompileRegexp(`(\d)`), 0, newStrings("a", "1", "b", "2", "c")},
+		{"aaa", regexp.MustCompile(`^a`), 0, newStrings("", "aa")},
+		{"a b", MustCompileGoRegexp(`\b`, 0), 0, newStrings("a", " ", "b")},
+		{" a  b  c ", " ", 2, newStrings("a", "b  c ")},
+		{" a  b  c ", nil, -1, newStrings("a", "b", "c", "")},
+		{"a b c", " ", 1, newStrings("a b c")},
+		{"abc", "", 2, newStrings("a", "bc")},
+		{"红宝石", "", 0, newStrings("红", "宝", "石")},
+		{"红宝石", regexp.MustCompile(``), 0, newStrings("红", "宝", "石")},
+		{"\xe7\xba\xa2\xa2", "\xa2", 0, newStrings("\xe7\xba\xa2")},
+		{"", ",", -1, []String{}},
+		{"", nil, 0, []String{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NewString(test.input).Split(test.pattern, test.limit), "%q.Split(%v, %d)", test.input, test.pattern, test.limit)
+	}
+
+	var fields []String
+	ret := NewString("a,b,,c,,").SplitEach(",", 0, func(field String) {
+		fields = append(fields, field)
+	})
+	assert.Equal(t, newStrings("a", "b", "", "c"), fields, "SplitEach")
+	assert.Equal(t, "a,b,,c,,", ret.Value, "SplitEach returns the receiver")
 }
@@ -1,6 +1,7 @@
 package rb
 
 import (
+	"strconv"
 	"unicode/utf8"
 )
 
@@ -13,7 +14,8 @@ type trIter struct {
 	buffer       [3]rune
 	bufferIndex  int
 	patternIndex int
-	rng          Range
+	rng          Range[int]
+	err          error
 }
 
 func (iter *trIter) fillBuffer() {
@@ -80,17 +82,23 @@ func (iter *trIter) next() (r rune, ok bool) {
 		return
 	}
 
+	if iter.buffer[0] > iter.buffer[2] {
+		iter.err = ArgumentError{"invalid range " + strconv.Quote(string(iter.buffer[:])) + " in string transliteration"}
+		iter.bufferIndex = 0
+		iter.patternIndex = len(iter.tr.pattern)
+		return 0, false
+	}
 	iter.rng = NewRange(int(iter.buffer[0]), int(iter.buffer[2]))
 	iter.drain(3)
 	return iter.next()
 }
 
 func (tr tr) IsNegative() bool {
-	return len(tr.pattern) > 0 && tr.pattern[0] == '^'
+	return len(tr.pattern) > 1 && tr.pattern[0] == '^'
 }
 
 func (tr tr) LazyChars() func() (rune, bool) {
-	iter := trIter{&tr, [3]rune{}, 0, 0, NewRange(0, -1)}
+	iter := trIter{&tr, [3]rune{}, 0, 0, NewRange(0, -1), nil}
 	if tr.IsNegative() {
 		iter.next()
 	}
@@ -100,14 +108,38 @@ func (tr tr) LazyChars() func() (rune, bool) {
 }
 
 func (tr tr) Chars() []rune {
+	chars, _ := tr.chars(tr.IsNegative())
+	return chars
+}
+
+// chars expands the pattern, skipping the leading ^ only if negative is set.
+func (tr tr) chars(negative bool) ([]rune, error) {
 	chars := make([]rune, 0, 4)
-	iter := tr.LazyChars()
+	iter := trIter{&tr, [3]rune{}, 0, 0, NewRange(0, -1), nil}
+	if negative {
+		iter.next()
+	}
 	for {
-		c, ok := iter()
+		c, ok := iter.next()
 		if !ok {
 			break
 		}
 		chars = append(chars, c)
 	}
-	return chars
+	return chars, iter.err
+}
+
+// trMatcher reports whether a rune is in the intersection of all the sets.
+func trMatcher(charsets ...String) (func(rune) bool, error) {
+	includes := make(map[rune]bool)
+	excludes := make(map[rune]bool)
+	intersect := false
+	for _, charset := range charsets {
+		if err := trSetupTable(charset, includes, excludes, &intersect); err != nil {
+			return nil, err
+		}
+	}
+	return func(r rune) bool {
+		return !excludes[r] && (!intersect || includes[r])
+	}, nil
 }